@@ -1,161 +1,279 @@
 package articles
 
 import (
-	"encoding/xml"
+	"context"
+	"errors"
 	"fmt"
 	"github.com/SkaisgirisMarius/article-processor/config"
-	"github.com/jasonlvhit/gocron"
+	"github.com/SkaisgirisMarius/article-processor/scheduler"
+	"github.com/SkaisgirisMarius/article-processor/upstream"
 	log "github.com/sirupsen/logrus"
-	"io"
 	"net/http"
 	"time"
 )
 
-// InitializeArticleRetriever sets up and starts the article retrieval scheduler.
-// It schedules the getNewArticles function to run at the specified interval defined in the configuration.
-func InitializeArticleRetriever() {
-	log.Printf("Initializing article scheduler to run every %v seconds", config.Conf.ArticleInterval)
-	scheduler := gocron.NewScheduler()
+// InitializeArticleRetriever sets up the article retrieval scheduler storing into the given storage, which is run by RunScheduler.
+// Every enabled feed from the configuration gets its own getNewArticles job running on the feed's cron
+// expressions, or at its interval when it has none. The backfills started through the endpoint run with the given
+// context, which is cancelled when the service stops, see WaitForBackgroundRuns.
+func InitializeArticleRetriever(ctx context.Context, store *Storage) {
+	backgroundRuns.ctx = ctx
+	s := scheduler.New()
 
-	err := scheduler.Every(uint64(config.Conf.ArticleInterval)).Seconds().Do(getNewArticles)
-	if err != nil {
-		log.Fatal("Error scheduling job:", err)
-		return
+	for _, feed := range config.Conf.Feeds {
+		if !feed.Enabled {
+			log.Printf("Feed %v is disabled, not scheduling it", feed.ClubKey)
+			continue
+		}
+		if _, err := newArticleSource(feed); err != nil {
+			log.Fatal("Error creating the article source:", err)
+			return
+		}
+		schedule, err := feedSchedule(feed)
+		if err != nil {
+			log.Fatal("Error parsing the schedule:", err)
+			return
+		}
+		if len(feed.Cron) > 0 {
+			log.Printf("Initializing article scheduler for %v to run on %v", feed.ClubKey, feed.Cron)
+		} else {
+			log.Printf("Initializing article scheduler for %v to run every %v seconds", feed.ClubKey, feed.Interval)
+		}
+		feed := feed
+		if err := s.Add(feed.ClubKey, schedule, func(ctx context.Context) { getNewArticles(ctx, store, feed) }); err != nil {
+			log.Fatal("Error scheduling job:", err)
+			return
+		}
 	}
-	scheduler.Start()
+	feedScheduler = s
 }
 
-// getNewArticles fetches the latest article list from the specified ArticleListURL,
-// reads the XML content, identifies missing articles from the database,
-// and inserts them in batch if there are any new articles.
-func getNewArticles() {
-	log.Println("Scanning for new articles")
-	response, err := http.Get(config.Conf.ArticleListURL)
-	if err != nil {
-		log.Println("Error sending GET request:", err)
+// getNewArticles runs the ingestion of the feed on schedule. Runs of the same feed never overlap, not even across
+// replicas, a run is skipped when another one is still in progress. Cancelling the context stops fetching from the
+// feed and storing, the articles that were not stored yet are fetched again by the next run.
+func getNewArticles(ctx context.Context, store *Storage, feed config.Feed) {
+	runCtx, finishRun, err := lockFeedRun(ctx, store, feed.ClubKey)
+	if err == errFeedRunning {
+		log.Printf("Another run of %v is still in progress, skipping this one", feed.ClubKey)
 		return
 	}
-	defer response.Body.Close()
-
-	bodyContent, err := io.ReadAll(response.Body)
 	if err != nil {
-		log.Println("Error reading response body:", err)
+		log.Printf("Could not lock the run of %v, skipping it: %v", feed.ClubKey, err)
 		return
 	}
+	defer finishRun()
+
+	runIngestion(runCtx, store, feed, runTriggerSchedule)
+}
+
+// runIngestion runs a single ingestion of the feed with ingestFeed and records it as an ingestion run.
+// The caller has to hold the run lock of the feed, see lockFeedRun.
+func runIngestion(ctx context.Context, store *Storage, feed config.Feed, trigger string) *IngestionRun {
+	run := &IngestionRun{Feed: feed.ClubKey, Trigger: trigger, StartedAt: time.Now().UTC()}
+	if err := ingestFeed(ctx, store, feed, run); err != nil {
+		run.Error = err.Error()
+	}
+	run.FinishedAt = time.Now().UTC()
+	saveIngestionRun(store, run)
+	return run
+}
 
-	articleList, err := readXMLContent(string(bodyContent))
+// ingestFeed lists the latest articles of the feed through its ArticleSource with a conditional request,
+// identifies missing and upstream-edited articles from the database when the list changed since the last run,
+// and upserts them in batch if there are any. The outcome of every step is counted in the given run.
+func ingestFeed(ctx context.Context, store *Storage, feed config.Feed, run *IngestionRun) error {
+	log.Printf("Scanning for new articles of %v", feed.ClubKey)
+	state, err := store.FeedStates.Get(ctx, feed.ClubKey)
 	if err != nil {
-		log.Println("Error reading XML: ", err)
-		return
+		log.Println("Error getting the feed state:", err)
+		return err
 	}
-	missingArticles, err := getMissingArticlesFromDatabase(articleList)
+	source, err := newArticleSource(feed)
 	if err != nil {
-		log.Println("Error: ", err)
-		return
+		log.Println("Error creating the article source:", err)
+		return err
 	}
-	if len(missingArticles) > 0 {
-		insertArticlesToDatabaseInBatch(missingArticles)
-	} else {
-		log.Println("There are no new articles to be added")
+	listResult, err := source.ListArticles(ctx, ListRequest{ETag: state.ETag, LastModified: state.LastModified})
+	var statusErr *upstream.StatusError
+	if errors.As(err, &statusErr) {
+		run.HTTPStatus = statusErr.StatusCode
 	}
-}
-
-// readXMLContent takes the XML content as input, unmarshals it into the ExternalArticleListData struct,
-// and transforms the received XML feeds into a slice of Article structs.
-func readXMLContent(xmlContent string) ([]Article, error) {
-	var result ExternalArticleListData
-	err := xml.Unmarshal([]byte(xmlContent), &result)
 	if err != nil {
-		log.Println("Failed to unmarshal XML: ", err)
-		return nil, err
+		log.Println("Error listing articles:", err)
+		return err
 	}
+	run.HTTPStatus = listResult.StatusCode
 
-	// Transform the received XML feeds into the Article struct
-	var articles []Article
-	for _, item := range result.NewsletterNewsItems.Items {
-		publishDate, err := time.Parse("2006-01-02 15:04:05", item.PublishDate)
+	// The list did not change since the last run, only the failed articles that are due have to be retried
+	if listResult.NotModified {
+		log.Printf("Article list of %v was not modified, skipping it", feed.ClubKey)
+		incrementSkippedPolls(store, feed.ClubKey)
+		retriedArticles, failed, err := fetchChangedArticles(ctx, store, feed, nil)
 		if err != nil {
-			log.Println("Failed to parse publish date: ", err)
-			return nil, err
+			log.Println("Error retrying failed articles: ", err)
+			return err
 		}
-		article := Article{
-			ArticleID:   item.NewsArticleID,
-			TeamID:      result.ClubName,
-			OptaMatchID: nil,
-			Title:       item.Title,
-			Type:        []string{item.Taxonomies},
-			Teaser:      item.TeaserText,
-			URL:         item.ArticleURL,
-			ImageURL:    item.ThumbnailImageURL,
-			Published:   publishDate,
-		}
-		articles = append(articles, article)
+		run.Failed = failed
+		return storeArticles(ctx, store, retriedArticles, run)
 	}
-	return articles, nil
-}
 
-// readXMLContentForSingleArticle takes the XML content for a single article as input, unmarshals it into the ExternalArticleData struct,
-// and creates an Article struct from the parsed data.
-func readXMLContentForSingleArticle(xmlContent string) (*Article, error) {
-	var result *ExternalArticleData
-	err := xml.Unmarshal([]byte(xmlContent), &result)
+	// Items of the list that could not be read are reported as failed articles instead of failing the whole list
+	recordFailedArticles(store, feed.ClubKey, listResult.Skipped)
+	run.Seen = len(listResult.Articles) + len(listResult.Skipped)
+
+	articleList := listResult.Articles
+	changedArticles, failed, err := getNewAndUpdatedArticlesFromDatabase(ctx, store, feed, articleList)
 	if err != nil {
-		log.Println("Failed to unmarshal XML: ", err)
-		return nil, err
+		log.Println("Error: ", err)
+		return err
+	}
+	run.Failed = failed + len(listResult.Skipped)
+	if len(changedArticles) == 0 {
+		log.Printf("There are no new or updated articles to be added for %v", feed.ClubKey)
+	}
+	if err := storeArticles(ctx, store, changedArticles, run); err != nil {
+		return err
 	}
+	saveFeedValidators(store, feed.ClubKey, listResult.ETag, listResult.LastModified)
 
-	// Check if there are any items in the XML
-	if result == nil {
-		return nil, fmt.Errorf("no articles found in the XML")
+	withdrawnIDs, err := getWithdrawnArticleIDs(ctx, store, feed, articleList, listResult.Skipped)
+	if err != nil {
+		log.Println("Error checking for withdrawn articles: ", err)
+		return err
+	}
+	if len(withdrawnIDs) > 0 {
+		if run.Withdrawn, err = withdrawArticlesInDatabase(ctx, store, feed.ClubKey, withdrawnIDs); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	publishDate, err := time.Parse("2006-01-02 15:04:05", result.NewsArticle.PublishDate)
+// storeArticles upserts the fetched articles of a run and counts the added and changed ones.
+func storeArticles(ctx context.Context, store *Storage, articles []Article, run *IngestionRun) error {
+	if len(articles) == 0 {
+		return nil
+	}
+	added, changed, err := insertArticlesToDatabaseInBatch(ctx, store, articles)
 	if err != nil {
-		log.Println("Failed to parse publish date: ", err)
-		return nil, err
+		return err
 	}
+	run.New += added
+	run.Updated += changed
+	return nil
+}
 
-	// Create and return the Article struct
-	article := &Article{
-		ArticleID:   result.NewsArticle.NewsArticleID,
-		TeamID:      result.ClubName,
-		OptaMatchID: result.NewsArticle.OptaMatchID,
-		Title:       result.NewsArticle.Title,
-		Type:        []string{result.NewsArticle.Taxonomies},
-		Teaser:      result.NewsArticle.TeaserText,
-		Content:     result.NewsArticle.BodyText,
-		URL:         result.NewsArticle.ArticleURL,
-		ImageURL:    result.NewsArticle.ThumbnailImageURL,
-		GalleryURLs: []string{result.NewsArticle.GalleryImageURLs},
-		VideoURL:    result.NewsArticle.VideoURL,
-		Published:   publishDate,
+// refreshArticle fetches a stored article again from the source of its feed and overwrites it, recording the
+// refresh as an ingestion run. An article that is no longer available or was unpublished upstream is withdrawn.
+// The refresh holds the run lock of the feed, so it returns errFeedRunning without refreshing while a run of the
+// feed is in progress.
+func refreshArticle(ctx context.Context, store *Storage, feed config.Feed, article *Article) (*IngestionRun, error) {
+	runCtx, finishRun, err := lockFeedRun(ctx, store, feed.ClubKey)
+	if err != nil {
+		return nil, err
 	}
+	defer finishRun()
 
-	return article, nil
+	run := &IngestionRun{
+		Feed:      feed.ClubKey,
+		Trigger:   runTriggerRefresh,
+		ArticleID: article.ArticleID,
+		StartedAt: time.Now().UTC(),
+		Seen:      1,
+	}
+	if err := refreshFeedArticle(runCtx, store, feed, article, run); err != nil {
+		run.Error = err.Error()
+	}
+	run.FinishedAt = time.Now().UTC()
+	saveIngestionRun(store, run)
+	return run, nil
 }
 
-// getArticleByID retrieves an article from the provided API URL by sending a GET request with the given ID.
-// It reads the XML response body, parses it into an Article struct using the readXMLContentForSingleArticle function,
-// and returns the resulting article or an error if any occurred during the process.
-func getArticleByID(id string) (*Article, error) {
-	response, err := http.Get(config.Conf.ArticleURL + id)
+// RefreshFeedArticles is a one-off command that fetches every stored article of the feed with the given club key
+// again and overwrites it, as the refresh endpoint does for a single article. It corrects the articles stored with
+// dates read in another timezone than the feed's, which are not ingested again since their upstream update does not
+// look newer. The refresh holds the run lock of the feed and is recorded as a single ingestion run.
+func RefreshFeedArticles(ctx context.Context, store *Storage, clubKey string) error {
+	feed, found := config.Conf.FindFeed(clubKey)
+	if !found {
+		return fmt.Errorf("feed %v is not configured", clubKey)
+	}
+	runCtx, finishRun, err := lockFeedRun(ctx, store, clubKey)
 	if err != nil {
-		log.Println("Error sending GET request:", err)
-		return nil, err
+		return err
 	}
-	defer response.Body.Close()
+	defer finishRun()
 
-	// Read the response body content as a string
-	bodyContent, err := io.ReadAll(response.Body)
+	storedArticles, err := store.Articles.List(runCtx, ArticleFilter{TeamID: clubKey, IncludeWithdrawn: true})
 	if err != nil {
-		log.Println("Error reading response body:", err)
-		return nil, err
+		return err
 	}
+	run := &IngestionRun{Feed: clubKey, Trigger: runTriggerRefresh, StartedAt: time.Now().UTC(), Seen: len(storedArticles)}
+	// An article that could not be fetched is counted as failed, storing the others stops the refresh
+	var refreshErr error
+	for _, article := range storedArticles {
+		if refreshErr = runCtx.Err(); refreshErr != nil {
+			break
+		}
+		articleRun := &IngestionRun{}
+		if err := refreshFeedArticle(runCtx, store, feed, article, articleRun); err != nil && articleRun.Failed == 0 {
+			refreshErr = err
+			break
+		}
+		run.New += articleRun.New
+		run.Updated += articleRun.Updated
+		run.Withdrawn += articleRun.Withdrawn
+		run.Failed += articleRun.Failed
+	}
+	if refreshErr != nil {
+		run.Error = refreshErr.Error()
+	}
+	run.FinishedAt = time.Now().UTC()
+	saveIngestionRun(store, run)
+	log.Printf("Refreshed the %v articles of %v: %v updated, %v withdrawn, %v failed",
+		len(storedArticles), clubKey, run.Updated, run.Withdrawn, run.Failed)
+	return refreshErr
+}
 
-	article, err := readXMLContentForSingleArticle(string(bodyContent))
+// refreshFeedArticle fetches the stored article again from the feed's source and overwrites it, counting the
+// outcome in the given run. A published article that is unpublished upstream is withdrawn, as by the ingestion.
+// The caller has to hold the run lock of the feed.
+func refreshFeedArticle(ctx context.Context, store *Storage, feed config.Feed, article *Article, run *IngestionRun) error {
+	articleID := article.ArticleID
+	source, err := newArticleSource(feed)
 	if err != nil {
-		log.Println("Error reading XML: ", err)
-		return nil, err
+		log.Println("Error creating the article source:", err)
+		return err
+	}
+	fetchCtx, cancel := context.WithTimeout(ctx, config.Conf.Ingestion.FetchTimeoutDuration())
+	defer cancel()
+	fetchedArticle, err := source.FetchArticle(fetchCtx, articleID)
+	if err == errArticleNotFound {
+		log.Printf("Article %v of %v is no longer available upstream, withdrawing it", articleID, feed.ClubKey)
+		run.HTTPStatus = http.StatusNotFound
+		clearFailedArticles(store, feed.ClubKey, []string{articleID})
+		run.Withdrawn, err = withdrawArticlesInDatabase(ctx, store, feed.ClubKey, []string{articleID})
+		return err
+	}
+	var statusErr *upstream.StatusError
+	if errors.As(err, &statusErr) {
+		run.HTTPStatus = statusErr.StatusCode
+	}
+	if err != nil {
+		log.Printf("Failed to refresh article %v of %v: %v", articleID, feed.ClubKey, err)
+		run.Failed = 1
+		return err
+	}
+
+	run.HTTPStatus = http.StatusOK
+	clearFailedArticles(store, feed.ClubKey, []string{articleID})
+	if err := storeArticles(ctx, store, []Article{*fetchedArticle}, run); err != nil {
+		return err
+	}
+	if fetchedArticle.State == stateUnpublished && article.State != stateUnpublished {
+		log.Printf("Article %v of %v was unpublished upstream, withdrawing it", articleID, feed.ClubKey)
+		run.Withdrawn, err = withdrawArticlesInDatabase(ctx, store, feed.ClubKey, []string{articleID})
+		return err
 	}
-	return article, nil
+	return nil
 }
@@ -4,36 +4,23 @@ import (
 	"context"
 	"fmt"
 	"github.com/SkaisgirisMarius/article-processor/config"
+	"github.com/SkaisgirisMarius/article-processor/leader"
 	"github.com/stretchr/testify/assert"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
-func TestInsertArticlesToDatabaseInBatch(t *testing.T) {
-	// Connect to the MongoDB database
+func TestMain(m *testing.M) {
 	config.GetConfig("../conf_test.yaml")
-	mongoURI := fmt.Sprintf("%s://%s:%s", config.Conf.MongoDb.DriverName, config.Conf.MongoDb.Host, config.Conf.MongoDb.Port)
-	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(mongoURI))
-	if err != nil {
-		t.Fatal("Failed to connect to MongoDB: ", err)
-	}
-	defer client.Disconnect(context.Background())
-
-	// Create a collection for testing
-	collection := getArticlesCollection()
-	if err != nil {
-		t.Fatal("Failed to get a collection for testing: ", err)
-	}
+	os.Exit(m.Run())
+}
 
-	// Cleanup after the test
-	defer func() {
-		_, err = collection.DeleteMany(context.Background(), bson.M{})
-		if err != nil {
-			t.Fatal("Failed to clean up test data: ", err)
-		}
-	}()
+func TestInsertArticlesToDatabaseInBatch(t *testing.T) {
+	store := NewMemoryStorage()
 
 	// Define the test articles
 	article1 := Article{
@@ -52,10 +39,13 @@ func TestInsertArticlesToDatabaseInBatch(t *testing.T) {
 	}
 
 	// Insert the articles to the database
-	insertArticlesToDatabaseInBatch([]Article{article1, article2, article3})
+	added, changed, err := insertArticlesToDatabaseInBatch(context.Background(), store, []Article{article1, article2, article3})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, added)
+	assert.Equal(t, 0, changed)
 
-	// Call getArticleListFromDatabase() to get all articles
-	articles, err := getArticleListFromDatabase()
+	// List all articles
+	articles, err := store.Articles.List(context.Background(), ArticleFilter{})
 	assert.NoError(t, err)
 
 	// Check if the article count matches
@@ -64,9 +54,405 @@ func TestInsertArticlesToDatabaseInBatch(t *testing.T) {
 	// Check if the articles were inserted correctly
 	for _, a := range articles {
 		if a.ArticleID == article1.ArticleID {
-			result, err := getArticleByIDFromDatabase(a.ID.Hex())
+			result, err := getArticleByIDFromDatabase(context.Background(), store, a.ID.Hex())
 			assert.NoError(t, err)
 			assert.Equal(t, article1.Title, result.Title)
 		}
 	}
+
+	// Overwriting an article keeps its earlier version as a revision
+	article1.Title = "Test Article 1 (updated)"
+	added, changed, err = insertArticlesToDatabaseInBatch(context.Background(), store, []Article{article1})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, added)
+	assert.Equal(t, 1, changed)
+	stored, err := store.Articles.FindByArticleIDs(context.Background(), "", []string{article1.ArticleID})
+	assert.NoError(t, err)
+	revisions, err := store.Revisions.List(context.Background(), stored[0].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(revisions))
+	assert.Equal(t, 1, revisions[0].Revision)
+	assert.Equal(t, "Test Article 1", revisions[0].Article.Title)
+	assert.Equal(t, []string{"title"}, revisions[0].ChangedFields)
+
+	// Storing an article whose tracked fields did not change adds no revision
+	article1.LastUpdated = time.Date(2023, 7, 1, 10, 0, 0, 0, time.UTC)
+	_, _, err = insertArticlesToDatabaseInBatch(context.Background(), store, []Article{article1})
+	assert.NoError(t, err)
+	revisions, err = store.Revisions.List(context.Background(), stored[0].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(revisions))
+}
+
+func TestGetNewAndUpdatedArticlesComparesLastUpdated(t *testing.T) {
+	config.Conf.Ingestion.Concurrency, config.Conf.Ingestion.FetchTimeout = 2, 5
+	stored := time.Date(2023, 7, 2, 10, 0, 0, 0, time.UTC)
+
+	// Only an upstream update after the stored one fetches the article again
+	tests := map[string]struct {
+		upstreamUpdated time.Time
+		refetched       bool
+	}{
+		"newer":   {upstreamUpdated: stored.Add(time.Minute), refetched: true},
+		"equal":   {upstreamUpdated: stored},
+		"older":   {upstreamUpdated: stored.Add(-time.Hour)},
+		"missing": {},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var fetches atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fetches.Add(1)
+				fmt.Fprintf(w, `<NewsArticleInformation><NewsArticle><NewsArticleID>1</NewsArticleID>`+
+					`<PublishDate>2023-07-01 10:00:00</PublishDate><LastUpdateDate>2023-07-02 10:01:00</LastUpdateDate>`+
+					`<Title>Edited</Title><IsPublished>True</IsPublished></NewsArticle></NewsArticleInformation>`)
+			}))
+			defer server.Close()
+			feed := config.Feed{ClubKey: "test", ArticleURL: server.URL + "?id={id}"}
+
+			store := NewMemoryStorage()
+			_, _, err := store.Articles.Upsert(context.Background(), []Article{
+				{TeamID: "test", ArticleID: "1", Title: "Original", LastUpdated: stored, State: statePublished},
+			})
+			assert.NoError(t, err)
+
+			listed := []Article{{TeamID: "test", ArticleID: "1", LastUpdated: test.upstreamUpdated, State: statePublished}}
+			changed, failed, err := getNewAndUpdatedArticlesFromDatabase(context.Background(), store, feed, listed)
+			assert.NoError(t, err)
+			assert.Equal(t, 0, failed)
+			if test.refetched {
+				assert.Equal(t, int32(1), fetches.Load())
+				assert.Equal(t, 1, len(changed))
+				assert.Equal(t, "Edited", changed[0].Title)
+			} else {
+				assert.Equal(t, int32(0), fetches.Load())
+				assert.Empty(t, changed)
+			}
+		})
+	}
+}
+
+func TestIngestFeedWithMemoryStorage(t *testing.T) {
+	config.Conf.Ingestion.Concurrency, config.Conf.Ingestion.FetchTimeout = 2, 5
+	store := NewMemoryStorage()
+
+	// Article 1 is taken down upstream after the first run, article 2 is edited
+	var withdrawn atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		item := func(id, published, updated, title string) string {
+			return fmt.Sprintf(`<NewsArticleID>%s</NewsArticleID><PublishDate>%s</PublishDate>`+
+				`<LastUpdateDate>%s</LastUpdateDate><Title>%s</Title><IsPublished>True</IsPublished>`, id, published, updated, title)
+		}
+		article1 := item("1", "2023-07-03 10:00:00", "2023-07-03 10:00:00", "First")
+		article2 := item("2", "2023-07-02 10:00:00", "2023-07-02 10:00:00", "Second")
+		if withdrawn.Load() {
+			article2 = item("2", "2023-07-02 10:00:00", "2023-07-04 10:00:00", "Second (edited)")
+		}
+
+		if r.URL.Path == "/list" {
+			items := "<NewsletterNewsItem>" + article2 + "</NewsletterNewsItem>"
+			if !withdrawn.Load() {
+				items = "<NewsletterNewsItem>" + article1 + "</NewsletterNewsItem>" + items
+			}
+			fmt.Fprintf(w, `<NewListInformation><NewsletterNewsItems>%s</NewsletterNewsItems></NewListInformation>`, items)
+			return
+		}
+		switch id := r.URL.Query().Get("id"); {
+		case id == "1" && !withdrawn.Load():
+			fmt.Fprintf(w, `<NewsArticleInformation><NewsArticle>%s</NewsArticle></NewsArticleInformation>`, article1)
+		case id == "2":
+			fmt.Fprintf(w, `<NewsArticleInformation><NewsArticle>%s</NewsArticle></NewsArticleInformation>`, article2)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	feed := config.Feed{ClubKey: "test", ListURL: server.URL + "/list", ArticleURL: server.URL + "/article?id={id}"}
+
+	run := runIngestion(context.Background(), store, feed, runTriggerManual)
+	assert.Empty(t, run.Error)
+	assert.Equal(t, 2, run.Seen)
+	assert.Equal(t, 2, run.New)
+
+	withdrawn.Store(true)
+	run = runIngestion(context.Background(), store, feed, runTriggerManual)
+	assert.Empty(t, run.Error)
+	assert.Equal(t, 0, run.New)
+	assert.Equal(t, 1, run.Updated)
+	assert.Equal(t, 1, run.Withdrawn)
+
+	// Only the edited article is still listed, the withdrawn one is kept but hidden
+	articles, err := store.Articles.List(context.Background(), ArticleFilter{TeamID: "test"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(articles))
+	assert.Equal(t, "Second (edited)", articles[0].Title)
+	hidden, err := store.Articles.FindByArticleIDs(context.Background(), "test", []string{"1"})
+	assert.NoError(t, err)
+	assert.Equal(t, stateWithdrawn, hidden[0].State)
+
+	// Both runs are recorded
+	runs, total, err := store.Runs.List(context.Background(), "test", 1, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+	assert.Equal(t, 1, runs[0].Withdrawn)
+}
+
+func TestIngestFeedWithdrawsUpdatedUnpublishedArticles(t *testing.T) {
+	config.Conf.Ingestion.Concurrency, config.Conf.Ingestion.FetchTimeout = 2, 5
+	store := NewMemoryStorage()
+
+	// The article is unpublished upstream and edited at the same time after the first run
+	var unpublished atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		article := `<NewsArticleID>1</NewsArticleID><PublishDate>2023-07-03 10:00:00</PublishDate>` +
+			`<LastUpdateDate>2023-07-03 10:00:00</LastUpdateDate><Title>First</Title><IsPublished>True</IsPublished>`
+		if unpublished.Load() {
+			article = `<NewsArticleID>1</NewsArticleID><PublishDate>2023-07-03 10:00:00</PublishDate>` +
+				`<LastUpdateDate>2023-07-04 10:00:00</LastUpdateDate><Title>First</Title><IsPublished>False</IsPublished>`
+		}
+		if r.URL.Path == "/list" {
+			fmt.Fprintf(w, `<NewListInformation><NewsletterNewsItems><NewsletterNewsItem>%s</NewsletterNewsItem>`+
+				`</NewsletterNewsItems></NewListInformation>`, article)
+			return
+		}
+		fmt.Fprintf(w, `<NewsArticleInformation><NewsArticle>%s</NewsArticle></NewsArticleInformation>`, article)
+	}))
+	defer server.Close()
+	feed := config.Feed{ClubKey: "test", ListURL: server.URL + "/list", ArticleURL: server.URL + "/article?id={id}"}
+
+	run := runIngestion(context.Background(), store, feed, runTriggerManual)
+	assert.Empty(t, run.Error)
+	assert.Equal(t, 1, run.New)
+
+	unpublished.Store(true)
+	run = runIngestion(context.Background(), store, feed, runTriggerManual)
+	assert.Empty(t, run.Error)
+	assert.Equal(t, 1, run.Updated)
+
+	stored, err := store.Articles.FindByArticleIDs(context.Background(), "test", []string{"1"})
+	assert.NoError(t, err)
+	assert.Equal(t, stateWithdrawn, stored[0].State)
+}
+
+func TestRefreshArticleWithdrawsUnpublishedArticles(t *testing.T) {
+	config.Conf.Ingestion.Concurrency, config.Conf.Ingestion.FetchTimeout = 2, 5
+	store := NewMemoryStorage()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<NewsArticleInformation><NewsArticle><NewsArticleID>1</NewsArticleID>`+
+			`<PublishDate>2023-07-03 10:00:00</PublishDate><LastUpdateDate>2023-07-04 10:00:00</LastUpdateDate>`+
+			`<Title>First</Title><IsPublished>False</IsPublished></NewsArticle></NewsArticleInformation>`)
+	}))
+	defer server.Close()
+	feed := config.Feed{ClubKey: "refresh-withdraw", ArticleURL: server.URL + "?id={id}"}
+	_, _, err := store.Articles.Upsert(context.Background(), []Article{{TeamID: feed.ClubKey, ArticleID: "1", Title: "First", State: statePublished}})
+	assert.NoError(t, err)
+	stored, err := store.Articles.FindByArticleIDs(context.Background(), feed.ClubKey, []string{"1"})
+	assert.NoError(t, err)
+
+	run, err := refreshArticle(context.Background(), store, feed, &stored[0])
+	assert.NoError(t, err)
+	assert.Empty(t, run.Error)
+	assert.Equal(t, 1, run.Withdrawn)
+	stored, err = store.Articles.FindByArticleIDs(context.Background(), feed.ClubKey, []string{"1"})
+	assert.NoError(t, err)
+	assert.Equal(t, stateWithdrawn, stored[0].State)
+}
+
+func TestRefreshFeedArticlesParsesDatesInFeedTimezone(t *testing.T) {
+	config.Conf.Ingestion.Concurrency, config.Conf.Ingestion.FetchTimeout = 2, 5
+	store := NewMemoryStorage()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<NewsArticleInformation><NewsArticle><NewsArticleID>1</NewsArticleID>`+
+			`<PublishDate>2023-07-03 10:00:00</PublishDate><LastUpdateDate>2023-07-03 10:00:00</LastUpdateDate>`+
+			`<Title>First</Title><IsPublished>True</IsPublished></NewsArticle></NewsArticleInformation>`)
+	}))
+	defer server.Close()
+	feed := config.Feed{ClubKey: "refresh-dates", ArticleURL: server.URL + "?id={id}", Timezone: "Europe/London"}
+	feeds := config.Conf.Feeds
+	config.Conf.Feeds = append([]config.Feed{feed}, feeds...)
+	defer func() { config.Conf.Feeds = feeds }()
+
+	// The article was stored when the dates of the feed were read in UTC
+	readInUTC := time.Date(2023, 7, 3, 10, 0, 0, 0, time.UTC)
+	_, _, err := store.Articles.Upsert(context.Background(), []Article{
+		{TeamID: feed.ClubKey, ArticleID: "1", Title: "First", Published: readInUTC, LastUpdated: readInUTC, State: statePublished},
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, RefreshFeedArticles(context.Background(), store, feed.ClubKey))
+	stored, err := store.Articles.FindByArticleIDs(context.Background(), feed.ClubKey, []string{"1"})
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2023, 7, 3, 9, 0, 0, 0, time.UTC), stored[0].Published.UTC())
+	runs, total, err := store.Runs.List(context.Background(), feed.ClubKey, 1, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+	assert.Equal(t, runTriggerRefresh, runs[0].Trigger)
+	assert.Equal(t, 1, runs[0].Updated)
+	assert.Error(t, RefreshFeedArticles(context.Background(), store, "unknown"))
+}
+
+func TestRefreshArticleWaitsForRunningIngestion(t *testing.T) {
+	store := NewMemoryStorage()
+	feed := config.Feed{ClubKey: "refresh-test", ArticleURL: "http://127.0.0.1:0/article?id={id}"}
+	assert.True(t, startFeedRun(feed.ClubKey))
+
+	run, err := refreshArticle(context.Background(), store, feed, &Article{ArticleID: "1", TeamID: feed.ClubKey})
+	assert.Equal(t, errFeedRunning, err)
+	assert.Nil(t, run)
+
+	finishFeedRun(feed.ClubKey)
+	assert.True(t, startFeedRun(feed.ClubKey))
+	finishFeedRun(feed.ClubKey)
+}
+
+func TestLockFeedRunAcrossReplicas(t *testing.T) {
+	store := NewMemoryStorage()
+	store.Locks = leader.NewMemoryStore()
+	ttl := config.Conf.Leader.LeaseTTLDuration()
+
+	// A run of the feed on another replica holds the lease
+	_, acquired, err := store.Locks.Acquire(context.Background(), feedRunLockPrefix+"lock-test", "other-replica", ttl)
+	assert.NoError(t, err)
+	assert.True(t, acquired)
+	_, _, err = lockFeedRun(context.Background(), store, "lock-test")
+	assert.Equal(t, errFeedRunning, err)
+	assert.True(t, startFeedRun("lock-test"), "the run guard of the process is given back")
+	finishFeedRun("lock-test")
+
+	assert.NoError(t, store.Locks.Release(context.Background(), feedRunLockPrefix+"lock-test", "other-replica"))
+	runCtx, finishRun, err := lockFeedRun(context.Background(), store, "lock-test")
+	assert.NoError(t, err)
+	assert.NoError(t, runCtx.Err())
+	_, acquired, err = store.Locks.Acquire(context.Background(), feedRunLockPrefix+"lock-test", "other-replica", ttl)
+	assert.NoError(t, err)
+	assert.False(t, acquired)
+
+	finishRun()
+	_, acquired, err = store.Locks.Acquire(context.Background(), feedRunLockPrefix+"lock-test", "other-replica", ttl)
+	assert.NoError(t, err)
+	assert.True(t, acquired)
+}
+
+func TestWaitForBackgroundRuns(t *testing.T) {
+	release := make(chan struct{})
+	startBackgroundRun(func() { <-release })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, WaitForBackgroundRuns(ctx), context.DeadlineExceeded)
+
+	close(release)
+	assert.NoError(t, WaitForBackgroundRuns(context.Background()))
+}
+
+func TestDiffArticles(t *testing.T) {
+	teaser := "Old teaser"
+	oldArticle := &Article{
+		Title:       "Test Article",
+		Teaser:      &teaser,
+		Content:     "<p>Old content</p>",
+		GalleryURLs: []string{"https://example.com/1.jpg"},
+	}
+	newArticle := &Article{
+		Title:       "Test Article",
+		Teaser:      &teaser,
+		Content:     "<p>New content</p>",
+		GalleryURLs: []string{"https://example.com/1.jpg", "https://example.com/2.jpg"},
+	}
+
+	diffs := diffArticles(oldArticle, newArticle)
+
+	// Only the content and the gallery changed
+	assert.Equal(t, 2, len(diffs))
+	assert.Equal(t, "content", diffs[0].Field)
+	assert.Equal(t, "<p>Old content</p>", diffs[0].Old)
+	assert.Equal(t, "<p>New content</p>", diffs[0].New)
+	assert.Equal(t, "galleryUrls", diffs[1].Field)
+	assert.Empty(t, diffArticles(oldArticle, oldArticle))
+}
+
+func TestFetchArticlesKeepsOrderAndConcurrencyLimit(t *testing.T) {
+	config.Conf.Ingestion.Concurrency, config.Conf.Ingestion.FetchTimeout = 2, 5
+
+	var inFlight, maxInFlight int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			seen := atomic.LoadInt32(&maxInFlight)
+			if current <= seen || atomic.CompareAndSwapInt32(&maxInFlight, seen, current) {
+				break
+			}
+		}
+
+		// Answer the first articles last so that the results arrive out of order
+		id := r.URL.Query().Get("id")
+		if id == "1" {
+			time.Sleep(50 * time.Millisecond)
+		}
+		fmt.Fprintf(w, `<NewsArticleInformation><NewsArticle><NewsArticleID>%s</NewsArticleID>`+
+			`<PublishDate>2023-07-01 10:00:00</PublishDate></NewsArticle></NewsArticleInformation>`, id)
+	}))
+	defer server.Close()
+
+	feed := config.Feed{ClubKey: "test", ArticleURL: server.URL + "?id={id}"}
+	results := fetchArticles(context.Background(), feed, []string{"1", "2", "3", "4"})
+
+	assert.Equal(t, 4, len(results))
+	for i, result := range results {
+		assert.NoError(t, result.Err)
+		assert.Equal(t, fmt.Sprint(i+1), result.Article.ArticleID)
+		assert.Equal(t, "test", result.Article.TeamID)
+	}
+	assert.LessOrEqual(t, atomic.LoadInt32(&maxInFlight), int32(2))
+
+	// A concurrency that was not defaulted still fetches the articles
+	config.Conf.Ingestion.Concurrency = 0
+	results = fetchArticles(context.Background(), feed, []string{"1", "2"})
+	assert.Equal(t, 2, len(results))
+	assert.NoError(t, results[1].Err)
+}
+
+func TestFailureBackoff(t *testing.T) {
+	assert.Equal(t, time.Minute, failureBackoff(1))
+	assert.Equal(t, 2*time.Minute, failureBackoff(2))
+	assert.Equal(t, 8*time.Minute, failureBackoff(4))
+	assert.Equal(t, failureMaxBackoff, failureBackoff(50))
+}
+
+func TestSplitListAndNormalizeTaxonomies(t *testing.T) {
+	assert.Equal(t, []string{"a.jpg", "b.jpg", "c.jpg"}, splitList(" a.jpg, b.jpg|c.jpg ,"))
+	assert.Empty(t, splitList(""))
+	assert.Equal(t, []string{"first-team", "Interviews"}, normalizeTaxonomies(splitList("First Team, first team | Interviews")))
+
+	article := &Article{Type: []string{"First Team,Academy"}, GalleryURLs: []string{""}}
+	assert.True(t, normalizeArticleLists(article))
+	assert.Equal(t, []string{"first-team", "academy"}, article.Type)
+	assert.Empty(t, article.GalleryURLs)
+	assert.False(t, normalizeArticleLists(article))
+}
+
+func TestRewriteLegacyTeamIDs(t *testing.T) {
+	feeds := config.Conf.Feeds
+	config.Conf.Feeds = []config.Feed{{ClubKey: "htafc", LegacyTeamIDs: []string{"Huddersfield Town"}}}
+	defer func() { config.Conf.Feeds = feeds }()
+	store := NewMemoryStorage()
+	_, _, err := store.Articles.Upsert(context.Background(), []Article{
+		{TeamID: "Huddersfield Town", ArticleID: "1", Title: "Legacy only"},
+		{TeamID: "Huddersfield Town", ArticleID: "2", Title: "Legacy copy"},
+		{TeamID: "htafc", ArticleID: "2", Title: "Club key copy"},
+		{TeamID: "Removed Club", ArticleID: "3", Title: "Unknown team"},
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, RewriteLegacyTeamIDs(context.Background(), store))
+	moved, err := store.Articles.List(context.Background(), ArticleFilter{TeamID: "htafc"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(moved))
+	legacy, err := store.Articles.List(context.Background(), ArticleFilter{TeamID: "Huddersfield Town"})
+	assert.NoError(t, err)
+	assert.Empty(t, legacy)
+	unknown, err := getUnknownTeamIDs(context.Background(), store)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Removed Club"}, unknown)
 }
@@ -0,0 +1,181 @@
+package articles
+
+import (
+	"context"
+	"fmt"
+	"github.com/SkaisgirisMarius/article-processor/config"
+	log "github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+// BackfillDateLayout is the layout of the date cutoff accepted by the backfill endpoint and command.
+const BackfillDateLayout = "2006-01-02"
+
+// backgroundRuns tracks the runs the handlers start in the background, so that the shutdown waits for them.
+// They run with the context given to InitializeArticleRetriever.
+var backgroundRuns = struct {
+	ctx context.Context
+	sync.WaitGroup
+}{ctx: context.Background()}
+
+// startBackgroundRun runs the function in the background as a tracked run.
+func startBackgroundRun(run func()) {
+	backgroundRuns.Add(1)
+	go func() {
+		defer backgroundRuns.Done()
+		run()
+	}()
+}
+
+// WaitForBackgroundRuns waits until the runs started in the background returned, or until the context is done.
+func WaitForBackgroundRuns(ctx context.Context) error {
+	finished := make(chan struct{})
+	go func() {
+		backgroundRuns.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// BackfillOptions configures a backfill of a feed's article archive.
+type BackfillOptions struct {
+	// PageSize is the number of articles per page, zero uses the page size configured for the feed.
+	PageSize int
+	// Since is the date cutoff, articles published before it are not backfilled. Zero backfills the whole archive.
+	Since time.Time
+	// Restart ignores an unfinished checkpoint and starts again from the first page.
+	Restart bool
+}
+
+// BackfillCheckpoint is the persisted progress of a feed's backfill, stored in the state of the feed.
+type BackfillCheckpoint struct {
+	NextPage      int       `bson:"nextPage" json:"nextPage"`
+	PageSize      int       `bson:"pageSize" json:"pageSize"`
+	Since         time.Time `bson:"since" json:"since"`
+	ArticlesAdded int       `bson:"articlesAdded" json:"articlesAdded"`
+	Done          bool      `bson:"done" json:"done"`
+	StartedAt     time.Time `bson:"startedAt" json:"startedAt"`
+	UpdatedAt     time.Time `bson:"updatedAt" json:"updatedAt"`
+}
+
+// RunBackfill pages through the full article archive of the feed with the given club key and stores the articles
+// that are missing from the database. The progress is checkpointed after every page, so an interrupted backfill
+// with the same page size and cutoff resumes where it stopped. The backfill holds the run lock of the feed, so it
+// returns errFeedRunning while another run of the feed is in progress, and the scheduled runs of the feed are
+// skipped until it finished.
+func RunBackfill(ctx context.Context, store *Storage, clubKey string, opts BackfillOptions) error {
+	feed, err := getBackfillFeed(clubKey)
+	if err != nil {
+		return err
+	}
+	runCtx, finishRun, err := lockFeedRun(ctx, store, clubKey)
+	if err != nil {
+		return err
+	}
+	defer finishRun()
+
+	return runBackfill(runCtx, store, feed, opts)
+}
+
+// getBackfillFeed returns the configured feed with the given club key, if it can be backfilled.
+func getBackfillFeed(clubKey string) (config.Feed, error) {
+	feed, found := config.Conf.FindFeed(clubKey)
+	if !found {
+		return feed, fmt.Errorf("feed %v is not configured", clubKey)
+	}
+	if feed.Backfill.URL == "" {
+		return feed, fmt.Errorf("feed %v has no backfill URL", clubKey)
+	}
+	return feed, nil
+}
+
+// runBackfill runs the backfill of a feed. The caller has to hold the run lock of the feed.
+func runBackfill(ctx context.Context, store *Storage, feed config.Feed, opts BackfillOptions) error {
+	if opts.PageSize <= 0 {
+		opts.PageSize = feed.Backfill.PageSize
+	}
+	source, err := newArticleSource(feed)
+	if err != nil {
+		return err
+	}
+	state, err := store.FeedStates.Get(ctx, feed.ClubKey)
+	if err != nil {
+		return err
+	}
+
+	checkpoint := state.Backfill
+	if opts.Restart || checkpoint == nil || checkpoint.Done || checkpoint.PageSize != opts.PageSize || !checkpoint.Since.Equal(opts.Since) {
+		checkpoint = &BackfillCheckpoint{NextPage: 1, PageSize: opts.PageSize, Since: opts.Since, StartedAt: time.Now().UTC()}
+		log.Printf("Starting backfill of %v with page size %v", feed.ClubKey, opts.PageSize)
+	} else {
+		log.Printf("Resuming backfill of %v from page %v", feed.ClubKey, checkpoint.NextPage)
+	}
+
+	var previousFirstID string
+	for !checkpoint.Done {
+		// Pause between pages to stay within the rate limits of the club's API
+		if checkpoint.NextPage > 1 {
+			select {
+			case <-time.After(feed.Backfill.DelayDuration()):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		listResult, err := source.ListArticles(ctx, ListRequest{Page: checkpoint.NextPage, PageSize: checkpoint.PageSize})
+		if err != nil {
+			log.Printf("Error getting page %v of %v: %v", checkpoint.NextPage, feed.ClubKey, err)
+			return err
+		}
+		pageArticles := listResult.Articles
+		recordFailedArticles(store, feed.ClubKey, listResult.Skipped)
+
+		// An empty page, or the same page again when the API ignores the paging, ends the archive
+		if len(pageArticles) == 0 || pageArticles[0].ArticleID == previousFirstID {
+			checkpoint.Done = true
+			checkpoint.UpdatedAt = time.Now().UTC()
+			saveBackfillCheckpoint(store, feed.ClubKey, checkpoint)
+			break
+		}
+		previousFirstID = pageArticles[0].ArticleID
+
+		var keptArticles []Article
+		for _, a := range pageArticles {
+			if opts.Since.IsZero() || !a.Published.Before(opts.Since) {
+				keptArticles = append(keptArticles, a)
+			}
+		}
+		if len(keptArticles) > 0 {
+			changedArticles, _, err := getNewAndUpdatedArticlesFromDatabase(ctx, store, feed, keptArticles)
+			if err != nil {
+				return err
+			}
+			if len(changedArticles) > 0 {
+				if _, _, err := insertArticlesToDatabaseInBatch(ctx, store, changedArticles); err != nil {
+					return err
+				}
+				checkpoint.ArticlesAdded += len(changedArticles)
+			}
+		}
+
+		// The archive ends with a short page or with the first page that crosses the date cutoff
+		checkpoint.Done = len(keptArticles) < len(pageArticles) || len(pageArticles) < checkpoint.PageSize
+		checkpoint.NextPage++
+		checkpoint.UpdatedAt = time.Now().UTC()
+		saveBackfillCheckpoint(store, feed.ClubKey, checkpoint)
+	}
+
+	log.Printf("Backfill of %v finished, %v articles added or updated", feed.ClubKey, checkpoint.ArticlesAdded)
+	return nil
+}
+
+// saveBackfillCheckpoint stores the progress of a feed's backfill.
+func saveBackfillCheckpoint(store *Storage, clubKey string, checkpoint *BackfillCheckpoint) {
+	store.FeedStates.SaveBackfill(context.Background(), clubKey, checkpoint)
+}
@@ -0,0 +1,346 @@
+package articles
+
+import (
+	"fmt"
+	"github.com/SkaisgirisMarius/article-processor/config"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Formats the content of an article can be requested in from the read endpoints.
+const (
+	contentFormatHTML     = "html"
+	contentFormatText     = "text"
+	contentFormatMarkdown = "markdown"
+)
+
+// droppedElements are removed from the content together with everything inside them, whatever the allowlist says.
+var droppedElements = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Iframe: true, atom.Frame: true, atom.Object: true, atom.Embed: true,
+	atom.Noscript: true, atom.Template: true, atom.Form: true, atom.Svg: true, atom.Math: true, atom.Head: true,
+}
+
+// blockElements start a new paragraph in the plain text and Markdown versions of the content.
+var blockElements = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Ul: true, atom.Ol: true, atom.Blockquote: true, atom.Figure: true, atom.Figcaption: true, atom.Pre: true,
+	atom.Table: true, atom.Tr: true, atom.Section: true, atom.Article: true, atom.Header: true, atom.Footer: true,
+}
+
+// urlAttributes are the attributes whose URL scheme has to be allowed by the sanitization policy.
+var urlAttributes = map[string]bool{"href": true, "src": true, "cite": true}
+
+var (
+	whitespaceRun    = regexp.MustCompile(`\s+`)
+	trailingSpaces   = regexp.MustCompile(`[ \t]+\n`)
+	blankLineRun     = regexp.MustCompile(`\n{3,}`)
+	markdownSpecials = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `_`, `\_`, "`", "\\`", `[`, `\[`, `]`, `\]`)
+)
+
+// sanitizePolicy is the allowlist the HTML content is sanitized against, built from the sanitization config.
+type sanitizePolicy struct {
+	elements   map[string]bool
+	attributes map[string]map[string]bool
+	schemes    map[string]bool
+}
+
+// newSanitizePolicy creates the sanitization policy of the given configuration.
+func newSanitizePolicy(conf config.Sanitization) sanitizePolicy {
+	policy := sanitizePolicy{
+		elements:   make(map[string]bool),
+		attributes: make(map[string]map[string]bool),
+		schemes:    make(map[string]bool),
+	}
+	for _, element := range conf.AllowedElements {
+		policy.elements[strings.ToLower(element)] = true
+	}
+	for element, attributes := range conf.AllowedAttributes {
+		allowed := make(map[string]bool)
+		for _, attribute := range attributes {
+			allowed[strings.ToLower(attribute)] = true
+		}
+		policy.attributes[strings.ToLower(element)] = allowed
+	}
+	for _, scheme := range conf.AllowedURLSchemes {
+		policy.schemes[strings.ToLower(scheme)] = true
+	}
+	return policy
+}
+
+// prepareArticleContent sanitizes the HTML content of an article against the configured allowlist, derives
+// its plain text and Markdown versions from the sanitized content and computes its reading metrics.
+func prepareArticleContent(article *Article) {
+	policy := newSanitizePolicy(config.Conf.Sanitization)
+	root, err := parseContent(article.Content)
+	if err != nil {
+		// The HTML parser recovers from any malformed markup, this only fails when reading the content fails
+		article.Content, article.ContentText, article.ContentMarkdown = "", "", ""
+		return
+	}
+	policy.sanitize(root)
+
+	var content strings.Builder
+	for child := root.FirstChild; child != nil; child = child.NextSibling {
+		html.Render(&content, child)
+	}
+	article.Content = content.String()
+	article.ContentText = htmlToText(root)
+	article.ContentMarkdown = htmlToMarkdown(root)
+	computeReadingMetrics(article)
+}
+
+// parseContent parses an HTML fragment into the children of a new body element.
+func parseContent(content string) (*html.Node, error) {
+	root := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(content), root)
+	if err != nil {
+		return nil, err
+	}
+	for _, node := range nodes {
+		root.AppendChild(node)
+	}
+	return root, nil
+}
+
+// sanitize removes everything the policy does not allow from the children of the node. Elements outside the
+// allowlist are replaced by their children so that their text is kept, comments, dropped elements and tracking
+// pixels are removed completely.
+func (p sanitizePolicy) sanitize(node *html.Node) {
+	for child := node.FirstChild; child != nil; {
+		next := child.NextSibling
+		switch child.Type {
+		case html.TextNode:
+		case html.ElementNode:
+			if droppedElements[child.DataAtom] || isTrackingPixel(child) {
+				node.RemoveChild(child)
+				break
+			}
+			p.sanitize(child)
+			if !p.elements[child.Data] {
+				for grandchild := child.FirstChild; grandchild != nil; grandchild = child.FirstChild {
+					child.RemoveChild(grandchild)
+					node.InsertBefore(grandchild, child)
+				}
+				node.RemoveChild(child)
+				break
+			}
+			child.Attr = p.allowedAttributes(child)
+			if child.DataAtom == atom.Img && attribute(child, "src") == "" {
+				node.RemoveChild(child)
+			}
+		default:
+			node.RemoveChild(child)
+		}
+		child = next
+	}
+}
+
+// allowedAttributes returns the attributes of the element that are allowed by the policy.
+// URL attributes are only kept when their scheme is allowed, relative URLs are always kept.
+func (p sanitizePolicy) allowedAttributes(element *html.Node) []html.Attribute {
+	var attributes []html.Attribute
+	for _, attr := range element.Attr {
+		key := strings.ToLower(attr.Key)
+		if attr.Namespace != "" || !p.attributes[element.Data][key] {
+			continue
+		}
+		if urlAttributes[key] {
+			link, err := url.Parse(strings.TrimSpace(attr.Val))
+			if err != nil || (link.Scheme != "" && !p.schemes[strings.ToLower(link.Scheme)]) {
+				continue
+			}
+		}
+		attributes = append(attributes, html.Attribute{Key: key, Val: attr.Val})
+	}
+	return attributes
+}
+
+// isTrackingPixel reports whether the element is an image of at most one pixel, as used by tracking pixels.
+func isTrackingPixel(element *html.Node) bool {
+	if element.DataAtom != atom.Img {
+		return false
+	}
+	width, widthErr := strconv.Atoi(strings.TrimSuffix(attribute(element, "width"), "px"))
+	height, heightErr := strconv.Atoi(strings.TrimSuffix(attribute(element, "height"), "px"))
+	return widthErr == nil && heightErr == nil && width <= 1 && height <= 1
+}
+
+// attribute returns the value of the attribute of the element with the given key.
+func attribute(element *html.Node, key string) string {
+	for _, attr := range element.Attr {
+		if strings.EqualFold(attr.Key, key) {
+			return strings.TrimSpace(attr.Val)
+		}
+	}
+	return ""
+}
+
+// htmlToText converts the children of the node into plain text, with paragraphs separated by a blank line.
+func htmlToText(node *html.Node) string {
+	var b strings.Builder
+	writeTextChildren(&b, node)
+	return tidyText(b.String())
+}
+
+func writeTextChildren(b *strings.Builder, node *html.Node) {
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		writeText(b, child)
+	}
+}
+
+func writeText(b *strings.Builder, node *html.Node) {
+	switch {
+	case node.Type == html.TextNode:
+		writeInline(b, node.Data)
+	case node.DataAtom == atom.Br:
+		b.WriteString("\n")
+	case node.DataAtom == atom.Li:
+		startLine(b)
+		writeTextChildren(b, node)
+		startLine(b)
+	case blockElements[node.DataAtom]:
+		b.WriteString("\n\n")
+		writeTextChildren(b, node)
+		b.WriteString("\n\n")
+	default:
+		writeTextChildren(b, node)
+	}
+}
+
+// htmlToMarkdown converts the children of the node into Markdown.
+func htmlToMarkdown(node *html.Node) string {
+	var b strings.Builder
+	writeMarkdownChildren(&b, node)
+	return tidyText(b.String())
+}
+
+func writeMarkdownChildren(b *strings.Builder, node *html.Node) {
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		writeMarkdown(b, child)
+	}
+}
+
+func writeMarkdown(b *strings.Builder, node *html.Node) {
+	if node.Type == html.TextNode {
+		writeInline(b, markdownSpecials.Replace(node.Data))
+		return
+	}
+
+	switch node.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		level := int(node.Data[1] - '0')
+		b.WriteString("\n\n" + strings.Repeat("#", level) + " ")
+		writeMarkdownChildren(b, node)
+		b.WriteString("\n\n")
+	case atom.Strong, atom.B:
+		writeMarkdownWrapped(b, node, "**")
+	case atom.Em, atom.I:
+		writeMarkdownWrapped(b, node, "_")
+	case atom.Br:
+		b.WriteString("\\\n")
+	case atom.A:
+		href := attribute(node, "href")
+		if href == "" {
+			writeMarkdownChildren(b, node)
+			return
+		}
+		b.WriteString("[")
+		writeMarkdownChildren(b, node)
+		b.WriteString("](" + href + ")")
+	case atom.Img:
+		b.WriteString(fmt.Sprintf("![%v](%v)", markdownSpecials.Replace(attribute(node, "alt")), attribute(node, "src")))
+	case atom.Ul, atom.Ol:
+		b.WriteString("\n\n")
+		index := 0
+		for item := node.FirstChild; item != nil; item = item.NextSibling {
+			if item.DataAtom != atom.Li {
+				continue
+			}
+			index++
+			marker := "- "
+			if node.DataAtom == atom.Ol {
+				marker = strconv.Itoa(index) + ". "
+			}
+			b.WriteString(prefixLines(htmlToMarkdown(item), marker, strings.Repeat(" ", len(marker))) + "\n")
+		}
+		b.WriteString("\n")
+	case atom.Blockquote:
+		b.WriteString("\n\n" + prefixLines(htmlToMarkdown(node), "> ", "> ") + "\n\n")
+	default:
+		if blockElements[node.DataAtom] {
+			b.WriteString("\n\n")
+			writeMarkdownChildren(b, node)
+			b.WriteString("\n\n")
+			return
+		}
+		writeMarkdownChildren(b, node)
+	}
+}
+
+// writeMarkdownWrapped writes the Markdown of the children of the node between the given delimiters.
+func writeMarkdownWrapped(b *strings.Builder, node *html.Node, delimiter string) {
+	var inner strings.Builder
+	writeMarkdownChildren(&inner, node)
+	text := strings.TrimSpace(inner.String())
+	if text == "" {
+		return
+	}
+	b.WriteString(delimiter + text + delimiter)
+}
+
+// writeInline writes text with its whitespace collapsed, without leading whitespace at the start of a line.
+func writeInline(b *strings.Builder, text string) {
+	text = whitespaceRun.ReplaceAllString(text, " ")
+	if b.Len() == 0 || strings.HasSuffix(b.String(), "\n") {
+		text = strings.TrimLeft(text, " ")
+	}
+	b.WriteString(text)
+}
+
+// startLine ends the current line unless the text is empty or already at the start of a line.
+func startLine(b *strings.Builder) {
+	if b.Len() > 0 && !strings.HasSuffix(b.String(), "\n") {
+		b.WriteString("\n")
+	}
+}
+
+// prefixLines prefixes the first line of the text with first and the other non-empty lines with rest.
+func prefixLines(text string, first string, rest string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		switch {
+		case i == 0:
+			lines[i] = first + line
+		case line != "":
+			lines[i] = rest + line
+		case strings.TrimSpace(rest) != "":
+			lines[i] = strings.TrimSpace(rest)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// tidyText removes trailing whitespace from every line and collapses runs of blank lines into one.
+func tidyText(text string) string {
+	text = trailingSpaces.ReplaceAllString(text, "\n")
+	text = blankLineRun.ReplaceAllString(text, "\n\n")
+	return strings.TrimSpace(text)
+}
+
+// applyContentFormat replaces the content of the article with its version in the given format. Articles stored
+// before the content was sanitized on ingestion are sanitized, converted and measured first.
+func (a *Article) applyContentFormat(format string) {
+	if a.Content != "" && a.ContentText == "" && a.ContentMarkdown == "" {
+		prepareArticleContent(a)
+	}
+	switch format {
+	case contentFormatText:
+		a.Content = a.ContentText
+	case contentFormatMarkdown:
+		a.Content = a.ContentMarkdown
+	}
+}
@@ -0,0 +1,66 @@
+package articles
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPrepareArticleContent(t *testing.T) {
+	article := &Article{Content: `<h2>Match report</h2>
+<p>Town <strong>won 3-1</strong> at <a href="https://club.example/stadium" onclick="track()">the stadium</a>.<br>Great night!</p>
+<script>trackPageView('report');</script>
+<iframe src="https://ads.example/frame"></iframe>
+<img src="https://pixel.example/p.gif" width="1" height="1">
+<div class="embed"><p>Goals from <em>Smith</em> and Jones_2.</p></div>
+<ul><li>Attendance: 21,000</li><li>Player of the match: <a href="javascript:alert(1)">Smith</a></li></ul>
+<blockquote><p>What a performance.</p></blockquote>
+<img src="https://club.example/goal.jpg" alt="The winning goal" style="border:0">`}
+
+	prepareArticleContent(article)
+
+	assert.Equal(t, `<h2>Match report</h2>
+<p>Town <strong>won 3-1</strong> at <a href="https://club.example/stadium">the stadium</a>.<br/>Great night!</p>
+
+
+
+<p>Goals from <em>Smith</em> and Jones_2.</p>
+<ul><li>Attendance: 21,000</li><li>Player of the match: <a>Smith</a></li></ul>
+<blockquote><p>What a performance.</p></blockquote>
+<img src="https://club.example/goal.jpg" alt="The winning goal"/>`, article.Content)
+
+	assert.Equal(t, `Match report
+
+Town won 3-1 at the stadium.
+Great night!
+
+Goals from Smith and Jones_2.
+
+Attendance: 21,000
+Player of the match: Smith
+
+What a performance.`, article.ContentText)
+
+	assert.Equal(t, `## Match report
+
+Town **won 3-1** at [the stadium](https://club.example/stadium).\
+Great night!
+
+Goals from _Smith_ and Jones\_2.
+
+- Attendance: 21,000
+- Player of the match: Smith
+
+> What a performance.
+
+![The winning goal](https://club.example/goal.jpg)`, article.ContentMarkdown)
+}
+
+func TestApplyContentFormat(t *testing.T) {
+	article := &Article{Content: `<p>Hello <b>world</b></p><script>alert(1)</script>`}
+	article.applyContentFormat(contentFormatMarkdown)
+	assert.Equal(t, "Hello **world**", article.Content)
+
+	article = &Article{Content: `<p>Hello <b>world</b></p>`, ContentText: "Hello world", ContentMarkdown: "Hello **world**"}
+	article.applyContentFormat(contentFormatText)
+	assert.Equal(t, "Hello world", article.Content)
+}
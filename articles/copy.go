@@ -0,0 +1,114 @@
+package articles
+
+import (
+	"context"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// copyRunsPageSize is the number of ingestion runs copied at once by CopyStorage.
+const copyRunsPageSize = 500
+
+// CopyStorage is a one-off migration that copies everything stored in one storage to another: the articles with
+// their revisions, the failed articles, the feed states and the ingestion runs. The IDs are kept, so the article
+// links stay valid. The copy is idempotent, so an interrupted copy is resumed by running it again: the articles,
+// failed articles, feed states and runs are upserted, and only the revisions the target does not have yet are added.
+func CopyStorage(ctx context.Context, from *Storage, to *Storage) error {
+	articles, err := from.Articles.List(ctx, ArticleFilter{IncludeWithdrawn: true})
+	if err != nil {
+		return err
+	}
+	revisionCount := 0
+	for _, article := range articles {
+		if _, _, err := to.Articles.Upsert(ctx, []Article{*article}); err != nil {
+			return err
+		}
+		// The target keeps the ID of an article it already had, its revisions are added to that article
+		stored, err := to.Articles.FindByArticleIDs(ctx, article.TeamID, []string{article.ArticleID})
+		if err != nil {
+			return err
+		}
+		if len(stored) == 0 {
+			return fmt.Errorf("article %v of %v was not stored in the target", article.ArticleID, article.TeamID)
+		}
+		copiedRevisions, err := copyArticleRevisions(ctx, from, to, article.ID, stored[0].ID)
+		if err != nil {
+			return err
+		}
+		revisionCount += copiedRevisions
+	}
+	log.Printf("Copied %v articles with %v new revisions", len(articles), revisionCount)
+
+	failures, err := from.Failures.List(ctx, "")
+	if err != nil {
+		return err
+	}
+	var copiedFailures []FailedArticle
+	for _, failure := range failures {
+		copiedFailures = append(copiedFailures, *failure)
+	}
+	if err := to.Failures.Save(ctx, copiedFailures); err != nil {
+		return err
+	}
+	log.Printf("Copied %v failed articles", len(failures))
+
+	states, err := from.FeedStates.List(ctx)
+	if err != nil {
+		return err
+	}
+	for _, state := range states {
+		if err := to.FeedStates.Save(ctx, state); err != nil {
+			return err
+		}
+	}
+	log.Printf("Copied %v feed states", len(states))
+
+	runCount := 0
+	for page := 1; ; page++ {
+		runs, total, err := from.Runs.List(ctx, "", page, copyRunsPageSize)
+		if err != nil {
+			return err
+		}
+		for _, run := range runs {
+			if err := to.Runs.Save(ctx, run); err != nil {
+				return err
+			}
+		}
+		runCount += len(runs)
+		if len(runs) == 0 || int64(runCount) >= total {
+			break
+		}
+	}
+	log.Printf("Copied %v ingestion runs", runCount)
+	return nil
+}
+
+// copyArticleRevisions adds the revisions of an article that are newer than the latest revision in the target and
+// returns how many were added. They are added oldest first, so they get the same numbers as in the source.
+func copyArticleRevisions(ctx context.Context, from *Storage, to *Storage, fromRef primitive.ObjectID, toRef primitive.ObjectID) (int, error) {
+	revisions, err := from.Revisions.List(ctx, fromRef)
+	if err != nil {
+		return 0, err
+	}
+	existing, err := to.Revisions.List(ctx, toRef)
+	if err != nil {
+		return 0, err
+	}
+	latest := 0
+	if len(existing) > 0 {
+		latest = existing[len(existing)-1].Revision
+	}
+	var copied []ArticleRevision
+	for _, revision := range revisions {
+		if revision.Revision <= latest {
+			continue
+		}
+		revision.ArticleRef = toRef
+		copied = append(copied, *revision)
+	}
+	if err := to.Revisions.Add(ctx, copied); err != nil {
+		return 0, err
+	}
+	return len(copied), nil
+}
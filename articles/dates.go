@@ -0,0 +1,50 @@
+package articles
+
+import (
+	"fmt"
+	"github.com/SkaisgirisMarius/article-processor/config"
+	"strings"
+	"time"
+)
+
+// defaultDateLayouts are the date layouts accepted from a feed that does not configure its own dateLayouts.
+var defaultDateLayouts = []string{externalDateLayout, time.RFC3339, time.RFC1123Z, time.RFC1123}
+
+// dateParser parses the dates of a feed. Dates without a zone offset are read in the feed's timezone,
+// and every parsed date is returned in UTC.
+type dateParser struct {
+	location *time.Location
+	layouts  []string
+}
+
+// newDateParser creates the dateParser of a feed. The feed's dateLayouts take precedence over the given
+// layouts of its source.
+func newDateParser(feed config.Feed, layouts []string) (dateParser, error) {
+	location, err := feed.Location()
+	if err != nil {
+		return dateParser{}, err
+	}
+	if len(feed.DateLayouts) > 0 {
+		layouts = feed.DateLayouts
+	}
+	return dateParser{location: location, layouts: layouts}, nil
+}
+
+// parse parses the date with the first matching layout.
+func (p dateParser) parse(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range p.layouts {
+		if date, err := time.ParseInLocation(layout, value, p.location); err == nil {
+			return date.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unsupported date format: %q", value)
+}
+
+// parseOptional parses the date like parse, but returns the zero time for an empty value.
+func (p dateParser) parseOptional(value string) (time.Time, error) {
+	if strings.TrimSpace(value) == "" {
+		return time.Time{}, nil
+	}
+	return p.parse(value)
+}
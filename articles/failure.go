@@ -0,0 +1,78 @@
+package articles
+
+import (
+	"context"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Backoff of the retries of failed article fetches. The delay doubles with every attempt up to the maximum.
+const (
+	failureBaseBackoff = time.Minute
+	failureMaxBackoff  = 6 * time.Hour
+)
+
+// FailedArticle is an article whose details could not be fetched. Later ingestion runs retry it once NextRetry has passed.
+type FailedArticle struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	TeamID      string             `bson:"teamId" json:"teamId"`
+	ArticleID   string             `bson:"articleID" json:"articleID"`
+	Error       string             `bson:"error" json:"error"`
+	Attempts    int                `bson:"attempts" json:"attempts"`
+	LastAttempt time.Time          `bson:"lastAttempt" json:"lastAttempt"`
+	NextRetry   time.Time          `bson:"nextRetry" json:"nextRetry"`
+}
+
+// failureBackoff returns how long to wait before retrying an article that failed the given number of times.
+func failureBackoff(attempts int) time.Duration {
+	backoff := failureBaseBackoff
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if backoff >= failureMaxBackoff {
+			return failureMaxBackoff
+		}
+	}
+	return backoff
+}
+
+// recordFailedArticles stores the failed fetches of a team as failed articles,
+// increasing the attempt count and pushing back the next retry of the articles that failed before.
+func recordFailedArticles(store *Storage, teamID string, failures []fetchResult) {
+	if len(failures) == 0 {
+		return
+	}
+	ctx := context.Background()
+	existingFailures, err := store.Failures.List(ctx, teamID)
+	if err != nil {
+		return
+	}
+	attempts := make(map[string]int)
+	for _, f := range existingFailures {
+		attempts[f.ArticleID] = f.Attempts
+	}
+
+	now := time.Now().UTC()
+	var failedArticles []FailedArticle
+	for _, failure := range failures {
+		attempt := attempts[failure.ArticleID] + 1
+		failedArticles = append(failedArticles, FailedArticle{
+			TeamID:      teamID,
+			ArticleID:   failure.ArticleID,
+			Error:       failure.Err.Error(),
+			Attempts:    attempt,
+			LastAttempt: now,
+			NextRetry:   now.Add(failureBackoff(attempt)),
+		})
+	}
+
+	if err := store.Failures.Save(ctx, failedArticles); err != nil {
+		return
+	}
+	log.Printf("Recorded %v failed article fetches of %v.", len(failures), teamID)
+}
+
+// clearFailedArticles removes the given articles of a team from the failed articles.
+func clearFailedArticles(store *Storage, teamID string, articleIDs []string) {
+	store.Failures.Delete(context.Background(), teamID, articleIDs)
+}
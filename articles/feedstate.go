@@ -0,0 +1,29 @@
+package articles
+
+import (
+	"context"
+	"time"
+)
+
+// FeedState is the persisted polling state of a feed. ETag and LastModified are the validators of the last
+// processed list response, SkippedPolls counts the polls that were answered with 304 Not Modified and
+// Backfill is the progress of the feed's last backfill.
+type FeedState struct {
+	ClubKey      string              `bson:"_id" json:"clubKey"`
+	ETag         string              `bson:"etag" json:"etag"`
+	LastModified string              `bson:"lastModified" json:"lastModified"`
+	SkippedPolls int64               `bson:"skippedPolls" json:"skippedPolls"`
+	LastPolled   time.Time           `bson:"lastPolled" json:"lastPolled"`
+	Backfill     *BackfillCheckpoint `bson:"backfill,omitempty" json:"backfill,omitempty"`
+	Paused       bool                `bson:"paused" json:"paused"`
+}
+
+// saveFeedValidators stores the ETag and Last-Modified values of the last processed list response of a feed.
+func saveFeedValidators(store *Storage, clubKey string, etag string, lastModified string) {
+	store.FeedStates.SaveValidators(context.Background(), clubKey, etag, lastModified, time.Now().UTC())
+}
+
+// incrementSkippedPolls counts a poll of the feed that was answered with 304 Not Modified.
+func incrementSkippedPolls(store *Storage, clubKey string) {
+	store.FeedStates.IncrementSkippedPolls(context.Background(), clubKey, time.Now().UTC())
+}
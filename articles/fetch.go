@@ -0,0 +1,123 @@
+package articles
+
+import (
+	"context"
+	"errors"
+	"github.com/SkaisgirisMarius/article-processor/config"
+	"github.com/SkaisgirisMarius/article-processor/leader"
+	"sync"
+)
+
+// feedRunLockPrefix prefixes the names of the leases that lock the runs of a feed across the replicas.
+const feedRunLockPrefix = "feed-run:"
+
+// errFeedRunning is returned when a run of the same feed is in progress, in this process or on another replica.
+var errFeedRunning = errors.New("a run of this feed is already in progress")
+
+// fetchResult is the outcome of fetching the details of a single article.
+type fetchResult struct {
+	ArticleID string
+	Article   *Article
+	Err       error
+}
+
+// feedRuns keeps track of the feeds that have an ingestion run in progress.
+var feedRuns = struct {
+	sync.Mutex
+	running map[string]bool
+}{running: make(map[string]bool)}
+
+// startFeedRun marks an ingestion run of the feed as started. It returns false when a run of the same feed
+// is still in progress, in which case the new run must not start.
+func startFeedRun(clubKey string) bool {
+	feedRuns.Lock()
+	defer feedRuns.Unlock()
+	if feedRuns.running[clubKey] {
+		return false
+	}
+	feedRuns.running[clubKey] = true
+	return true
+}
+
+// finishFeedRun marks the ingestion run of the feed as finished.
+func finishFeedRun(clubKey string) {
+	feedRuns.Lock()
+	defer feedRuns.Unlock()
+	delete(feedRuns.running, clubKey)
+}
+
+// lockFeedRun starts a run registered under the given key. It takes the run guard of the process and, when the
+// storage has a lock store, the lease of the key, so that no other run with the same key is in progress in this
+// process or on another replica. It returns errFeedRunning when there is one. The returned context is cancelled
+// when the lease is lost, and the returned function finishes the run.
+func lockFeedRun(ctx context.Context, store *Storage, key string) (context.Context, func(), error) {
+	if !startFeedRun(key) {
+		return nil, nil, errFeedRunning
+	}
+	if store.Locks == nil {
+		return ctx, func() { finishFeedRun(key) }, nil
+	}
+	lockCtx, unlock, err := leader.TryLock(ctx, store.Locks, feedRunLockPrefix+key, config.Conf.Leader.InstanceID, config.Conf.Leader.LeaseTTLDuration())
+	if err != nil {
+		finishFeedRun(key)
+		if errors.Is(err, leader.ErrLocked) {
+			return nil, nil, errFeedRunning
+		}
+		return nil, nil, err
+	}
+	return lockCtx, func() {
+		unlock()
+		finishFeedRun(key)
+	}, nil
+}
+
+// fetchArticles fetches the details of the given articles from the feed's ArticleSource through a pool of workers.
+// At most Ingestion.Concurrency requests run in parallel and each of them is bounded by Ingestion.FetchTimeout.
+// The results are returned in the same order as the given article IDs.
+func fetchArticles(ctx context.Context, feed config.Feed, articleIDs []string) []fetchResult {
+	results := make([]fetchResult, len(articleIDs))
+	source, err := newArticleSource(feed)
+	if err != nil {
+		for i := range articleIDs {
+			results[i] = fetchResult{ArticleID: articleIDs[i], Err: err}
+		}
+		return results
+	}
+
+	// Without a worker nothing would take the handed out work, a concurrency that was not defaulted fetches one by one
+	workers := config.Conf.Ingestion.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(articleIDs) {
+		workers = len(articleIDs)
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				fetchCtx, cancel := context.WithTimeout(ctx, config.Conf.Ingestion.FetchTimeoutDuration())
+				article, err := source.FetchArticle(fetchCtx, articleIDs[i])
+				cancel()
+				results[i] = fetchResult{ArticleID: articleIDs[i], Article: article, Err: err}
+			}
+		}()
+	}
+
+	// Hand out the work, the articles that were not handed out before the context was cancelled get its error
+	for i := range articleIDs {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			results[i] = fetchResult{ArticleID: articleIDs[i], Err: ctx.Err()}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
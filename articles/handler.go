@@ -1,52 +1,247 @@
 package articles
 
 import (
+	"github.com/SkaisgirisMarius/article-processor/auth"
+	"github.com/SkaisgirisMarius/article-processor/config"
 	"github.com/SkaisgirisMarius/article-processor/helper"
 	"github.com/go-chi/chi/v5"
 	"net/http"
+	"strconv"
 )
 
-// InitArticlesRouter initializes the articles router using the chi package, sets up two routes for handling article requests
-func InitArticlesRouter() http.Handler {
+// InitArticlesRouter initializes the articles router using the chi package, sets up the routes for handling article requests
+// served from the given storage
+func InitArticlesRouter(store *Storage) http.Handler {
 	r := chi.NewRouter()
-	r.Get("/{id}", getArticleByIDHandler)
-	r.Get("/list", getArticleListHandler)
+	r.Get("/{id}", getArticleByIDHandler(store))
+	r.Get("/{id}/revisions", getArticleRevisionsHandler(store))
+	r.Get("/{id}/revisions/{n}/diff", getArticleRevisionDiffHandler(store))
+	r.Get("/list", getArticleListHandler(store))
+	r.With(auth.RequireAPIKey).Post("/{id}/refresh", refreshArticleHandler(store))
 	return r
 }
 
 // getArticleByIDHandler is an HTTP handler function that handles requests to get a single article by its ID.
-func getArticleByIDHandler(w http.ResponseWriter, r *http.Request) {
-	articleID := chi.URLParam(r, "id")
-	if articleID == "" {
-		helper.SendJsonError(w, http.StatusBadRequest, "invalid request data articleID")
-		return
+func getArticleByIDHandler(store *Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		articleID := chi.URLParam(r, "id")
+		if articleID == "" {
+			helper.SendJsonError(w, http.StatusBadRequest, "invalid request data articleID")
+			return
+		}
+
+		format, valid := contentFormat(r)
+		if !valid {
+			helper.SendJsonError(w, http.StatusBadRequest, "invalid request data format")
+			return
+		}
+
+		article, err := getArticleByIDFromDatabase(r.Context(), store, articleID)
+		if err != nil {
+			helper.SendJsonError(w, http.StatusInternalServerError, "invalid request data articleID")
+			return
+		}
+		if article.isHidden() && !includeWithdrawn(r) {
+			helper.SendJsonError(w, http.StatusNotFound, "article not found")
+			return
+		}
+		article.applyContentFormat(format)
+		var response = SingleArticleResponse{
+			Status: statusSuccess,
+			Data:   article,
+		}
+		helper.SendJsonOk(w, response)
+
 	}
+}
 
-	article, err := getArticleByIDFromDatabase(articleID)
-	if err != nil {
-		helper.SendJsonError(w, http.StatusInternalServerError, "invalid request data articleID")
-		return
+// getArticleListHandler is an HTTP handler function that handles requests to get a list of articles.
+// It retrieves the articles from the storage and sends a JSON response containing the list of articles
+func getArticleListHandler(store *Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format, valid := contentFormat(r)
+		if !valid {
+			helper.SendJsonError(w, http.StatusBadRequest, "invalid request data format")
+			return
+		}
+
+		filter := ArticleFilter{IncludeWithdrawn: includeWithdrawn(r)}
+		if filter.MinReadingTime, valid = readingTimeParam(r, "minReadingTime"); !valid {
+			helper.SendJsonError(w, http.StatusBadRequest, "invalid request data minReadingTime")
+			return
+		}
+		if filter.MaxReadingTime, valid = readingTimeParam(r, "maxReadingTime"); !valid {
+			helper.SendJsonError(w, http.StatusBadRequest, "invalid request data maxReadingTime")
+			return
+		}
+
+		articles, err := store.Articles.List(r.Context(), filter)
+		if err != nil {
+			helper.SendJsonError(w, http.StatusInternalServerError, err)
+			return
+		}
+		for _, article := range articles {
+			article.applyContentFormat(format)
+		}
+		var response = MultipleArticlesResponse{
+			Status: statusSuccess,
+			Data:   articles,
+		}
+
+		helper.SendJson(w, http.StatusOK, response)
 	}
-	var response = SingleArticleResponse{
-		Status: statusSuccess,
-		Data:   article,
+}
+
+// getArticleRevisionsHandler is an HTTP handler function that handles requests to list the earlier versions of an article.
+// Like the article itself, the revisions of a hidden article are only returned with includeWithdrawn.
+func getArticleRevisionsHandler(store *Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		articleID := chi.URLParam(r, "id")
+		if articleID == "" {
+			helper.SendJsonError(w, http.StatusBadRequest, "invalid request data articleID")
+			return
+		}
+
+		if _, err := getVisibleArticle(r, store, articleID); err == ErrNotFound {
+			helper.SendJsonError(w, http.StatusNotFound, "article not found")
+			return
+		} else if err != nil {
+			helper.SendJsonError(w, http.StatusInternalServerError, "invalid request data articleID")
+			return
+		}
+
+		revisions, err := getArticleRevisionsFromDatabase(r.Context(), store, articleID)
+		if err != nil {
+			helper.SendJsonError(w, http.StatusInternalServerError, "invalid request data articleID")
+			return
+		}
+		var response = ArticleRevisionsResponse{
+			Status: statusSuccess,
+			Data:   revisions,
+		}
+		helper.SendJsonOk(w, response)
 	}
-	helper.SendJsonOk(w, response)
+}
+
+// getArticleRevisionDiffHandler is an HTTP handler function that handles requests to get the field-level diff
+// between a revision of an article and the version that replaced it. Revisions of hidden articles are only
+// compared with includeWithdrawn.
+func getArticleRevisionDiffHandler(store *Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		articleID := chi.URLParam(r, "id")
+		if articleID == "" {
+			helper.SendJsonError(w, http.StatusBadRequest, "invalid request data articleID")
+			return
+		}
+		revision, err := strconv.Atoi(chi.URLParam(r, "n"))
+		if err != nil || revision < 1 {
+			helper.SendJsonError(w, http.StatusBadRequest, "invalid request data revision")
+			return
+		}
 
+		if _, err := getVisibleArticle(r, store, articleID); err == ErrNotFound {
+			helper.SendJsonError(w, http.StatusNotFound, "article not found")
+			return
+		} else if err != nil {
+			helper.SendJsonError(w, http.StatusInternalServerError, "invalid request data articleID")
+			return
+		}
+
+		diff, err := getArticleRevisionDiff(r.Context(), store, articleID, revision)
+		if err == ErrNotFound {
+			helper.SendJsonError(w, http.StatusNotFound, "revision not found")
+			return
+		}
+		if err != nil {
+			helper.SendJsonError(w, http.StatusInternalServerError, "invalid request data articleID")
+			return
+		}
+		var response = RevisionDiffResponse{
+			Status: statusSuccess,
+			Data:   diff,
+		}
+		helper.SendJsonOk(w, response)
+	}
 }
 
-// getArticleListHandler is an HTTP handler function that handles requests to get a list of articles.
-// It retrieves the articles from the database using getArticleListFromDatabase and sends a JSON response containing the list of articles
-func getArticleListHandler(w http.ResponseWriter, r *http.Request) {
-	articles, err := getArticleListFromDatabase()
+// refreshArticleHandler is an HTTP handler function that handles requests to fetch a stored article again from
+// its feed and overwrite it. The summary of the refresh is returned.
+func refreshArticleHandler(store *Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		articleID := chi.URLParam(r, "id")
+		article, err := getArticleByIDFromDatabase(r.Context(), store, articleID)
+		if err == ErrNotFound {
+			helper.SendJsonError(w, http.StatusNotFound, "article not found")
+			return
+		}
+		if err != nil {
+			helper.SendJsonError(w, http.StatusInternalServerError, "invalid request data articleID")
+			return
+		}
+		feed, found := config.Conf.FindFeed(article.TeamID)
+		if !found {
+			helper.SendJsonError(w, http.StatusConflict, "the feed of the article is not configured")
+			return
+		}
+
+		extendWriteDeadline(w)
+		run, err := refreshArticle(r.Context(), store, feed, article)
+		if err == errFeedRunning {
+			helper.SendJsonError(w, http.StatusConflict, "ingestion of "+feed.ClubKey+" is already running")
+			return
+		}
+		if err != nil {
+			helper.SendJsonError(w, http.StatusInternalServerError, "could not lock the ingestion of "+feed.ClubKey)
+			return
+		}
+		var response = IngestionRunResponse{
+			Status: statusSuccess,
+			Data:   run,
+		}
+		helper.SendJsonOk(w, response)
+	}
+}
+
+// includeWithdrawn reports whether the admin query flag asking for withdrawn and unpublished articles is set.
+// The flag is ignored for requests without a valid API key, so hidden articles are never shown to the public.
+func includeWithdrawn(r *http.Request) bool {
+	include, _ := strconv.ParseBool(r.URL.Query().Get("includeWithdrawn"))
+	return include && auth.HasAPIKey(r)
+}
+
+// getVisibleArticle returns the article with the given ID when the request may see it. Hidden articles are only
+// visible with includeWithdrawn, otherwise ErrNotFound is returned for them as for a missing article.
+func getVisibleArticle(r *http.Request, store *Storage, id string) (*Article, error) {
+	article, err := getArticleByIDFromDatabase(r.Context(), store, id)
 	if err != nil {
-		helper.SendJsonError(w, http.StatusInternalServerError, err)
-		return
+		return nil, err
 	}
-	var response = MultipleArticlesResponse{
-		Status: statusSuccess,
-		Data:   articles,
+	if article.isHidden() && !includeWithdrawn(r) {
+		return nil, ErrNotFound
 	}
+	return article, nil
+}
 
-	helper.SendJson(w, http.StatusOK, response)
+// contentFormat returns the format the article content is requested in, html by default,
+// and whether it is a known format.
+func contentFormat(r *http.Request) (string, bool) {
+	switch format := r.URL.Query().Get("format"); format {
+	case "", contentFormatHTML:
+		return contentFormatHTML, true
+	case contentFormatText, contentFormatMarkdown:
+		return format, true
+	default:
+		return format, false
+	}
+}
+
+// readingTimeParam returns the reading time in minutes from the given query parameter, zero when it is not set,
+// and whether it is a valid non-negative number.
+func readingTimeParam(r *http.Request, name string) (int, bool) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return 0, true
+	}
+	minutes, err := strconv.Atoi(value)
+	return minutes, err == nil && minutes >= 0
 }
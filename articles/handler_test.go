@@ -0,0 +1,95 @@
+package articles
+
+import (
+	"context"
+	"fmt"
+	"github.com/SkaisgirisMarius/article-processor/auth"
+	"github.com/SkaisgirisMarius/article-processor/config"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRevisionHandlersHideWithdrawnArticles(t *testing.T) {
+	store := NewMemoryStorage()
+	published := time.Date(2023, 7, 1, 10, 0, 0, 0, time.UTC)
+	article := Article{TeamID: "test", ArticleID: "1", Title: "First", Published: published, State: statePublished}
+	_, _, err := insertArticlesToDatabaseInBatch(context.Background(), store, []Article{article})
+	assert.NoError(t, err)
+	article.Title = "First (edited)"
+	_, _, err = insertArticlesToDatabaseInBatch(context.Background(), store, []Article{article})
+	assert.NoError(t, err)
+	stored, err := store.Articles.FindByArticleIDs(context.Background(), "test", []string{"1"})
+	assert.NoError(t, err)
+	id := stored[0].ID.Hex()
+	router := InitArticlesRouter(store)
+
+	get := func(path, apiKey string) int {
+		request := httptest.NewRequest(http.MethodGet, path, nil)
+		if apiKey != "" {
+			request.Header.Set(auth.HeaderAPIKey, apiKey)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+	assert.Equal(t, http.StatusOK, get("/"+id+"/revisions", ""))
+	assert.Equal(t, http.StatusOK, get("/"+id+"/revisions/1/diff", ""))
+
+	// Once withdrawn the revisions are only served with includeWithdrawn and an API key
+	_, err = withdrawArticlesInDatabase(context.Background(), store, "test", []string{"1"})
+	assert.NoError(t, err)
+	for _, path := range []string{"/" + id + "/revisions", "/" + id + "/revisions/1/diff"} {
+		assert.Equal(t, http.StatusNotFound, get(path, ""), path)
+		assert.Equal(t, http.StatusNotFound, get(path+"?includeWithdrawn=true", ""), path)
+		assert.Equal(t, http.StatusOK, get(path+"?includeWithdrawn=true", "test-key"), path)
+	}
+	assert.Equal(t, http.StatusNotFound, get("/"+primitive.NewObjectID().Hex()+"/revisions", ""))
+}
+
+func TestTriggerIsRefusedDuringBackfill(t *testing.T) {
+	config.Conf.Ingestion.Concurrency, config.Conf.Ingestion.FetchTimeout = 2, 5
+	store := NewMemoryStorage()
+
+	// The first archive page is answered only after the trigger was refused
+	release := make(chan struct{})
+	requested := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case requested <- struct{}{}:
+		default:
+		}
+		<-release
+		fmt.Fprint(w, `<NewListInformation><NewsletterNewsItems></NewsletterNewsItems></NewListInformation>`)
+	}))
+	defer server.Close()
+	feed := config.Feed{
+		ClubKey:    "backfill-lock",
+		ListURL:    server.URL + "/list",
+		ArticleURL: server.URL + "/article?id={id}",
+		Backfill:   config.Backfill{URL: server.URL + "/archive?page={page}&pageSize={pageSize}", PageSize: 10},
+	}
+	feeds := config.Conf.Feeds
+	config.Conf.Feeds = append([]config.Feed{feed}, feeds...)
+	defer func() { config.Conf.Feeds = feeds }()
+	router := InitIngestionRouter(store)
+
+	post := func(path string) int {
+		request := httptest.NewRequest(http.MethodPost, path, nil)
+		request.Header.Set(auth.HeaderAPIKey, "test-key")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+	assert.Equal(t, http.StatusAccepted, post("/backfill?feed=backfill-lock"))
+	<-requested
+	assert.Equal(t, http.StatusConflict, post("/trigger?feed=backfill-lock"))
+	assert.Equal(t, http.StatusConflict, post("/backfill?feed=backfill-lock"))
+
+	close(release)
+	assert.NoError(t, WaitForBackgroundRuns(context.Background()))
+	assert.Equal(t, http.StatusOK, post("/trigger?feed=backfill-lock"))
+}
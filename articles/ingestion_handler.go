@@ -0,0 +1,263 @@
+package articles
+
+import (
+	"errors"
+	"github.com/SkaisgirisMarius/article-processor/auth"
+	"github.com/SkaisgirisMarius/article-processor/config"
+	"github.com/SkaisgirisMarius/article-processor/helper"
+	"github.com/SkaisgirisMarius/article-processor/scheduler"
+	"github.com/go-chi/chi/v5"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Page sizes of the ingestion run list.
+const (
+	defaultRunsPageSize = 20
+	maxRunsPageSize     = 100
+)
+
+// manualRunWriteTimeout is how long a manually started run may take before its summary is written.
+// The write timeout of the server is too short for a whole ingestion run.
+const manualRunWriteTimeout = 60 * time.Second
+
+// InitIngestionRouter initializes the ingestion router using the chi package, sets up the routes for inspecting and controlling the article ingestion
+// that stores into the given storage
+func InitIngestionRouter(store *Storage) http.Handler {
+	r := chi.NewRouter()
+	r.Get("/failures", getFailedArticlesHandler(store))
+	r.Get("/feeds", getFeedStatesHandler(store))
+	r.Get("/runs", getIngestionRunsHandler(store))
+	r.Get("/schedule", getFeedSchedulesHandler)
+	r.Get("/status", getIngestionStatusHandler(store))
+	r.With(auth.RequireAPIKey).Post("/backfill", startBackfillHandler(store))
+	r.With(auth.RequireAPIKey).Post("/trigger", triggerIngestionHandler(store))
+	r.With(auth.RequireAPIKey).Post("/feeds/{feed}/pause", pauseFeedHandler(store))
+	r.With(auth.RequireAPIKey).Post("/feeds/{feed}/resume", resumeFeedHandler(store))
+	return r
+}
+
+// getFailedArticlesHandler is an HTTP handler function that handles requests to list the articles whose details could not be fetched.
+// The optional feed query parameter limits the list to a single club.
+func getFailedArticlesHandler(store *Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		failures, err := store.Failures.List(r.Context(), r.URL.Query().Get("feed"))
+		if err != nil {
+			helper.SendJsonError(w, http.StatusInternalServerError, "could not get failed articles")
+			return
+		}
+		var response = FailedArticlesResponse{
+			Status: statusSuccess,
+			Data:   failures,
+		}
+		helper.SendJsonOk(w, response)
+	}
+}
+
+// getFeedStatesHandler is an HTTP handler function that handles requests to list the polling state of the feeds,
+// including how many polls were skipped because the article list was not modified.
+func getFeedStatesHandler(store *Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		states, err := store.FeedStates.List(r.Context())
+		if err != nil {
+			helper.SendJsonError(w, http.StatusInternalServerError, "could not get feed states")
+			return
+		}
+		var response = FeedStatesResponse{
+			Status: statusSuccess,
+			Data:   states,
+		}
+		helper.SendJsonOk(w, response)
+	}
+}
+
+// getIngestionRunsHandler is an HTTP handler function that handles requests to list the recorded ingestion runs, newest first.
+// The optional feed query parameter limits the list to a single club, page and pageSize select the page of the list.
+func getIngestionRunsHandler(store *Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		page, pageSize := 1, defaultRunsPageSize
+		var err error
+		if value := query.Get("page"); value != "" {
+			if page, err = strconv.Atoi(value); err != nil || page < 1 {
+				helper.SendJsonError(w, http.StatusBadRequest, "invalid request data page")
+				return
+			}
+		}
+		if value := query.Get("pageSize"); value != "" {
+			if pageSize, err = strconv.Atoi(value); err != nil || pageSize < 1 || pageSize > maxRunsPageSize {
+				helper.SendJsonError(w, http.StatusBadRequest, "invalid request data pageSize")
+				return
+			}
+		}
+
+		runs, total, err := store.Runs.List(r.Context(), query.Get("feed"), page, pageSize)
+		if err != nil {
+			helper.SendJsonError(w, http.StatusInternalServerError, "could not get ingestion runs")
+			return
+		}
+		var response = IngestionRunsResponse{
+			Status:   statusSuccess,
+			Data:     runs,
+			Page:     page,
+			PageSize: pageSize,
+			Total:    total,
+		}
+		helper.SendJsonOk(w, response)
+	}
+}
+
+// getIngestionStatusHandler is an HTTP handler function that handles requests to get the last successful
+// ingestion run of every configured feed.
+func getIngestionStatusHandler(store *Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		statuses, err := getIngestionStatusFromDatabase(r.Context(), store)
+		if err != nil {
+			helper.SendJsonError(w, http.StatusInternalServerError, "could not get ingestion status")
+			return
+		}
+		var response = IngestionStatusResponse{
+			Status: statusSuccess,
+			Data:   statuses,
+		}
+		helper.SendJsonOk(w, response)
+	}
+}
+
+// getFeedSchedulesHandler is an HTTP handler function that handles requests to list the schedules of the enabled feeds,
+// including their next run time and whether they are paused.
+func getFeedSchedulesHandler(w http.ResponseWriter, r *http.Request) {
+	schedules, err := getFeedSchedules()
+	if err != nil {
+		helper.SendJsonError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	var response = FeedSchedulesResponse{
+		Status: statusSuccess,
+		Data:   schedules,
+	}
+	helper.SendJsonOk(w, response)
+}
+
+// pauseFeedHandler is an HTTP handler function that handles requests to pause the schedule of a feed.
+// A run that is in progress is not interrupted, the feed stays paused across restarts until it is resumed.
+func pauseFeedHandler(store *Storage) http.HandlerFunc {
+	return setFeedPausedHandler(store, true)
+}
+
+// resumeFeedHandler is an HTTP handler function that handles requests to resume the schedule of a paused feed.
+func resumeFeedHandler(store *Storage) http.HandlerFunc {
+	return setFeedPausedHandler(store, false)
+}
+
+// setFeedPausedHandler returns a handler that pauses or resumes the feed of the request and responds with its schedule.
+func setFeedPausedHandler(store *Storage, paused bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		clubKey := chi.URLParam(r, "feed")
+		schedule, err := setFeedPaused(store, clubKey, paused)
+		if errors.Is(err, scheduler.ErrUnknownJob) {
+			helper.SendJsonError(w, http.StatusNotFound, "feed "+clubKey+" is not scheduled")
+			return
+		}
+		if err != nil {
+			helper.SendJsonError(w, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		var response = FeedScheduleResponse{
+			Status: statusSuccess,
+			Data:   schedule,
+		}
+		helper.SendJsonOk(w, response)
+	}
+}
+
+// triggerIngestionHandler is an HTTP handler function that handles requests to run the ingestion of a feed immediately.
+// The run is refused while another run of the feed is in progress, otherwise the summary of the finished run is returned.
+func triggerIngestionHandler(store *Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		clubKey := r.URL.Query().Get("feed")
+		feed, found := config.Conf.FindFeed(clubKey)
+		if !found {
+			helper.SendJsonError(w, http.StatusBadRequest, "unknown feed "+clubKey)
+			return
+		}
+		runCtx, finishRun, err := lockFeedRun(r.Context(), store, feed.ClubKey)
+		if err == errFeedRunning {
+			helper.SendJsonError(w, http.StatusConflict, "ingestion of "+feed.ClubKey+" is already running")
+			return
+		}
+		if err != nil {
+			helper.SendJsonError(w, http.StatusInternalServerError, "could not lock the ingestion of "+feed.ClubKey)
+			return
+		}
+		defer finishRun()
+
+		extendWriteDeadline(w)
+		run := runIngestion(runCtx, store, feed, runTriggerManual)
+		var response = IngestionRunResponse{
+			Status: statusSuccess,
+			Data:   run,
+		}
+		helper.SendJsonOk(w, response)
+	}
+}
+
+// extendWriteDeadline gives a handler that waits for a manually started run enough time to write its response.
+func extendWriteDeadline(w http.ResponseWriter) {
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(manualRunWriteTimeout)); err != nil {
+		log.Println("Could not extend the write deadline of the response:", err)
+	}
+}
+
+// startBackfillHandler is an HTTP handler function that handles requests to backfill the archive of a feed.
+// The backfill runs in the background until it finished or the service stops, its progress is shown in the state of the feed.
+// It is refused while another run of the feed is in progress, and the runs of the feed are refused while it runs.
+func startBackfillHandler(store *Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		feed, err := getBackfillFeed(query.Get("feed"))
+		if err != nil {
+			helper.SendJsonError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		var opts BackfillOptions
+		if pageSize := query.Get("pageSize"); pageSize != "" {
+			if opts.PageSize, err = strconv.Atoi(pageSize); err != nil || opts.PageSize <= 0 {
+				helper.SendJsonError(w, http.StatusBadRequest, "invalid request data pageSize")
+				return
+			}
+		}
+		if since := query.Get("since"); since != "" {
+			if opts.Since, err = time.Parse(BackfillDateLayout, since); err != nil {
+				helper.SendJsonError(w, http.StatusBadRequest, "invalid request data since, expected YYYY-MM-DD")
+				return
+			}
+		}
+		opts.Restart, _ = strconv.ParseBool(query.Get("restart"))
+
+		runCtx, finishRun, err := lockFeedRun(backgroundRuns.ctx, store, feed.ClubKey)
+		if err == errFeedRunning {
+			helper.SendJsonError(w, http.StatusConflict, "a run of "+feed.ClubKey+" is already in progress")
+			return
+		}
+		if err != nil {
+			helper.SendJsonError(w, http.StatusInternalServerError, "could not lock the backfill of "+feed.ClubKey)
+			return
+		}
+		startBackgroundRun(func() {
+			defer finishRun()
+			if err := runBackfill(runCtx, store, feed, opts); err != nil {
+				log.Printf("Backfill of %v failed: %v", feed.ClubKey, err)
+			}
+		})
+
+		var response = MessageResponse{
+			Status: statusSuccess,
+			Data:   "backfill of " + feed.ClubKey + " started",
+		}
+		helper.SendJson(w, http.StatusAccepted, response)
+	}
+}
@@ -0,0 +1,84 @@
+package articles
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// jsonPathStep is a single step of a JSONPath-style expression: an object key or an array index.
+type jsonPathStep struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// jsonPath is a parsed JSONPath-style expression. The supported subset is the root ($), dotted keys (.key),
+// bracketed keys (['key']) and array indexes ([0]), e.g. $.data.items[0]['image-url'].
+type jsonPath []jsonPathStep
+
+// parseJSONPath parses a JSONPath-style expression. The leading $ is optional, an empty path selects the root.
+func parseJSONPath(path string) (jsonPath, error) {
+	rest := strings.TrimPrefix(strings.TrimSpace(path), "$")
+	var steps jsonPath
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, "['") || strings.HasPrefix(rest, `["`):
+			quote := rest[1:2]
+			end := strings.Index(rest[2:], quote+"]")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated key in JSON path %q", path)
+			}
+			steps = append(steps, jsonPathStep{key: rest[2 : 2+end]})
+			rest = rest[2+end+2:]
+		case strings.HasPrefix(rest, "["):
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated index in JSON path %q", path)
+			}
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("invalid index in JSON path %q", path)
+			}
+			steps = append(steps, jsonPathStep{index: index, isIndex: true})
+			rest = rest[end+1:]
+		default:
+			rest = strings.TrimPrefix(rest, ".")
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("empty key in JSON path %q", path)
+			}
+			steps = append(steps, jsonPathStep{key: rest[:end]})
+			rest = rest[end:]
+		}
+	}
+	return steps, nil
+}
+
+// lookup returns the value the path selects in the decoded JSON document and whether it exists.
+func (p jsonPath) lookup(document interface{}) (interface{}, bool) {
+	current := document
+	for _, step := range p {
+		if step.isIndex {
+			array, isArray := current.([]interface{})
+			if !isArray || step.index >= len(array) {
+				return nil, false
+			}
+			current = array[step.index]
+			continue
+		}
+		object, isObject := current.(map[string]interface{})
+		if !isObject {
+			return nil, false
+		}
+		value, found := object[step.key]
+		if !found {
+			return nil, false
+		}
+		current = value
+	}
+	return current, true
+}
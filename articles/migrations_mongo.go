@@ -0,0 +1,314 @@
+package articles
+
+import (
+	"context"
+	"errors"
+	"github.com/SkaisgirisMarius/article-processor/config"
+	"github.com/SkaisgirisMarius/article-processor/db"
+	"github.com/SkaisgirisMarius/article-processor/migration"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// Names of the indexes created by the MongoDB migrations.
+const (
+	teamArticleIndex = "teamId_articleID_unique"
+	publishedIndex   = "published_desc"
+	runFeedIndex     = "feed_startedAt_desc"
+	runExpiryIndex   = "startedAt_ttl"
+	revisionIndex    = "articleRef_revision_unique"
+)
+
+// Codes of the MongoDB errors for a missing collection and a missing index.
+const (
+	mongoNamespaceNotFound = 26
+	mongoIndexNotFound     = 27
+)
+
+// MongoMigrations returns the migrations of the MongoDB collections.
+func MongoMigrations() []migration.Migration {
+	return []migration.Migration{
+		{
+			Version: 1,
+			Name:    "unique team and article ID index",
+			// Removes the duplicate copies of the articles before creating the index
+			Destructive: true,
+			Affected:    countDuplicateArticles,
+			Up: func(ctx context.Context) error {
+				if err := removeDuplicateArticles(ctx); err != nil {
+					return err
+				}
+				index := mongo.IndexModel{
+					Keys:    bson.D{{Key: "teamId", Value: 1}, {Key: "articleID", Value: 1}},
+					Options: options.Index().SetName(teamArticleIndex).SetUnique(true),
+				}
+				_, err := getArticlesCollection().Indexes().CreateOne(ctx, index)
+				return err
+			},
+			Down: func(ctx context.Context) error {
+				return dropIndex(ctx, getArticlesCollection(), teamArticleIndex)
+			},
+		},
+		{
+			Version: 2,
+			Name:    "descending published index",
+			Up: func(ctx context.Context) error {
+				index := mongo.IndexModel{
+					Keys:    bson.D{{Key: "published", Value: -1}},
+					Options: options.Index().SetName(publishedIndex),
+				}
+				_, err := getArticlesCollection().Indexes().CreateOne(ctx, index)
+				return err
+			},
+			Down: func(ctx context.Context) error {
+				return dropIndex(ctx, getArticlesCollection(), publishedIndex)
+			},
+		},
+		{
+			Version: 3,
+			Name:    "ingestion run feed and expiry indexes",
+			// The TTL index removes the runs started longer than the run retention ago
+			Destructive: true,
+			Affected:    countExpiredRuns,
+			Up: func(ctx context.Context) error {
+				retention := int32(config.Conf.Ingestion.RunRetentionDuration().Seconds())
+				indexes := []mongo.IndexModel{
+					{
+						Keys:    bson.D{{Key: "feed", Value: 1}, {Key: "startedAt", Value: -1}},
+						Options: options.Index().SetName(runFeedIndex),
+					},
+					{
+						Keys:    bson.D{{Key: "startedAt", Value: 1}},
+						Options: options.Index().SetName(runExpiryIndex).SetExpireAfterSeconds(retention),
+					},
+				}
+				_, err := getIngestionRunsCollection().Indexes().CreateMany(ctx, indexes)
+				return err
+			},
+			Down: func(ctx context.Context) error {
+				if err := dropIndex(ctx, getIngestionRunsCollection(), runExpiryIndex); err != nil {
+					return err
+				}
+				return dropIndex(ctx, getIngestionRunsCollection(), runFeedIndex)
+			},
+		},
+		{
+			Version: 4,
+			Name:    "unique article revision index",
+			// Numbers the revisions of the articles that got the same number twice again before creating the index
+			Destructive: true,
+			Affected:    countDuplicateRevisions,
+			Up: func(ctx context.Context) error {
+				if err := renumberDuplicateRevisions(ctx); err != nil {
+					return err
+				}
+				index := mongo.IndexModel{
+					Keys:    bson.D{{Key: "articleRef", Value: 1}, {Key: "revision", Value: 1}},
+					Options: options.Index().SetName(revisionIndex).SetUnique(true),
+				}
+				_, err := getRevisionsCollection().Indexes().CreateOne(ctx, index)
+				return err
+			},
+			Down: func(ctx context.Context) error {
+				return dropIndex(ctx, getRevisionsCollection(), revisionIndex)
+			},
+		},
+	}
+}
+
+// countExpiredRuns returns how many ingestion runs started longer than the run retention ago.
+func countExpiredRuns(ctx context.Context) (int, error) {
+	expiry := time.Now().Add(-config.Conf.Ingestion.RunRetentionDuration())
+	count, err := getIngestionRunsCollection().CountDocuments(ctx, bson.M{"startedAt": bson.M{"$lt": expiry}})
+	return int(count), err
+}
+
+// findDuplicateArticles returns the IDs of the articles stored more than once for the same team and upstream ID,
+// grouped by team and upstream ID and ordered from the most recently updated copy to the least recently updated one.
+func findDuplicateArticles(ctx context.Context) ([][]primitive.ObjectID, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$sort", Value: bson.D{{Key: "lastUpdated", Value: -1}, {Key: "_id", Value: -1}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   bson.M{"teamId": "$teamId", "articleID": "$articleID"},
+			"ids":   bson.M{"$push": "$_id"},
+			"count": bson.M{"$sum": 1},
+		}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+	}
+	cur, err := getArticlesCollection().Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return nil, err
+	}
+	var duplicates []struct {
+		IDs []primitive.ObjectID `bson:"ids"`
+	}
+	if err := cur.All(ctx, &duplicates); err != nil {
+		return nil, err
+	}
+	groups := make([][]primitive.ObjectID, 0, len(duplicates))
+	for _, duplicate := range duplicates {
+		groups = append(groups, duplicate.IDs)
+	}
+	return groups, nil
+}
+
+// countDuplicateArticles returns how many copies removeDuplicateArticles would remove.
+func countDuplicateArticles(ctx context.Context) (int, error) {
+	groups, err := findDuplicateArticles(ctx)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, ids := range groups {
+		count += len(ids) - 1
+	}
+	return count, nil
+}
+
+// removeDuplicateArticles removes the articles stored more than once for the same team and upstream ID, which
+// would fail the unique index. The most recently updated copy is kept, the revisions of the removed copies are
+// removed as well and their IDs are logged.
+func removeDuplicateArticles(ctx context.Context) error {
+	groups, err := findDuplicateArticles(ctx)
+	if err != nil {
+		return err
+	}
+	var removed []primitive.ObjectID
+	for _, ids := range groups {
+		removed = append(removed, ids[1:]...)
+	}
+	if len(removed) == 0 {
+		return nil
+	}
+
+	if _, err := getArticlesCollection().DeleteMany(ctx, bson.M{"_id": bson.M{"$in": removed}}); err != nil {
+		return err
+	}
+	if _, err := getRevisionsCollection().DeleteMany(ctx, bson.M{"articleRef": bson.M{"$in": removed}}); err != nil {
+		return err
+	}
+	log.Printf("Removed %v duplicate copies of %v articles: %v", len(removed), len(groups), removed)
+	return nil
+}
+
+// SyncRunRetention updates the TTL index of the ingestion runs when the configured run retention differs from the
+// one the index was created or last updated with. It does nothing before the index was created by the migrations.
+func SyncRunRetention(ctx context.Context) error {
+	ctx, cancel := db.WithTimeout(ctx)
+	defer cancel()
+	cur, err := getIngestionRunsCollection().Indexes().List(ctx)
+	if err != nil {
+		return err
+	}
+	var indexes []struct {
+		Name               string `bson:"name"`
+		ExpireAfterSeconds int64  `bson:"expireAfterSeconds"`
+	}
+	if err := cur.All(ctx, &indexes); err != nil {
+		return err
+	}
+
+	retention := int64(config.Conf.Ingestion.RunRetentionDuration().Seconds())
+	for _, index := range indexes {
+		if index.Name != runExpiryIndex || index.ExpireAfterSeconds == retention {
+			continue
+		}
+		command := bson.D{
+			{Key: "collMod", Value: ingestionRunsCollection},
+			{Key: "index", Value: bson.D{{Key: "name", Value: runExpiryIndex}, {Key: "expireAfterSeconds", Value: retention}}},
+		}
+		if err := getIngestionRunsCollection().Database().RunCommand(ctx, command).Err(); err != nil {
+			return err
+		}
+		log.Printf("Changed the retention of the ingestion runs from %v to %v seconds", index.ExpireAfterSeconds, retention)
+	}
+	return nil
+}
+
+// findDuplicateRevisions returns the articles that have more than one revision with the same number, with the
+// number of revisions that share the number of another one.
+func findDuplicateRevisions(ctx context.Context) (map[primitive.ObjectID]int, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{
+			"_id":   bson.M{"articleRef": "$articleRef", "revision": "$revision"},
+			"count": bson.M{"$sum": 1},
+		}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+	}
+	cur, err := getRevisionsCollection().Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return nil, err
+	}
+	var duplicates []struct {
+		ID struct {
+			ArticleRef primitive.ObjectID `bson:"articleRef"`
+		} `bson:"_id"`
+		Count int `bson:"count"`
+	}
+	if err := cur.All(ctx, &duplicates); err != nil {
+		return nil, err
+	}
+	articles := make(map[primitive.ObjectID]int)
+	for _, duplicate := range duplicates {
+		articles[duplicate.ID.ArticleRef] += duplicate.Count - 1
+	}
+	return articles, nil
+}
+
+// countDuplicateRevisions returns how many revisions share their number with another revision of their article.
+func countDuplicateRevisions(ctx context.Context) (int, error) {
+	articles, err := findDuplicateRevisions(ctx)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, duplicates := range articles {
+		count += duplicates
+	}
+	return count, nil
+}
+
+// renumberDuplicateRevisions numbers the revisions of the articles with duplicate revision numbers again from 1 in
+// the order they were created, which would fail the unique index otherwise. The renumbered articles are logged.
+func renumberDuplicateRevisions(ctx context.Context) error {
+	articles, err := findDuplicateRevisions(ctx)
+	if err != nil {
+		return err
+	}
+	var renumbered []primitive.ObjectID
+	for articleRef := range articles {
+		opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}).SetProjection(bson.M{"_id": 1})
+		cur, err := getRevisionsCollection().Find(ctx, bson.M{"articleRef": articleRef}, opts)
+		if err != nil {
+			return err
+		}
+		var revisions []ArticleRevision
+		if err := cur.All(ctx, &revisions); err != nil {
+			return err
+		}
+		for i, revision := range revisions {
+			if _, err := getRevisionsCollection().UpdateByID(ctx, revision.ID, bson.M{"$set": bson.M{"revision": i + 1}}); err != nil {
+				return err
+			}
+		}
+		renumbered = append(renumbered, articleRef)
+	}
+	if len(renumbered) > 0 {
+		log.Printf("Renumbered the revisions of %v articles with duplicate revision numbers: %v", len(renumbered), renumbered)
+	}
+	return nil
+}
+
+// dropIndex drops the index with the given name, an index or collection that does not exist is not an error.
+func dropIndex(ctx context.Context, collection *mongo.Collection, name string) error {
+	_, err := collection.Indexes().DropOne(ctx, name)
+	var commandErr mongo.CommandError
+	if errors.As(err, &commandErr) && (commandErr.Code == mongoNamespaceNotFound || commandErr.Code == mongoIndexNotFound) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,53 @@
+package articles
+
+import (
+	"context"
+	"database/sql"
+	"github.com/SkaisgirisMarius/article-processor/migration"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PostgresMigrations returns the migrations of the PostgreSQL tables. The tables themselves, with their unique
+// constraints, are created by NewPostgresStorage.
+func PostgresMigrations(pool *pgxpool.Pool) []migration.Migration {
+	return sqlMigrations(func(ctx context.Context, query string) error {
+		_, err := pool.Exec(ctx, query)
+		return err
+	})
+}
+
+// SQLiteMigrations returns the migrations of the SQLite tables. The tables themselves, with their unique
+// constraints, are created by NewSQLiteStorage.
+func SQLiteMigrations(database *sql.DB) []migration.Migration {
+	return sqlMigrations(func(ctx context.Context, query string) error {
+		_, err := database.ExecContext(ctx, query)
+		return err
+	})
+}
+
+// sqlMigrations returns the migrations shared by the PostgreSQL and SQLite backends, which run their statements
+// with the given function. Their versions are independent of the versions of the MongoDB migrations.
+func sqlMigrations(exec func(ctx context.Context, query string) error) []migration.Migration {
+	return []migration.Migration{
+		{
+			Version: 1,
+			Name:    "descending published index",
+			Up: func(ctx context.Context) error {
+				return exec(ctx, "CREATE INDEX IF NOT EXISTS articles_published_idx ON articles (published DESC)")
+			},
+			Down: func(ctx context.Context) error {
+				return exec(ctx, "DROP INDEX IF EXISTS articles_published_idx")
+			},
+		},
+		{
+			Version: 2,
+			Name:    "ingestion run feed index",
+			Up: func(ctx context.Context) error {
+				return exec(ctx, "CREATE INDEX IF NOT EXISTS ingestion_runs_feed_started_at_idx ON ingestion_runs (feed, started_at DESC)")
+			},
+			Down: func(ctx context.Context) error {
+				return exec(ctx, "DROP INDEX IF EXISTS ingestion_runs_feed_started_at_idx")
+			},
+		},
+	}
+}
@@ -0,0 +1,85 @@
+package articles
+
+import (
+	"context"
+	"github.com/SkaisgirisMarius/article-processor/config"
+	log "github.com/sirupsen/logrus"
+	"reflect"
+	"strings"
+)
+
+// splitList splits a delimited upstream value on any of the configured list delimiters
+// and returns the trimmed, non-empty values.
+func splitList(value string) []string {
+	delimiters := config.Conf.Normalization.ListDelimiters
+	parts := strings.FieldsFunc(value, func(r rune) bool {
+		return strings.ContainsRune(delimiters, r)
+	})
+	return trimmedValues(parts)
+}
+
+// splitLists splits every value of a list with splitList.
+func splitLists(values []string) []string {
+	var result []string
+	for _, value := range values {
+		result = append(result, splitList(value)...)
+	}
+	return result
+}
+
+// normalizeTaxonomies maps the given taxonomies through the configured alias map, matching them
+// case-insensitively, and drops empty and duplicate values. Taxonomies without an alias are kept as they are.
+func normalizeTaxonomies(values []string) []string {
+	aliases := make(map[string]string)
+	for taxonomy, alias := range config.Conf.Normalization.TaxonomyAliases {
+		aliases[strings.ToLower(strings.TrimSpace(taxonomy))] = alias
+	}
+
+	var result []string
+	seen := make(map[string]bool)
+	for _, value := range trimmedValues(values) {
+		if alias, found := aliases[strings.ToLower(value)]; found {
+			value = alias
+		}
+		if !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// normalizeArticleLists splits the taxonomies and gallery image URLs of a stored article and normalizes its taxonomies.
+// It reports whether the article changed.
+func normalizeArticleLists(article *Article) bool {
+	types := normalizeTaxonomies(splitLists(article.Type))
+	galleryURLs := splitLists(article.GalleryURLs)
+	if reflect.DeepEqual(types, article.Type) && reflect.DeepEqual(galleryURLs, article.GalleryURLs) {
+		return false
+	}
+	article.Type = types
+	article.GalleryURLs = galleryURLs
+	return true
+}
+
+// NormalizeStoredArticles is a one-off migration that applies the list normalization to the articles stored before it
+// was introduced: it splits their taxonomies and gallery image URLs and normalizes their taxonomies.
+func NormalizeStoredArticles(ctx context.Context, store *Storage) error {
+	storedArticles, err := store.Articles.List(ctx, ArticleFilter{IncludeWithdrawn: true})
+	if err != nil {
+		return err
+	}
+
+	var changedArticles []Article
+	for _, article := range storedArticles {
+		if normalizeArticleLists(article) {
+			changedArticles = append(changedArticles, *article)
+		}
+	}
+	if _, _, err := store.Articles.Upsert(ctx, changedArticles); err != nil {
+		log.Error("could not normalize the stored articles, error: ", err)
+		return err
+	}
+	log.Printf("Normalized %v of %v stored articles", len(changedArticles), len(storedArticles))
+	return nil
+}
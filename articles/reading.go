@@ -0,0 +1,85 @@
+package articles
+
+import (
+	"github.com/SkaisgirisMarius/article-processor/config"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// excerptEllipsis ends an excerpt that had to be cut inside its first sentence.
+const excerptEllipsis = "…"
+
+// computeReadingMetrics computes the word count, the estimated reading time (in minutes) and the excerpt
+// of an article from the plain text version of its content.
+func computeReadingMetrics(article *Article) {
+	reading := config.Conf.Reading
+	words := strings.Fields(article.ContentText)
+	article.WordCount = len(words)
+	article.ReadingTime = 0
+	if article.WordCount > 0 && reading.WordsPerMinute > 0 {
+		article.ReadingTime = (article.WordCount + reading.WordsPerMinute - 1) / reading.WordsPerMinute
+	}
+	article.Excerpt = excerpt(strings.Join(words, " "), reading.ExcerptLength)
+}
+
+// excerpt returns the leading sentences of the text that fit into maxLength characters. When the first sentence
+// alone is too long it is cut on the last word boundary that fits and ends with an ellipsis. A maxLength that
+// leaves no room next to the ellipsis cuts the text without one, and no excerpt is returned for a maxLength of zero.
+func excerpt(text string, maxLength int) string {
+	if maxLength <= 0 {
+		return ""
+	}
+	if utf8.RuneCountInString(text) <= maxLength {
+		return text
+	}
+
+	var result string
+	for _, sentence := range splitSentences(text) {
+		candidate := strings.TrimSpace(result + " " + sentence)
+		if utf8.RuneCountInString(candidate) > maxLength {
+			break
+		}
+		result = candidate
+	}
+	if result != "" {
+		return result
+	}
+
+	runes := []rune(text)
+	if maxLength <= utf8.RuneCountInString(excerptEllipsis) {
+		return string(runes[:maxLength])
+	}
+	cut := string(runes[:maxLength-utf8.RuneCountInString(excerptEllipsis)])
+	if lastSpace := strings.LastIndex(cut, " "); lastSpace > 0 {
+		cut = cut[:lastSpace]
+	}
+	return strings.TrimRightFunc(cut, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsPunct(r) }) + excerptEllipsis
+}
+
+// splitSentences splits the text after every '.', '!' or '?' (and any closing quotes or brackets) that is
+// followed by a space.
+func splitSentences(text string) []string {
+	var sentences []string
+	runes := []rune(text)
+	start := 0
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '.' && runes[i] != '!' && runes[i] != '?' {
+			continue
+		}
+		end := i + 1
+		for end < len(runes) && strings.ContainsRune(`"'”’)]`, runes[end]) {
+			end++
+		}
+		if end < len(runes) && runes[end] != ' ' {
+			continue
+		}
+		sentences = append(sentences, strings.TrimSpace(string(runes[start:end])))
+		start = end
+		i = end - 1
+	}
+	if rest := strings.TrimSpace(string(runes[start:])); rest != "" {
+		sentences = append(sentences, rest)
+	}
+	return sentences
+}
@@ -0,0 +1,32 @@
+package articles
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestComputeReadingMetrics(t *testing.T) {
+	article := &Article{Content: "<p>" + strings.Repeat("word ", 450) + "</p>"}
+	prepareArticleContent(article)
+	assert.Equal(t, 450, article.WordCount)
+	assert.Equal(t, 3, article.ReadingTime)
+
+	article = &Article{}
+	prepareArticleContent(article)
+	assert.Equal(t, 0, article.WordCount)
+	assert.Equal(t, 0, article.ReadingTime)
+	assert.Equal(t, "", article.Excerpt)
+}
+
+func TestExcerptCutsOnSentenceBoundary(t *testing.T) {
+	text := "Town won 3-1 at the stadium. Smith scored twice! Was it the best game of the season? Fans think so."
+	assert.Equal(t, text, excerpt(text, 200))
+	assert.Equal(t, "Town won 3-1 at the stadium. Smith scored twice!", excerpt(text, 60))
+	assert.Equal(t, "Town won 3-1 at the stadium.", excerpt(text, 30))
+	assert.Equal(t, "Town won 3-1…", excerpt(text, 16))
+	assert.Equal(t, `He said "we were brilliant." Then he left.`, excerpt(`He said "we were brilliant." Then he left. And that was it.`, 45))
+	assert.Equal(t, "Scores of 3.5 and 2.1 were given.", excerpt("Scores of 3.5 and 2.1 were given. The rest was poor.", 40))
+	assert.Equal(t, "T", excerpt(text, 1))
+	assert.Empty(t, excerpt(text, 0))
+}
@@ -0,0 +1,112 @@
+package articles
+
+import (
+	"context"
+	"errors"
+	"github.com/SkaisgirisMarius/article-processor/leader"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// ErrNotFound is returned by the repositories when the requested record does not exist.
+var ErrNotFound = errors.New("not found")
+
+// Storage bundles the repositories the articles and the ingestion state are persisted through. The handlers and
+// the ingestion get it injected, so the service runs on any backend that implements the repositories.
+// Locks keeps the leases that stop replicas sharing the database from running the same feed at once, without it
+// the runs of a feed are only kept apart within the process.
+type Storage struct {
+	Articles   ArticleRepository
+	Revisions  RevisionRepository
+	Failures   FailureRepository
+	FeedStates FeedStateRepository
+	Runs       RunRepository
+	Locks      leader.Store
+}
+
+// ArticleFilter selects the articles returned by ArticleRepository.List. The zero value selects all published articles.
+// TeamID limits the articles to a single club, ExcludeArticleIDs leaves out the articles with the given upstream IDs
+// and PublishedSince the articles published before it. IncludeWithdrawn also selects unpublished and withdrawn
+// articles, MinReadingTime and MaxReadingTime bound the reading time in minutes, zero leaves the bound open.
+type ArticleFilter struct {
+	TeamID            string
+	ExcludeArticleIDs []string
+	PublishedSince    time.Time
+	IncludeWithdrawn  bool
+	MinReadingTime    int
+	MaxReadingTime    int
+}
+
+// ArticleRepository persists the articles. Articles are identified by their ID, and by their TeamID together
+// with the upstream ArticleID.
+type ArticleRepository interface {
+	// FindByID returns the article with the given ID, or ErrNotFound.
+	FindByID(ctx context.Context, id primitive.ObjectID) (*Article, error)
+	// FindByArticleIDs returns the stored articles of a team with the given upstream IDs.
+	FindByArticleIDs(ctx context.Context, teamID string, articleIDs []string) ([]Article, error)
+	// List returns the articles matching the filter.
+	List(ctx context.Context, filter ArticleFilter) ([]*Article, error)
+	// Upsert inserts the articles, or overwrites the stored articles with the same team and upstream ID.
+	// A new article keeps its ID when it has one and gets a new ID otherwise, a stored article keeps its ID.
+	// It returns how many articles were added and how many existing articles were changed.
+	Upsert(ctx context.Context, articles []Article) (int, int, error)
+	// SetState sets the publication state of the articles of a team with the given upstream IDs
+	// and returns how many articles were changed.
+	SetState(ctx context.Context, teamID string, articleIDs []string, state string) (int, error)
+	// Delete removes the articles of a team with the given upstream IDs and returns how many were removed.
+	Delete(ctx context.Context, teamID string, articleIDs []string) (int, error)
+	// MoveTeam moves the articles of a team to another team. An article stored under both teams keeps the copy of
+	// the other team and the copy of the moved team is removed. It returns how many articles were moved and removed.
+	MoveTeam(ctx context.Context, fromTeamID string, toTeamID string) (int, int, error)
+}
+
+// RevisionRepository persists the earlier versions of the articles.
+type RevisionRepository interface {
+	// Add stores the revisions, numbering each after the latest stored revision of its article.
+	// Revisions without an ID get a new one.
+	Add(ctx context.Context, revisions []ArticleRevision) error
+	// List returns the revisions of an article, oldest first.
+	List(ctx context.Context, articleRef primitive.ObjectID) ([]*ArticleRevision, error)
+	// Find returns the revisions of an article with the given numbers.
+	Find(ctx context.Context, articleRef primitive.ObjectID, numbers []int) ([]ArticleRevision, error)
+}
+
+// FailureRepository persists the articles whose details could not be fetched.
+type FailureRepository interface {
+	// Save stores the failed articles, overwriting the earlier failures of the same team and upstream ID.
+	Save(ctx context.Context, failures []FailedArticle) error
+	// Delete removes the failed articles of a team with the given upstream IDs.
+	Delete(ctx context.Context, teamID string, articleIDs []string) error
+	// List returns the failed articles of a team, or of all teams when teamID is empty, ordered by their next retry.
+	List(ctx context.Context, teamID string) ([]*FailedArticle, error)
+}
+
+// FeedStateRepository persists the polling state of the feeds. Every update creates the state of a feed if needed.
+type FeedStateRepository interface {
+	// Get returns the state of a feed, an empty state when the feed has none yet.
+	Get(ctx context.Context, clubKey string) (*FeedState, error)
+	// List returns the states of all feeds, ordered by their club key.
+	List(ctx context.Context) ([]*FeedState, error)
+	// SaveValidators stores the ETag and Last-Modified values of the last processed list response of a feed.
+	SaveValidators(ctx context.Context, clubKey string, etag string, lastModified string, polled time.Time) error
+	// IncrementSkippedPolls counts a poll of the feed that was answered with 304 Not Modified.
+	IncrementSkippedPolls(ctx context.Context, clubKey string, polled time.Time) error
+	// SaveBackfill stores the progress of the feed's backfill.
+	SaveBackfill(ctx context.Context, clubKey string, checkpoint *BackfillCheckpoint) error
+	// SetPaused stores whether the schedule of the feed is paused.
+	SetPaused(ctx context.Context, clubKey string, paused bool) error
+	// Save stores the whole state of a feed, replacing the stored state.
+	Save(ctx context.Context, state *FeedState) error
+}
+
+// RunRepository persists the records of the ingestion runs.
+type RunRepository interface {
+	// Save stores a run, setting its ID when it has none. A run with the ID of a stored run replaces it.
+	// The runs started longer than the run retention ago are removed.
+	Save(ctx context.Context, run *IngestionRun) error
+	// List returns a page of the runs of a feed, or of all feeds when feed is empty, newest first,
+	// together with the total number of matching runs. Pages start at 1.
+	List(ctx context.Context, feed string, page int, pageSize int) ([]*IngestionRun, int64, error)
+	// LastSuccessful returns the last run without an error of every feed, by feed. Refreshes of single articles are left out.
+	LastSuccessful(ctx context.Context) (map[string]*IngestionRun, error)
+}
@@ -0,0 +1,465 @@
+package articles
+
+import (
+	"context"
+	"github.com/SkaisgirisMarius/article-processor/config"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// memoryArticleRepository keeps the articles in memory, in the order they were added.
+type memoryArticleRepository struct {
+	mu       sync.RWMutex
+	articles []*Article
+}
+
+// memoryRevisionRepository keeps the article revisions in memory, in the order they were added.
+type memoryRevisionRepository struct {
+	mu        sync.RWMutex
+	revisions []ArticleRevision
+}
+
+// memoryFailureRepository keeps the failed articles in memory, by team and upstream ID.
+type memoryFailureRepository struct {
+	mu       sync.RWMutex
+	failures map[string]FailedArticle
+}
+
+// memoryFeedStateRepository keeps the feed states in memory, by club key.
+type memoryFeedStateRepository struct {
+	mu     sync.RWMutex
+	states map[string]FeedState
+}
+
+// memoryRunRepository keeps the ingestion runs in memory, in the order they were saved.
+type memoryRunRepository struct {
+	mu   sync.RWMutex
+	runs []IngestionRun
+}
+
+// NewMemoryStorage returns a storage that keeps everything in memory. It is safe for concurrent use,
+// nothing survives a restart.
+func NewMemoryStorage() *Storage {
+	return &Storage{
+		Articles:   &memoryArticleRepository{},
+		Revisions:  &memoryRevisionRepository{},
+		Failures:   &memoryFailureRepository{failures: make(map[string]FailedArticle)},
+		FeedStates: &memoryFeedStateRepository{states: make(map[string]FeedState)},
+		Runs:       &memoryRunRepository{},
+	}
+}
+
+// articleKey identifies an article by its team and upstream ID.
+func articleKey(teamID string, articleID string) string {
+	return teamID + "/" + articleID
+}
+
+// matches reports whether the article is selected by the filter.
+func (f ArticleFilter) matches(a *Article) bool {
+	if f.TeamID != "" && a.TeamID != f.TeamID {
+		return false
+	}
+	if containsString(f.ExcludeArticleIDs, a.ArticleID) {
+		return false
+	}
+	if !f.PublishedSince.IsZero() && a.Published.Before(f.PublishedSince) {
+		return false
+	}
+	if !f.IncludeWithdrawn && a.isHidden() {
+		return false
+	}
+	if f.MinReadingTime > 0 && a.ReadingTime < f.MinReadingTime {
+		return false
+	}
+	if f.MaxReadingTime > 0 && a.ReadingTime > f.MaxReadingTime {
+		return false
+	}
+	return true
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// FindByID returns a copy of the article with the given ID.
+func (r *memoryArticleRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*Article, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, a := range r.articles {
+		if a.ID == id {
+			article := *a
+			return &article, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// FindByArticleIDs returns copies of the articles of a team with the given upstream IDs.
+func (r *memoryArticleRepository) FindByArticleIDs(ctx context.Context, teamID string, articleIDs []string) ([]Article, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var articles []Article
+	for _, a := range r.articles {
+		if a.TeamID == teamID && containsString(articleIDs, a.ArticleID) {
+			articles = append(articles, *a)
+		}
+	}
+	return articles, nil
+}
+
+// List returns copies of the articles matching the filter.
+func (r *memoryArticleRepository) List(ctx context.Context, filter ArticleFilter) ([]*Article, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	articles := make([]*Article, 0)
+	for _, a := range r.articles {
+		if filter.matches(a) {
+			article := *a
+			articles = append(articles, &article)
+		}
+	}
+	return articles, nil
+}
+
+// Upsert adds the articles, or overwrites the stored articles with the same team and upstream ID
+// while keeping their ID. Only stored articles whose fields differ count as changed.
+func (r *memoryArticleRepository) Upsert(ctx context.Context, articles []Article) (int, int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored := make(map[string]*Article)
+	for _, a := range r.articles {
+		stored[articleKey(a.TeamID, a.ArticleID)] = a
+	}
+
+	added, changed := 0, 0
+	for _, article := range articles {
+		article := article
+		existing, found := stored[articleKey(article.TeamID, article.ArticleID)]
+		if !found {
+			if article.ID.IsZero() {
+				article.ID = primitive.NewObjectID()
+			}
+			added++
+			r.articles = append(r.articles, &article)
+			stored[articleKey(article.TeamID, article.ArticleID)] = &article
+			continue
+		}
+		article.ID = existing.ID
+		if !reflect.DeepEqual(*existing, article) {
+			changed++
+			*existing = article
+		}
+	}
+	return added, changed, nil
+}
+
+// SetState sets the publication state of the given articles of a team.
+func (r *memoryArticleRepository) SetState(ctx context.Context, teamID string, articleIDs []string, state string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	changed := 0
+	for _, a := range r.articles {
+		if a.TeamID == teamID && containsString(articleIDs, a.ArticleID) && a.State != state {
+			a.State = state
+			changed++
+		}
+	}
+	return changed, nil
+}
+
+// Delete removes the given articles of a team.
+func (r *memoryArticleRepository) Delete(ctx context.Context, teamID string, articleIDs []string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	kept := r.articles[:0]
+	for _, a := range r.articles {
+		if a.TeamID != teamID || !containsString(articleIDs, a.ArticleID) {
+			kept = append(kept, a)
+		}
+	}
+	deleted := len(r.articles) - len(kept)
+	r.articles = kept
+	return deleted, nil
+}
+
+// MoveTeam moves the articles of a team to another team, removing the copies of the articles the other team has as well.
+func (r *memoryArticleRepository) MoveTeam(ctx context.Context, fromTeamID string, toTeamID string) (int, int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var storedIDs []string
+	for _, a := range r.articles {
+		if a.TeamID == toTeamID {
+			storedIDs = append(storedIDs, a.ArticleID)
+		}
+	}
+	moved, removed := 0, 0
+	kept := r.articles[:0]
+	for _, a := range r.articles {
+		switch {
+		case a.TeamID != fromTeamID:
+		case containsString(storedIDs, a.ArticleID):
+			removed++
+			continue
+		default:
+			a.TeamID = toTeamID
+			moved++
+		}
+		kept = append(kept, a)
+	}
+	r.articles = kept
+	return moved, removed, nil
+}
+
+// Add numbers the revisions after the latest revision of their article and stores them.
+func (r *memoryRevisionRepository) Add(ctx context.Context, revisions []ArticleRevision) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	latest := make(map[primitive.ObjectID]int)
+	for _, revision := range r.revisions {
+		if revision.Revision > latest[revision.ArticleRef] {
+			latest[revision.ArticleRef] = revision.Revision
+		}
+	}
+	for _, revision := range revisions {
+		latest[revision.ArticleRef]++
+		if revision.ID.IsZero() {
+			revision.ID = primitive.NewObjectID()
+		}
+		revision.Revision = latest[revision.ArticleRef]
+		r.revisions = append(r.revisions, revision)
+	}
+	return nil
+}
+
+// List returns the revisions of an article, oldest first.
+func (r *memoryRevisionRepository) List(ctx context.Context, articleRef primitive.ObjectID) ([]*ArticleRevision, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	revisions := make([]*ArticleRevision, 0)
+	for _, revision := range r.revisions {
+		if revision.ArticleRef == articleRef {
+			revision := revision
+			revisions = append(revisions, &revision)
+		}
+	}
+	sort.SliceStable(revisions, func(i, j int) bool { return revisions[i].Revision < revisions[j].Revision })
+	return revisions, nil
+}
+
+// Find returns the revisions of an article with the given numbers.
+func (r *memoryRevisionRepository) Find(ctx context.Context, articleRef primitive.ObjectID, numbers []int) ([]ArticleRevision, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var revisions []ArticleRevision
+	for _, revision := range r.revisions {
+		if revision.ArticleRef != articleRef {
+			continue
+		}
+		for _, n := range numbers {
+			if revision.Revision == n {
+				revisions = append(revisions, revision)
+			}
+		}
+	}
+	return revisions, nil
+}
+
+// Save stores the failed articles, keeping the ID of an earlier failure of the same article.
+func (r *memoryFailureRepository) Save(ctx context.Context, failures []FailedArticle) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, failure := range failures {
+		key := articleKey(failure.TeamID, failure.ArticleID)
+		if existing, found := r.failures[key]; found {
+			failure.ID = existing.ID
+		} else {
+			failure.ID = primitive.NewObjectID()
+		}
+		r.failures[key] = failure
+	}
+	return nil
+}
+
+// Delete removes the given failed articles of a team.
+func (r *memoryFailureRepository) Delete(ctx context.Context, teamID string, articleIDs []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, articleID := range articleIDs {
+		delete(r.failures, articleKey(teamID, articleID))
+	}
+	return nil
+}
+
+// List returns the failed articles of a team, or of all teams when teamID is empty, ordered by their next retry.
+func (r *memoryFailureRepository) List(ctx context.Context, teamID string) ([]*FailedArticle, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	failures := make([]*FailedArticle, 0)
+	for _, failure := range r.failures {
+		if teamID == "" || failure.TeamID == teamID {
+			failure := failure
+			failures = append(failures, &failure)
+		}
+	}
+	sort.Slice(failures, func(i, j int) bool { return failures[i].NextRetry.Before(failures[j].NextRetry) })
+	return failures, nil
+}
+
+// Get returns a copy of the state of a feed, an empty state when the feed has none yet.
+func (r *memoryFeedStateRepository) Get(ctx context.Context, clubKey string) (*FeedState, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	state, found := r.states[clubKey]
+	if !found {
+		return &FeedState{ClubKey: clubKey}, nil
+	}
+	return &state, nil
+}
+
+// List returns copies of the states of all feeds, ordered by their club key.
+func (r *memoryFeedStateRepository) List(ctx context.Context) ([]*FeedState, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	states := make([]*FeedState, 0, len(r.states))
+	for _, state := range r.states {
+		state := state
+		states = append(states, &state)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].ClubKey < states[j].ClubKey })
+	return states, nil
+}
+
+// SaveValidators stores the ETag and Last-Modified values of the last processed list response of a feed.
+func (r *memoryFeedStateRepository) SaveValidators(ctx context.Context, clubKey string, etag string, lastModified string, polled time.Time) error {
+	r.update(clubKey, func(state *FeedState) {
+		state.ETag = etag
+		state.LastModified = lastModified
+		state.LastPolled = polled
+	})
+	return nil
+}
+
+// IncrementSkippedPolls counts a poll of the feed that was answered with 304 Not Modified.
+func (r *memoryFeedStateRepository) IncrementSkippedPolls(ctx context.Context, clubKey string, polled time.Time) error {
+	r.update(clubKey, func(state *FeedState) {
+		state.SkippedPolls++
+		state.LastPolled = polled
+	})
+	return nil
+}
+
+// SaveBackfill stores a copy of the progress of the feed's backfill.
+func (r *memoryFeedStateRepository) SaveBackfill(ctx context.Context, clubKey string, checkpoint *BackfillCheckpoint) error {
+	stored := *checkpoint
+	r.update(clubKey, func(state *FeedState) {
+		state.Backfill = &stored
+	})
+	return nil
+}
+
+// SetPaused stores whether the schedule of the feed is paused.
+func (r *memoryFeedStateRepository) SetPaused(ctx context.Context, clubKey string, paused bool) error {
+	r.update(clubKey, func(state *FeedState) {
+		state.Paused = paused
+	})
+	return nil
+}
+
+// Save replaces the state of a feed with a copy of the given state.
+func (r *memoryFeedStateRepository) Save(ctx context.Context, state *FeedState) error {
+	stored := *state
+	if state.Backfill != nil {
+		checkpoint := *state.Backfill
+		stored.Backfill = &checkpoint
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.states[state.ClubKey] = stored
+	return nil
+}
+
+// update applies the given change to the state of a feed, creating the state if needed.
+func (r *memoryFeedStateRepository) update(clubKey string, change func(state *FeedState)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	state, found := r.states[clubKey]
+	if !found {
+		state = FeedState{ClubKey: clubKey}
+	}
+	change(&state)
+	r.states[clubKey] = state
+}
+
+// Save stores a copy of the run, replacing the stored run with the same ID. Adding a run removes the expired runs.
+func (r *memoryRunRepository) Save(ctx context.Context, run *IngestionRun) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if run.ID.IsZero() {
+		run.ID = primitive.NewObjectID()
+	}
+	for i := range r.runs {
+		if r.runs[i].ID == run.ID {
+			r.runs[i] = *run
+			return nil
+		}
+	}
+	expiry := time.Now().Add(-config.Conf.Ingestion.RunRetentionDuration())
+	kept := r.runs[:0]
+	for _, stored := range r.runs {
+		if !stored.StartedAt.Before(expiry) {
+			kept = append(kept, stored)
+		}
+	}
+	r.runs = append(kept, *run)
+	return nil
+}
+
+// List returns a page of the runs of a feed, or of all feeds when feed is empty, newest first.
+func (r *memoryRunRepository) List(ctx context.Context, feed string, page int, pageSize int) ([]*IngestionRun, int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var matching []*IngestionRun
+	for _, run := range r.runs {
+		if feed == "" || run.Feed == feed {
+			run := run
+			matching = append(matching, &run)
+		}
+	}
+	sort.SliceStable(matching, func(i, j int) bool { return matching[i].StartedAt.After(matching[j].StartedAt) })
+
+	runs := make([]*IngestionRun, 0)
+	start := (page - 1) * pageSize
+	if start < len(matching) {
+		end := start + pageSize
+		if end > len(matching) {
+			end = len(matching)
+		}
+		runs = append(runs, matching[start:end]...)
+	}
+	return runs, int64(len(matching)), nil
+}
+
+// LastSuccessful returns the last run without an error of every feed, leaving out the refreshes of single articles.
+func (r *memoryRunRepository) LastSuccessful(ctx context.Context) (map[string]*IngestionRun, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	runsByFeed := make(map[string]*IngestionRun)
+	for _, run := range r.runs {
+		if run.Error != "" || run.Trigger == runTriggerRefresh {
+			continue
+		}
+		if last, found := runsByFeed[run.Feed]; !found || run.StartedAt.After(last.StartedAt) {
+			run := run
+			runsByFeed[run.Feed] = &run
+		}
+	}
+	return runsByFeed, nil
+}
@@ -0,0 +1,547 @@
+package articles
+
+import (
+	"context"
+	"github.com/SkaisgirisMarius/article-processor/db"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// Collections of the MongoDB backend.
+const (
+	articlesCollection       = "articles"
+	revisionsCollection      = "article_revisions"
+	failedArticlesCollection = "failed_articles"
+	feedStatesCollection     = "feed_states"
+	ingestionRunsCollection  = "ingestion_runs"
+)
+
+// revisionInsertAttempts is how often a revision is numbered again when a concurrent write took its number.
+const revisionInsertAttempts = 5
+
+type mongoArticleRepository struct{}
+
+type mongoRevisionRepository struct{}
+
+type mongoFailureRepository struct{}
+
+type mongoFeedStateRepository struct{}
+
+type mongoRunRepository struct{}
+
+// NewMongoStorage returns the storage backed by the MongoDB database of the configuration.
+func NewMongoStorage() *Storage {
+	return &Storage{
+		Articles:   mongoArticleRepository{},
+		Revisions:  mongoRevisionRepository{},
+		Failures:   mongoFailureRepository{},
+		FeedStates: mongoFeedStateRepository{},
+		Runs:       mongoRunRepository{},
+	}
+}
+
+// toBson converts the filter to a MongoDB query.
+func (f ArticleFilter) toBson() bson.M {
+	filter := bson.M{}
+	if f.TeamID != "" {
+		filter["teamId"] = f.TeamID
+	}
+	if len(f.ExcludeArticleIDs) > 0 {
+		filter["articleID"] = bson.M{"$nin": f.ExcludeArticleIDs}
+	}
+	if !f.PublishedSince.IsZero() {
+		filter["published"] = bson.M{"$gte": f.PublishedSince}
+	}
+	if !f.IncludeWithdrawn {
+		filter["state"] = bson.M{"$nin": hiddenStates}
+	}
+	readingTime := bson.M{}
+	if f.MinReadingTime > 0 {
+		readingTime["$gte"] = f.MinReadingTime
+	}
+	if f.MaxReadingTime > 0 {
+		readingTime["$lte"] = f.MaxReadingTime
+	}
+	if len(readingTime) > 0 {
+		filter["readingTime"] = readingTime
+	}
+	return filter
+}
+
+// FindByID retrieves an article from the database based on its ID.
+func (mongoArticleRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*Article, error) {
+	ctx, cancel := db.WithTimeout(ctx)
+	defer cancel()
+	var article Article
+	err := getArticlesCollection().FindOne(ctx, bson.M{"_id": id}).Decode(&article)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		log.Errorf("could not find article with ID: %v, error: %v", id.Hex(), err)
+		return nil, err
+	}
+	return &article, nil
+}
+
+// FindByArticleIDs retrieves the articles of a team with the given upstream IDs from the database.
+func (mongoArticleRepository) FindByArticleIDs(ctx context.Context, teamID string, articleIDs []string) ([]Article, error) {
+	if len(articleIDs) == 0 {
+		return nil, nil
+	}
+	ctx, cancel := db.WithTimeout(ctx)
+	defer cancel()
+	filter := bson.M{"teamId": teamID, "articleID": bson.M{"$in": articleIDs}}
+	cur, err := getArticlesCollection().Find(ctx, filter)
+	if err != nil {
+		log.Error("Error while querying the db: ", err)
+		return nil, err
+	}
+	var articles []Article
+	if err := cur.All(ctx, &articles); err != nil {
+		return nil, err
+	}
+	return articles, nil
+}
+
+// List retrieves the articles matching the filter from the database.
+func (mongoArticleRepository) List(ctx context.Context, filter ArticleFilter) ([]*Article, error) {
+	ctx, cancel := db.WithTimeout(ctx)
+	defer cancel()
+
+	articles := make([]*Article, 0)
+	cur, err := getArticlesCollection().Find(ctx, filter.toBson())
+	if err != nil {
+		log.Error("Could not get articles from the database. Error: ", err)
+		return nil, err
+	}
+	if err := cur.All(ctx, &articles); err != nil {
+		log.Error("Could not decode articles. Error: ", err)
+		return nil, err
+	}
+	return articles, nil
+}
+
+// Upsert upserts the articles into the database using bulk write operations,
+// filtering on their TeamID and ArticleID.
+func (mongoArticleRepository) Upsert(ctx context.Context, articles []Article) (int, int, error) {
+	if len(articles) == 0 {
+		return 0, 0, nil
+	}
+	ctx, cancel := db.WithTimeout(ctx)
+	defer cancel()
+
+	// Prepare the bulk write operations
+	var bulkOps []mongo.WriteModel
+	for _, article := range articles {
+		// Create a filter to check if the article already exists in the database
+		filter := bson.M{"teamId": article.TeamID, "articleID": article.ArticleID}
+
+		// Create the update operation. Here, we use upsert to insert the document if it doesn't exist.
+		update := bson.M{"$set": article}
+
+		updateModel := mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(update).SetUpsert(true)
+		bulkOps = append(bulkOps, updateModel)
+	}
+
+	// Execute the bulk write operation
+	result, err := getArticlesCollection().BulkWrite(ctx, bulkOps)
+	if err != nil {
+		log.Println("Failed to insert article to the DB: ", err)
+		return 0, 0, err
+	}
+	return int(result.UpsertedCount), int(result.ModifiedCount), nil
+}
+
+// SetState sets the publication state of the given articles of a team in the database.
+func (mongoArticleRepository) SetState(ctx context.Context, teamID string, articleIDs []string, state string) (int, error) {
+	ctx, cancel := db.WithTimeout(ctx)
+	defer cancel()
+	filter := bson.M{"teamId": teamID, "articleID": bson.M{"$in": articleIDs}}
+	update := bson.M{"$set": bson.M{"state": state}}
+
+	result, err := getArticlesCollection().UpdateMany(ctx, filter, update)
+	if err != nil {
+		log.Printf("Failed to set the state of articles to %v in the DB: %v", state, err)
+		return 0, err
+	}
+	return int(result.ModifiedCount), nil
+}
+
+// Delete removes the given articles of a team from the database.
+func (mongoArticleRepository) Delete(ctx context.Context, teamID string, articleIDs []string) (int, error) {
+	ctx, cancel := db.WithTimeout(ctx)
+	defer cancel()
+	filter := bson.M{"teamId": teamID, "articleID": bson.M{"$in": articleIDs}}
+
+	result, err := getArticlesCollection().DeleteMany(ctx, filter)
+	if err != nil {
+		log.Println("Failed to delete articles from the DB: ", err)
+		return 0, err
+	}
+	return int(result.DeletedCount), nil
+}
+
+// MoveTeam moves the articles of a team to another team in the database, removing the copies of the articles the
+// other team has as well.
+func (mongoArticleRepository) MoveTeam(ctx context.Context, fromTeamID string, toTeamID string) (int, int, error) {
+	ctx, cancel := db.WithTimeout(ctx)
+	defer cancel()
+	collection := getArticlesCollection()
+
+	storedIDs, err := collection.Distinct(ctx, "articleID", bson.M{"teamId": toTeamID})
+	if err != nil {
+		return 0, 0, err
+	}
+	removed, err := collection.DeleteMany(ctx, bson.M{"teamId": fromTeamID, "articleID": bson.M{"$in": storedIDs}})
+	if err != nil {
+		log.Println("Failed to delete articles from the DB: ", err)
+		return 0, 0, err
+	}
+	moved, err := collection.UpdateMany(ctx, bson.M{"teamId": fromTeamID}, bson.M{"$set": bson.M{"teamId": toTeamID}})
+	if err != nil {
+		log.Println("Failed to move articles in the DB: ", err)
+		return 0, int(removed.DeletedCount), err
+	}
+	return int(moved.ModifiedCount), int(removed.DeletedCount), nil
+}
+
+// Add numbers the revisions after the latest revision of their article and stores them in the database.
+// The revisions of the same article in the batch get consecutive numbers. When a concurrent write took the
+// number first, the unique revision index rejects the revision and it is numbered after the latest one again.
+func (mongoRevisionRepository) Add(ctx context.Context, revisions []ArticleRevision) error {
+	if len(revisions) == 0 {
+		return nil
+	}
+	ctx, cancel := db.WithTimeout(ctx)
+	defer cancel()
+
+	nextNumbers := make(map[primitive.ObjectID]int)
+	for _, revision := range revisions {
+		for attempt := 1; ; attempt++ {
+			if _, found := nextNumbers[revision.ArticleRef]; !found {
+				revisionNumber, err := getNextRevisionNumber(ctx, revision.ArticleRef)
+				if err != nil {
+					return err
+				}
+				nextNumbers[revision.ArticleRef] = revisionNumber
+			}
+			revision.Revision = nextNumbers[revision.ArticleRef]
+			_, err := getRevisionsCollection().InsertOne(ctx, revision)
+			if err == nil {
+				nextNumbers[revision.ArticleRef]++
+				break
+			}
+			if mongo.IsDuplicateKeyError(err) && attempt < revisionInsertAttempts {
+				delete(nextNumbers, revision.ArticleRef)
+				continue
+			}
+			log.Error("Could not store article revisions. Error: ", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// getNextRevisionNumber returns the number the next revision of the given article should get.
+func getNextRevisionNumber(ctx context.Context, articleRef primitive.ObjectID) (int, error) {
+	opts := options.FindOne().SetSort(bson.M{"revision": -1})
+
+	var latest ArticleRevision
+	err := getRevisionsCollection().FindOne(ctx, bson.M{"articleRef": articleRef}, opts).Decode(&latest)
+	if err == mongo.ErrNoDocuments {
+		return 1, nil
+	}
+	if err != nil {
+		log.Error("Could not get the latest article revision. Error: ", err)
+		return 0, err
+	}
+	return latest.Revision + 1, nil
+}
+
+// List retrieves all revisions of an article from the database, oldest first.
+func (mongoRevisionRepository) List(ctx context.Context, articleRef primitive.ObjectID) ([]*ArticleRevision, error) {
+	ctx, cancel := db.WithTimeout(ctx)
+	defer cancel()
+	opts := options.Find().SetSort(bson.M{"revision": 1})
+
+	revisions := make([]*ArticleRevision, 0)
+	cur, err := getRevisionsCollection().Find(ctx, bson.M{"articleRef": articleRef}, opts)
+	if err != nil {
+		log.Error("Could not get article revisions from the database. Error: ", err)
+		return nil, err
+	}
+	if err := cur.All(ctx, &revisions); err != nil {
+		log.Error("Could not decode article revisions. Error: ", err)
+		return nil, err
+	}
+	return revisions, nil
+}
+
+// Find retrieves the revisions of an article with the given numbers from the database.
+func (mongoRevisionRepository) Find(ctx context.Context, articleRef primitive.ObjectID, numbers []int) ([]ArticleRevision, error) {
+	ctx, cancel := db.WithTimeout(ctx)
+	defer cancel()
+	filter := bson.M{"articleRef": articleRef, "revision": bson.M{"$in": numbers}}
+	cur, err := getRevisionsCollection().Find(ctx, filter)
+	if err != nil {
+		log.Error("Could not get article revisions from the database. Error: ", err)
+		return nil, err
+	}
+	var revisions []ArticleRevision
+	if err := cur.All(ctx, &revisions); err != nil {
+		log.Error("Could not decode article revisions. Error: ", err)
+		return nil, err
+	}
+	return revisions, nil
+}
+
+// Save upserts the failed articles into the failed_articles collection.
+func (mongoFailureRepository) Save(ctx context.Context, failures []FailedArticle) error {
+	if len(failures) == 0 {
+		return nil
+	}
+	ctx, cancel := db.WithTimeout(ctx)
+	defer cancel()
+	var bulkOps []mongo.WriteModel
+	for _, failure := range failures {
+		// The _id of a stored failure is immutable, it must not be part of the update
+		failure.ID = primitive.NilObjectID
+		filter := bson.M{"teamId": failure.TeamID, "articleID": failure.ArticleID}
+		update := bson.M{"$set": failure}
+		bulkOps = append(bulkOps, mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(update).SetUpsert(true))
+	}
+	if _, err := getFailedArticlesCollection().BulkWrite(ctx, bulkOps); err != nil {
+		log.Println("Failed to store failed articles to the DB: ", err)
+		return err
+	}
+	return nil
+}
+
+// Delete removes the given articles of a team from the failed_articles collection.
+func (mongoFailureRepository) Delete(ctx context.Context, teamID string, articleIDs []string) error {
+	if len(articleIDs) == 0 {
+		return nil
+	}
+	ctx, cancel := db.WithTimeout(ctx)
+	defer cancel()
+	filter := bson.M{"teamId": teamID, "articleID": bson.M{"$in": articleIDs}}
+	if _, err := getFailedArticlesCollection().DeleteMany(ctx, filter); err != nil {
+		log.Println("Failed to clear failed articles in the DB: ", err)
+		return err
+	}
+	return nil
+}
+
+// List retrieves the failed articles of a team, or of all teams when teamID is empty, ordered by their next retry time.
+func (mongoFailureRepository) List(ctx context.Context, teamID string) ([]*FailedArticle, error) {
+	filter := bson.M{}
+	if teamID != "" {
+		filter["teamId"] = teamID
+	}
+	ctx, cancel := db.WithTimeout(ctx)
+	defer cancel()
+	opts := options.Find().SetSort(bson.M{"nextRetry": 1})
+
+	failures := make([]*FailedArticle, 0)
+	cur, err := getFailedArticlesCollection().Find(ctx, filter, opts)
+	if err != nil {
+		log.Error("Could not get failed articles from the database. Error: ", err)
+		return nil, err
+	}
+	if err := cur.All(ctx, &failures); err != nil {
+		log.Error("Could not decode failed articles. Error: ", err)
+		return nil, err
+	}
+	return failures, nil
+}
+
+// Get retrieves the state of the given feed. A feed that was never polled gets an empty state.
+func (mongoFeedStateRepository) Get(ctx context.Context, clubKey string) (*FeedState, error) {
+	ctx, cancel := db.WithTimeout(ctx)
+	defer cancel()
+	state := &FeedState{ClubKey: clubKey}
+	err := getFeedStatesCollection().FindOne(ctx, bson.M{"_id": clubKey}).Decode(state)
+	if err == mongo.ErrNoDocuments {
+		return state, nil
+	}
+	if err != nil {
+		log.Errorf("could not get state of feed %v, error: %v", clubKey, err)
+		return nil, err
+	}
+	return state, nil
+}
+
+// List retrieves the states of all feeds that were polled at least once.
+func (mongoFeedStateRepository) List(ctx context.Context) ([]*FeedState, error) {
+	ctx, cancel := db.WithTimeout(ctx)
+	defer cancel()
+	opts := options.Find().SetSort(bson.M{"_id": 1})
+
+	states := make([]*FeedState, 0)
+	cur, err := getFeedStatesCollection().Find(ctx, bson.M{}, opts)
+	if err != nil {
+		log.Error("Could not get feed states from the database. Error: ", err)
+		return nil, err
+	}
+	if err := cur.All(ctx, &states); err != nil {
+		log.Error("Could not decode feed states. Error: ", err)
+		return nil, err
+	}
+	return states, nil
+}
+
+// SaveValidators stores the ETag and Last-Modified values of the last processed list response of a feed.
+func (mongoFeedStateRepository) SaveValidators(ctx context.Context, clubKey string, etag string, lastModified string, polled time.Time) error {
+	update := bson.M{"$set": bson.M{"etag": etag, "lastModified": lastModified, "lastPolled": polled}}
+	return updateFeedState(ctx, clubKey, update)
+}
+
+// IncrementSkippedPolls counts a poll of the feed that was answered with 304 Not Modified.
+func (mongoFeedStateRepository) IncrementSkippedPolls(ctx context.Context, clubKey string, polled time.Time) error {
+	update := bson.M{"$inc": bson.M{"skippedPolls": 1}, "$set": bson.M{"lastPolled": polled}}
+	return updateFeedState(ctx, clubKey, update)
+}
+
+// SaveBackfill stores the progress of a feed's backfill.
+func (mongoFeedStateRepository) SaveBackfill(ctx context.Context, clubKey string, checkpoint *BackfillCheckpoint) error {
+	return updateFeedState(ctx, clubKey, bson.M{"$set": bson.M{"backfill": checkpoint}})
+}
+
+// SetPaused stores whether the schedule of a feed is paused.
+func (mongoFeedStateRepository) SetPaused(ctx context.Context, clubKey string, paused bool) error {
+	return updateFeedState(ctx, clubKey, bson.M{"$set": bson.M{"paused": paused}})
+}
+
+// Save replaces the state of a feed.
+func (mongoFeedStateRepository) Save(ctx context.Context, state *FeedState) error {
+	ctx, cancel := db.WithTimeout(ctx)
+	defer cancel()
+	opts := options.Replace().SetUpsert(true)
+	if _, err := getFeedStatesCollection().ReplaceOne(ctx, bson.M{"_id": state.ClubKey}, state, opts); err != nil {
+		log.Errorf("could not store state of feed %v, error: %v", state.ClubKey, err)
+		return err
+	}
+	return nil
+}
+
+// updateFeedState applies the given update to the state of a feed, creating the state if needed.
+func updateFeedState(ctx context.Context, clubKey string, update bson.M) error {
+	ctx, cancel := db.WithTimeout(ctx)
+	defer cancel()
+	opts := options.Update().SetUpsert(true)
+	if _, err := getFeedStatesCollection().UpdateOne(ctx, bson.M{"_id": clubKey}, update, opts); err != nil {
+		log.Errorf("could not update state of feed %v, error: %v", clubKey, err)
+		return err
+	}
+	return nil
+}
+
+// Save stores the record of an ingestion run in the ingestion_runs collection, replacing the stored run with the same ID.
+// The expired runs are removed by the TTL index on startedAt.
+func (mongoRunRepository) Save(ctx context.Context, run *IngestionRun) error {
+	ctx, cancel := db.WithTimeout(ctx)
+	defer cancel()
+	if !run.ID.IsZero() {
+		_, err := getIngestionRunsCollection().ReplaceOne(ctx, bson.M{"_id": run.ID}, run, options.Replace().SetUpsert(true))
+		if err != nil {
+			log.Errorf("could not store ingestion run of %v, error: %v", run.Feed, err)
+		}
+		return err
+	}
+	result, err := getIngestionRunsCollection().InsertOne(ctx, run)
+	if err != nil {
+		log.Errorf("could not store ingestion run of %v, error: %v", run.Feed, err)
+		return err
+	}
+	if id, ok := result.InsertedID.(primitive.ObjectID); ok {
+		run.ID = id
+	}
+	return nil
+}
+
+// List retrieves a page of the ingestion runs of a feed, or of all feeds when feed is empty, newest first.
+func (mongoRunRepository) List(ctx context.Context, feed string, page int, pageSize int) ([]*IngestionRun, int64, error) {
+	filter := bson.M{}
+	if feed != "" {
+		filter["feed"] = feed
+	}
+	ctx, cancel := db.WithTimeout(ctx)
+	defer cancel()
+	collection := getIngestionRunsCollection()
+
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		log.Error("Could not count ingestion runs in the database. Error: ", err)
+		return nil, 0, err
+	}
+	opts := options.Find().
+		SetSort(bson.M{"startedAt": -1}).
+		SetSkip(int64((page - 1) * pageSize)).
+		SetLimit(int64(pageSize))
+
+	runs := make([]*IngestionRun, 0)
+	cur, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		log.Error("Could not get ingestion runs from the database. Error: ", err)
+		return nil, 0, err
+	}
+	if err := cur.All(ctx, &runs); err != nil {
+		log.Error("Could not decode ingestion runs. Error: ", err)
+		return nil, 0, err
+	}
+	return runs, total, nil
+}
+
+// LastSuccessful returns the last successful ingestion run of every feed.
+func (mongoRunRepository) LastSuccessful(ctx context.Context) (map[string]*IngestionRun, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"error": bson.M{"$exists": false}, "trigger": bson.M{"$ne": runTriggerRefresh}}}},
+		{{Key: "$sort", Value: bson.M{"startedAt": -1}}},
+		{{Key: "$group", Value: bson.M{"_id": "$feed", "run": bson.M{"$first": "$$ROOT"}}}},
+	}
+	ctx, cancel := db.WithTimeout(ctx)
+	defer cancel()
+	cur, err := getIngestionRunsCollection().Aggregate(ctx, pipeline)
+	if err != nil {
+		log.Error("Could not get the last successful ingestion runs from the database. Error: ", err)
+		return nil, err
+	}
+	var lastRuns []struct {
+		Feed string       `bson:"_id"`
+		Run  IngestionRun `bson:"run"`
+	}
+	if err := cur.All(ctx, &lastRuns); err != nil {
+		log.Error("Could not decode ingestion runs. Error: ", err)
+		return nil, err
+	}
+	runsByFeed := make(map[string]*IngestionRun)
+	for i := range lastRuns {
+		runsByFeed[lastRuns[i].Feed] = &lastRuns[i].Run
+	}
+	return runsByFeed, nil
+}
+
+func getArticlesCollection() *mongo.Collection {
+	return db.GetMongoCollection(articlesCollection)
+}
+
+func getRevisionsCollection() *mongo.Collection {
+	return db.GetMongoCollection(revisionsCollection)
+}
+
+func getFailedArticlesCollection() *mongo.Collection {
+	return db.GetMongoCollection(failedArticlesCollection)
+}
+
+func getFeedStatesCollection() *mongo.Collection {
+	return db.GetMongoCollection(feedStatesCollection)
+}
+
+func getIngestionRunsCollection() *mongo.Collection {
+	return db.GetMongoCollection(ingestionRunsCollection)
+}
@@ -0,0 +1,757 @@
+package articles
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/SkaisgirisMarius/article-processor/config"
+	"github.com/SkaisgirisMarius/article-processor/db"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"strings"
+	"time"
+)
+
+// postgresSchema creates the tables of the PostgreSQL backend. IDs are stored as the hex form of ObjectIDs, so the
+// IDs in the API stay the same across backends. The taxonomies and gallery image URLs are text arrays, the article
+// of a revision is stored in MongoDB extended JSON so that it keeps every field, and the backfill checkpoint of a feed as JSON.
+const postgresSchema = `
+CREATE TABLE IF NOT EXISTS articles (
+	id               CHAR(24) PRIMARY KEY,
+	team_id          TEXT NOT NULL,
+	article_id       TEXT NOT NULL,
+	opta_match_id    TEXT,
+	title            TEXT NOT NULL DEFAULT '',
+	type             TEXT[],
+	teaser           TEXT,
+	content          TEXT NOT NULL DEFAULT '',
+	content_text     TEXT NOT NULL DEFAULT '',
+	content_markdown TEXT NOT NULL DEFAULT '',
+	word_count       INTEGER NOT NULL DEFAULT 0,
+	reading_time     INTEGER NOT NULL DEFAULT 0,
+	excerpt          TEXT NOT NULL DEFAULT '',
+	url              TEXT NOT NULL DEFAULT '',
+	image_url        TEXT NOT NULL DEFAULT '',
+	gallery_urls     TEXT[],
+	video_url        TEXT,
+	published        TIMESTAMPTZ NOT NULL,
+	last_updated     TIMESTAMPTZ NOT NULL,
+	state            TEXT NOT NULL DEFAULT '',
+	UNIQUE (team_id, article_id)
+);
+
+CREATE TABLE IF NOT EXISTS article_revisions (
+	id             CHAR(24) PRIMARY KEY,
+	article_ref    CHAR(24) NOT NULL,
+	revision       INTEGER NOT NULL,
+	created_at     TIMESTAMPTZ NOT NULL,
+	changed_fields TEXT[],
+	article        JSONB NOT NULL,
+	UNIQUE (article_ref, revision)
+);
+
+CREATE TABLE IF NOT EXISTS failed_articles (
+	id           CHAR(24) PRIMARY KEY,
+	team_id      TEXT NOT NULL,
+	article_id   TEXT NOT NULL,
+	error        TEXT NOT NULL DEFAULT '',
+	attempts     INTEGER NOT NULL DEFAULT 0,
+	last_attempt TIMESTAMPTZ NOT NULL,
+	next_retry   TIMESTAMPTZ NOT NULL,
+	UNIQUE (team_id, article_id)
+);
+
+CREATE TABLE IF NOT EXISTS feed_states (
+	club_key      TEXT PRIMARY KEY,
+	etag          TEXT NOT NULL DEFAULT '',
+	last_modified TEXT NOT NULL DEFAULT '',
+	skipped_polls BIGINT NOT NULL DEFAULT 0,
+	last_polled   TIMESTAMPTZ NOT NULL DEFAULT '0001-01-01 00:00:00+00',
+	backfill      JSONB,
+	paused        BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE TABLE IF NOT EXISTS ingestion_runs (
+	id          CHAR(24) PRIMARY KEY,
+	feed        TEXT NOT NULL,
+	trigger     TEXT NOT NULL,
+	article_id  TEXT NOT NULL DEFAULT '',
+	started_at  TIMESTAMPTZ NOT NULL,
+	finished_at TIMESTAMPTZ NOT NULL,
+	http_status INTEGER NOT NULL DEFAULT 0,
+	seen        INTEGER NOT NULL DEFAULT 0,
+	added       INTEGER NOT NULL DEFAULT 0,
+	updated     INTEGER NOT NULL DEFAULT 0,
+	failed      INTEGER NOT NULL DEFAULT 0,
+	withdrawn   INTEGER NOT NULL DEFAULT 0,
+	error       TEXT NOT NULL DEFAULT ''
+);
+`
+
+// articleColumns are the columns of the articles table in the order they are read and written.
+var articleColumns = []string{
+	"id", "team_id", "article_id", "opta_match_id", "title", "type", "teaser", "content", "content_text",
+	"content_markdown", "word_count", "reading_time", "excerpt", "url", "image_url", "gallery_urls", "video_url",
+	"published", "last_updated", "state",
+}
+
+const (
+	revisionColumns = "id, article_ref, revision, created_at, changed_fields, article"
+	failureColumns  = "id, team_id, article_id, error, attempts, last_attempt, next_retry"
+	feedColumns     = "club_key, etag, last_modified, skipped_polls, last_polled, backfill, paused"
+	runColumns      = "id, feed, trigger, article_id, started_at, finished_at, http_status, seen, added, updated, failed, withdrawn, error"
+
+	// runConflictUpdate makes an insert of a run replace the stored run with the same ID.
+	runConflictUpdate = " ON CONFLICT (id) DO UPDATE SET feed = EXCLUDED.feed, trigger = EXCLUDED.trigger," +
+		" article_id = EXCLUDED.article_id, started_at = EXCLUDED.started_at, finished_at = EXCLUDED.finished_at," +
+		" http_status = EXCLUDED.http_status, seen = EXCLUDED.seen, added = EXCLUDED.added, updated = EXCLUDED.updated," +
+		" failed = EXCLUDED.failed, withdrawn = EXCLUDED.withdrawn, error = EXCLUDED.error"
+)
+
+type postgresArticleRepository struct {
+	pool *pgxpool.Pool
+}
+
+type postgresRevisionRepository struct {
+	pool *pgxpool.Pool
+}
+
+type postgresFailureRepository struct {
+	pool *pgxpool.Pool
+}
+
+type postgresFeedStateRepository struct {
+	pool *pgxpool.Pool
+}
+
+type postgresRunRepository struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresStorage returns the storage backed by the given PostgreSQL database, creating its tables if needed.
+func NewPostgresStorage(ctx context.Context, pool *pgxpool.Pool) (*Storage, error) {
+	if _, err := pool.Exec(ctx, postgresSchema); err != nil {
+		log.Error("Could not create the PostgreSQL schema. Error: ", err)
+		return nil, err
+	}
+	return &Storage{
+		Articles:   postgresArticleRepository{pool: pool},
+		Revisions:  postgresRevisionRepository{pool: pool},
+		Failures:   postgresFailureRepository{pool: pool},
+		FeedStates: postgresFeedStateRepository{pool: pool},
+		Runs:       postgresRunRepository{pool: pool},
+	}, nil
+}
+
+// toSQL converts the filter to a WHERE clause of the articles table and its arguments.
+func (f ArticleFilter) toSQL() (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	add := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if f.TeamID != "" {
+		add("team_id = $%d", f.TeamID)
+	}
+	if len(f.ExcludeArticleIDs) > 0 {
+		add("article_id <> ALL($%d)", f.ExcludeArticleIDs)
+	}
+	if !f.PublishedSince.IsZero() {
+		add("published >= $%d", f.PublishedSince)
+	}
+	if !f.IncludeWithdrawn {
+		add("state <> ALL($%d)", hiddenStates)
+	}
+	if f.MinReadingTime > 0 {
+		add("reading_time >= $%d", f.MinReadingTime)
+	}
+	if f.MaxReadingTime > 0 {
+		add("reading_time <= $%d", f.MaxReadingTime)
+	}
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// scanArticle reads an article from a row of the articleColumns.
+func scanArticle(row pgx.Row) (*Article, error) {
+	var a Article
+	var id string
+	err := row.Scan(&id, &a.TeamID, &a.ArticleID, &a.OptaMatchID, &a.Title, &a.Type, &a.Teaser, &a.Content,
+		&a.ContentText, &a.ContentMarkdown, &a.WordCount, &a.ReadingTime, &a.Excerpt, &a.URL, &a.ImageURL,
+		&a.GalleryURLs, &a.VideoURL, &a.Published, &a.LastUpdated, &a.State)
+	if err != nil {
+		return nil, err
+	}
+	if a.ID, err = primitive.ObjectIDFromHex(id); err != nil {
+		return nil, err
+	}
+	a.Published = a.Published.UTC()
+	a.LastUpdated = a.LastUpdated.UTC()
+	return &a, nil
+}
+
+// queryArticles runs a query returning rows of the articleColumns and reads the articles from them.
+func (r postgresArticleRepository) queryArticles(ctx context.Context, query string, args ...interface{}) ([]*Article, error) {
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		log.Error("Could not get articles from the database. Error: ", err)
+		return nil, err
+	}
+	defer rows.Close()
+	articles := make([]*Article, 0)
+	for rows.Next() {
+		article, err := scanArticle(rows)
+		if err != nil {
+			log.Error("Could not decode articles. Error: ", err)
+			return nil, err
+		}
+		articles = append(articles, article)
+	}
+	return articles, rows.Err()
+}
+
+// FindByID retrieves an article from the database based on its ID.
+func (r postgresArticleRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*Article, error) {
+	ctx, cancel := db.WithPostgresTimeout(ctx)
+	defer cancel()
+	query := "SELECT " + strings.Join(articleColumns, ", ") + " FROM articles WHERE id = $1"
+	article, err := scanArticle(r.pool.QueryRow(ctx, query, id.Hex()))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		log.Errorf("could not find article with ID: %v, error: %v", id.Hex(), err)
+		return nil, err
+	}
+	return article, nil
+}
+
+// FindByArticleIDs retrieves the articles of a team with the given upstream IDs from the database.
+func (r postgresArticleRepository) FindByArticleIDs(ctx context.Context, teamID string, articleIDs []string) ([]Article, error) {
+	ctx, cancel := db.WithPostgresTimeout(ctx)
+	defer cancel()
+	if len(articleIDs) == 0 {
+		return nil, nil
+	}
+	query := "SELECT " + strings.Join(articleColumns, ", ") + " FROM articles WHERE team_id = $1 AND article_id = ANY($2)"
+	found, err := r.queryArticles(ctx, query, teamID, articleIDs)
+	if err != nil {
+		return nil, err
+	}
+	var articles []Article
+	for _, a := range found {
+		articles = append(articles, *a)
+	}
+	return articles, nil
+}
+
+// List retrieves the articles matching the filter from the database, in the order they were added.
+func (r postgresArticleRepository) List(ctx context.Context, filter ArticleFilter) ([]*Article, error) {
+	ctx, cancel := db.WithPostgresTimeout(ctx)
+	defer cancel()
+	where, args := filter.toSQL()
+	query := "SELECT " + strings.Join(articleColumns, ", ") + " FROM articles" + where + " ORDER BY id"
+	return r.queryArticles(ctx, query, args...)
+}
+
+// upsertArticleQuery inserts an article, or overwrites the stored article with the same team and upstream ID when
+// any of its fields differ. It returns whether the article was inserted, and no row when nothing changed.
+var upsertArticleQuery = func() string {
+	var placeholders, updates, stored, excluded []string
+	for i, column := range articleColumns {
+		placeholders = append(placeholders, fmt.Sprintf("$%d", i+1))
+		if column == "id" {
+			continue
+		}
+		updates = append(updates, column+" = EXCLUDED."+column)
+		stored = append(stored, "articles."+column)
+		excluded = append(excluded, "EXCLUDED."+column)
+	}
+	return "INSERT INTO articles (" + strings.Join(articleColumns, ", ") + ") VALUES (" + strings.Join(placeholders, ", ") + ")" +
+		" ON CONFLICT (team_id, article_id) DO UPDATE SET " + strings.Join(updates, ", ") +
+		" WHERE (" + strings.Join(stored, ", ") + ") IS DISTINCT FROM (" + strings.Join(excluded, ", ") + ")" +
+		" RETURNING (xmax = 0)"
+}()
+
+// Upsert upserts the articles into the database in a single transaction, keyed on their TeamID and ArticleID.
+func (r postgresArticleRepository) Upsert(ctx context.Context, articles []Article) (int, int, error) {
+	ctx, cancel := db.WithPostgresTimeout(ctx)
+	defer cancel()
+	if len(articles) == 0 {
+		return 0, 0, nil
+	}
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	batch := &pgx.Batch{}
+	for _, a := range articles {
+		id := a.ID
+		if id.IsZero() {
+			id = primitive.NewObjectID()
+		}
+		batch.Queue(upsertArticleQuery, id.Hex(), a.TeamID, a.ArticleID, a.OptaMatchID, a.Title, a.Type, a.Teaser,
+			a.Content, a.ContentText, a.ContentMarkdown, a.WordCount, a.ReadingTime, a.Excerpt, a.URL, a.ImageURL,
+			a.GalleryURLs, a.VideoURL, a.Published, a.LastUpdated, a.State)
+	}
+	results := tx.SendBatch(ctx, batch)
+	added, changed := 0, 0
+	for range articles {
+		var inserted bool
+		err := results.QueryRow().Scan(&inserted)
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+		case err != nil:
+			results.Close()
+			log.Println("Failed to insert article to the DB: ", err)
+			return 0, 0, err
+		case inserted:
+			added++
+		default:
+			changed++
+		}
+	}
+	if err := results.Close(); err != nil {
+		return 0, 0, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		log.Println("Failed to insert article to the DB: ", err)
+		return 0, 0, err
+	}
+	return added, changed, nil
+}
+
+// SetState sets the publication state of the given articles of a team in the database.
+func (r postgresArticleRepository) SetState(ctx context.Context, teamID string, articleIDs []string, state string) (int, error) {
+	ctx, cancel := db.WithPostgresTimeout(ctx)
+	defer cancel()
+	query := "UPDATE articles SET state = $3 WHERE team_id = $1 AND article_id = ANY($2) AND state <> $3"
+	result, err := r.pool.Exec(ctx, query, teamID, articleIDs, state)
+	if err != nil {
+		log.Printf("Failed to set the state of articles to %v in the DB: %v", state, err)
+		return 0, err
+	}
+	return int(result.RowsAffected()), nil
+}
+
+// Delete removes the given articles of a team from the database.
+func (r postgresArticleRepository) Delete(ctx context.Context, teamID string, articleIDs []string) (int, error) {
+	ctx, cancel := db.WithPostgresTimeout(ctx)
+	defer cancel()
+	result, err := r.pool.Exec(ctx, "DELETE FROM articles WHERE team_id = $1 AND article_id = ANY($2)", teamID, articleIDs)
+	if err != nil {
+		log.Println("Failed to delete articles from the DB: ", err)
+		return 0, err
+	}
+	return int(result.RowsAffected()), nil
+}
+
+// MoveTeam moves the articles of a team to another team in a single transaction, removing the copies of the
+// articles the other team has as well.
+func (r postgresArticleRepository) MoveTeam(ctx context.Context, fromTeamID string, toTeamID string) (int, int, error) {
+	ctx, cancel := db.WithPostgresTimeout(ctx)
+	defer cancel()
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	query := "DELETE FROM articles WHERE team_id = $1 AND article_id IN (SELECT article_id FROM articles WHERE team_id = $2)"
+	removed, err := tx.Exec(ctx, query, fromTeamID, toTeamID)
+	if err != nil {
+		log.Println("Failed to delete articles from the DB: ", err)
+		return 0, 0, err
+	}
+	moved, err := tx.Exec(ctx, "UPDATE articles SET team_id = $2 WHERE team_id = $1", fromTeamID, toTeamID)
+	if err != nil {
+		log.Println("Failed to move articles in the DB: ", err)
+		return 0, 0, err
+	}
+	return int(moved.RowsAffected()), int(removed.RowsAffected()), tx.Commit(ctx)
+}
+
+// Add numbers the revisions after the latest revision of their article and stores them in a single transaction.
+func (r postgresRevisionRepository) Add(ctx context.Context, revisions []ArticleRevision) error {
+	ctx, cancel := db.WithPostgresTimeout(ctx)
+	defer cancel()
+	if len(revisions) == 0 {
+		return nil
+	}
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	for _, revision := range revisions {
+		article, err := bson.MarshalExtJSON(revision.Article, false, false)
+		if err != nil {
+			return err
+		}
+		id := revision.ID
+		if id.IsZero() {
+			id = primitive.NewObjectID()
+		}
+		query := "INSERT INTO article_revisions (" + revisionColumns + ")" +
+			" SELECT $1::text, $2::text, COALESCE(MAX(revision), 0) + 1, $3::timestamptz, $4::text[], $5::jsonb FROM article_revisions WHERE article_ref = $2"
+		if _, err := tx.Exec(ctx, query, id.Hex(), revision.ArticleRef.Hex(), revision.CreatedAt, revision.ChangedFields, article); err != nil {
+			log.Error("Could not store article revisions. Error: ", err)
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// scanRevision reads a revision from a row of the revisionColumns.
+func scanRevision(row pgx.Row) (*ArticleRevision, error) {
+	var revision ArticleRevision
+	var id, articleRef string
+	var article []byte
+	if err := row.Scan(&id, &articleRef, &revision.Revision, &revision.CreatedAt, &revision.ChangedFields, &article); err != nil {
+		return nil, err
+	}
+	var err error
+	if revision.ID, err = primitive.ObjectIDFromHex(id); err != nil {
+		return nil, err
+	}
+	if revision.ArticleRef, err = primitive.ObjectIDFromHex(articleRef); err != nil {
+		return nil, err
+	}
+	if err := bson.UnmarshalExtJSON(article, false, &revision.Article); err != nil {
+		return nil, err
+	}
+	revision.CreatedAt = revision.CreatedAt.UTC()
+	return &revision, nil
+}
+
+// queryRevisions runs a query returning rows of the revisionColumns and reads the revisions from them.
+func (r postgresRevisionRepository) queryRevisions(ctx context.Context, query string, args ...interface{}) ([]*ArticleRevision, error) {
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		log.Error("Could not get article revisions from the database. Error: ", err)
+		return nil, err
+	}
+	defer rows.Close()
+	revisions := make([]*ArticleRevision, 0)
+	for rows.Next() {
+		revision, err := scanRevision(rows)
+		if err != nil {
+			log.Error("Could not decode article revisions. Error: ", err)
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, rows.Err()
+}
+
+// List retrieves all revisions of an article from the database, oldest first.
+func (r postgresRevisionRepository) List(ctx context.Context, articleRef primitive.ObjectID) ([]*ArticleRevision, error) {
+	ctx, cancel := db.WithPostgresTimeout(ctx)
+	defer cancel()
+	query := "SELECT " + revisionColumns + " FROM article_revisions WHERE article_ref = $1 ORDER BY revision"
+	return r.queryRevisions(ctx, query, articleRef.Hex())
+}
+
+// Find retrieves the revisions of an article with the given numbers from the database.
+func (r postgresRevisionRepository) Find(ctx context.Context, articleRef primitive.ObjectID, numbers []int) ([]ArticleRevision, error) {
+	ctx, cancel := db.WithPostgresTimeout(ctx)
+	defer cancel()
+	query := "SELECT " + revisionColumns + " FROM article_revisions WHERE article_ref = $1 AND revision = ANY($2)"
+	found, err := r.queryRevisions(ctx, query, articleRef.Hex(), numbers)
+	if err != nil {
+		return nil, err
+	}
+	var revisions []ArticleRevision
+	for _, revision := range found {
+		revisions = append(revisions, *revision)
+	}
+	return revisions, nil
+}
+
+// Save upserts the failed articles into the failed_articles table, keyed on their TeamID and ArticleID.
+func (r postgresFailureRepository) Save(ctx context.Context, failures []FailedArticle) error {
+	ctx, cancel := db.WithPostgresTimeout(ctx)
+	defer cancel()
+	if len(failures) == 0 {
+		return nil
+	}
+	query := "INSERT INTO failed_articles (" + failureColumns + ") VALUES ($1, $2, $3, $4, $5, $6, $7)" +
+		" ON CONFLICT (team_id, article_id) DO UPDATE SET error = EXCLUDED.error, attempts = EXCLUDED.attempts," +
+		" last_attempt = EXCLUDED.last_attempt, next_retry = EXCLUDED.next_retry"
+	batch := &pgx.Batch{}
+	for _, f := range failures {
+		id := f.ID
+		if id.IsZero() {
+			id = primitive.NewObjectID()
+		}
+		batch.Queue(query, id.Hex(), f.TeamID, f.ArticleID, f.Error, f.Attempts, f.LastAttempt, f.NextRetry)
+	}
+	if err := r.pool.SendBatch(ctx, batch).Close(); err != nil {
+		log.Println("Failed to store failed articles to the DB: ", err)
+		return err
+	}
+	return nil
+}
+
+// Delete removes the given articles of a team from the failed_articles table.
+func (r postgresFailureRepository) Delete(ctx context.Context, teamID string, articleIDs []string) error {
+	ctx, cancel := db.WithPostgresTimeout(ctx)
+	defer cancel()
+	if len(articleIDs) == 0 {
+		return nil
+	}
+	if _, err := r.pool.Exec(ctx, "DELETE FROM failed_articles WHERE team_id = $1 AND article_id = ANY($2)", teamID, articleIDs); err != nil {
+		log.Println("Failed to clear failed articles in the DB: ", err)
+		return err
+	}
+	return nil
+}
+
+// List retrieves the failed articles of a team, or of all teams when teamID is empty, ordered by their next retry time.
+func (r postgresFailureRepository) List(ctx context.Context, teamID string) ([]*FailedArticle, error) {
+	ctx, cancel := db.WithPostgresTimeout(ctx)
+	defer cancel()
+	query := "SELECT " + failureColumns + " FROM failed_articles WHERE $1 = '' OR team_id = $1 ORDER BY next_retry"
+	rows, err := r.pool.Query(ctx, query, teamID)
+	if err != nil {
+		log.Error("Could not get failed articles from the database. Error: ", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	failures := make([]*FailedArticle, 0)
+	for rows.Next() {
+		var f FailedArticle
+		var id string
+		if err := rows.Scan(&id, &f.TeamID, &f.ArticleID, &f.Error, &f.Attempts, &f.LastAttempt, &f.NextRetry); err != nil {
+			log.Error("Could not decode failed articles. Error: ", err)
+			return nil, err
+		}
+		if f.ID, err = primitive.ObjectIDFromHex(id); err != nil {
+			return nil, err
+		}
+		f.LastAttempt = f.LastAttempt.UTC()
+		f.NextRetry = f.NextRetry.UTC()
+		failures = append(failures, &f)
+	}
+	return failures, rows.Err()
+}
+
+// scanFeedState reads the state of a feed from a row of the feedColumns.
+func scanFeedState(row pgx.Row) (*FeedState, error) {
+	var state FeedState
+	var backfill []byte
+	if err := row.Scan(&state.ClubKey, &state.ETag, &state.LastModified, &state.SkippedPolls, &state.LastPolled, &backfill, &state.Paused); err != nil {
+		return nil, err
+	}
+	if backfill != nil {
+		if err := json.Unmarshal(backfill, &state.Backfill); err != nil {
+			return nil, err
+		}
+	}
+	state.LastPolled = state.LastPolled.UTC()
+	return &state, nil
+}
+
+// Get retrieves the state of the given feed. A feed that was never polled gets an empty state.
+func (r postgresFeedStateRepository) Get(ctx context.Context, clubKey string) (*FeedState, error) {
+	ctx, cancel := db.WithPostgresTimeout(ctx)
+	defer cancel()
+	state, err := scanFeedState(r.pool.QueryRow(ctx, "SELECT "+feedColumns+" FROM feed_states WHERE club_key = $1", clubKey))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return &FeedState{ClubKey: clubKey}, nil
+	}
+	if err != nil {
+		log.Errorf("could not get state of feed %v, error: %v", clubKey, err)
+		return nil, err
+	}
+	return state, nil
+}
+
+// List retrieves the states of all feeds that were polled at least once.
+func (r postgresFeedStateRepository) List(ctx context.Context) ([]*FeedState, error) {
+	ctx, cancel := db.WithPostgresTimeout(ctx)
+	defer cancel()
+	rows, err := r.pool.Query(ctx, "SELECT "+feedColumns+" FROM feed_states ORDER BY club_key")
+	if err != nil {
+		log.Error("Could not get feed states from the database. Error: ", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	states := make([]*FeedState, 0)
+	for rows.Next() {
+		state, err := scanFeedState(rows)
+		if err != nil {
+			log.Error("Could not decode feed states. Error: ", err)
+			return nil, err
+		}
+		states = append(states, state)
+	}
+	return states, rows.Err()
+}
+
+// SaveValidators stores the ETag and Last-Modified values of the last processed list response of a feed.
+func (r postgresFeedStateRepository) SaveValidators(ctx context.Context, clubKey string, etag string, lastModified string, polled time.Time) error {
+	ctx, cancel := db.WithPostgresTimeout(ctx)
+	defer cancel()
+	query := "INSERT INTO feed_states (club_key, etag, last_modified, last_polled) VALUES ($1, $2, $3, $4)" +
+		" ON CONFLICT (club_key) DO UPDATE SET etag = EXCLUDED.etag, last_modified = EXCLUDED.last_modified, last_polled = EXCLUDED.last_polled"
+	return r.updateFeedState(ctx, clubKey, query, clubKey, etag, lastModified, polled)
+}
+
+// IncrementSkippedPolls counts a poll of the feed that was answered with 304 Not Modified.
+func (r postgresFeedStateRepository) IncrementSkippedPolls(ctx context.Context, clubKey string, polled time.Time) error {
+	ctx, cancel := db.WithPostgresTimeout(ctx)
+	defer cancel()
+	query := "INSERT INTO feed_states (club_key, skipped_polls, last_polled) VALUES ($1, 1, $2)" +
+		" ON CONFLICT (club_key) DO UPDATE SET skipped_polls = feed_states.skipped_polls + 1, last_polled = EXCLUDED.last_polled"
+	return r.updateFeedState(ctx, clubKey, query, clubKey, polled)
+}
+
+// SaveBackfill stores the progress of a feed's backfill.
+func (r postgresFeedStateRepository) SaveBackfill(ctx context.Context, clubKey string, checkpoint *BackfillCheckpoint) error {
+	ctx, cancel := db.WithPostgresTimeout(ctx)
+	defer cancel()
+	backfill, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	query := "INSERT INTO feed_states (club_key, backfill) VALUES ($1, $2)" +
+		" ON CONFLICT (club_key) DO UPDATE SET backfill = EXCLUDED.backfill"
+	return r.updateFeedState(ctx, clubKey, query, clubKey, backfill)
+}
+
+// SetPaused stores whether the schedule of a feed is paused.
+func (r postgresFeedStateRepository) SetPaused(ctx context.Context, clubKey string, paused bool) error {
+	ctx, cancel := db.WithPostgresTimeout(ctx)
+	defer cancel()
+	query := "INSERT INTO feed_states (club_key, paused) VALUES ($1, $2)" +
+		" ON CONFLICT (club_key) DO UPDATE SET paused = EXCLUDED.paused"
+	return r.updateFeedState(ctx, clubKey, query, clubKey, paused)
+}
+
+// Save replaces the state of a feed.
+func (r postgresFeedStateRepository) Save(ctx context.Context, state *FeedState) error {
+	ctx, cancel := db.WithPostgresTimeout(ctx)
+	defer cancel()
+	var backfill []byte
+	if state.Backfill != nil {
+		var err error
+		if backfill, err = json.Marshal(state.Backfill); err != nil {
+			return err
+		}
+	}
+	query := "INSERT INTO feed_states (" + feedColumns + ") VALUES ($1, $2, $3, $4, $5, $6, $7)" +
+		" ON CONFLICT (club_key) DO UPDATE SET etag = EXCLUDED.etag, last_modified = EXCLUDED.last_modified," +
+		" skipped_polls = EXCLUDED.skipped_polls, last_polled = EXCLUDED.last_polled, backfill = EXCLUDED.backfill, paused = EXCLUDED.paused"
+	return r.updateFeedState(ctx, state.ClubKey, query, state.ClubKey, state.ETag, state.LastModified, state.SkippedPolls,
+		state.LastPolled, backfill, state.Paused)
+}
+
+// updateFeedState runs an upsert of the state of a feed.
+func (r postgresFeedStateRepository) updateFeedState(ctx context.Context, clubKey string, query string, args ...interface{}) error {
+	if _, err := r.pool.Exec(ctx, query, args...); err != nil {
+		log.Errorf("could not update state of feed %v, error: %v", clubKey, err)
+		return err
+	}
+	return nil
+}
+
+// Save stores the record of an ingestion run in the ingestion_runs table, replacing the stored run with the same ID.
+// Adding a run removes the expired runs.
+func (r postgresRunRepository) Save(ctx context.Context, run *IngestionRun) error {
+	ctx, cancel := db.WithPostgresTimeout(ctx)
+	defer cancel()
+	id := run.ID
+	if id.IsZero() {
+		id = primitive.NewObjectID()
+		expiry := time.Now().Add(-config.Conf.Ingestion.RunRetentionDuration())
+		if _, err := r.pool.Exec(ctx, "DELETE FROM ingestion_runs WHERE started_at < $1", expiry); err != nil {
+			log.Errorf("could not remove expired ingestion runs, error: %v", err)
+			return err
+		}
+	}
+	query := "INSERT INTO ingestion_runs (" + runColumns + ") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)" +
+		runConflictUpdate
+	_, err := r.pool.Exec(ctx, query, id.Hex(), run.Feed, run.Trigger, run.ArticleID, run.StartedAt, run.FinishedAt,
+		run.HTTPStatus, run.Seen, run.New, run.Updated, run.Failed, run.Withdrawn, run.Error)
+	if err != nil {
+		log.Errorf("could not store ingestion run of %v, error: %v", run.Feed, err)
+		return err
+	}
+	run.ID = id
+	return nil
+}
+
+// queryRuns runs a query returning rows of the runColumns and reads the runs from them.
+func (r postgresRunRepository) queryRuns(ctx context.Context, query string, args ...interface{}) ([]*IngestionRun, error) {
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		log.Error("Could not get ingestion runs from the database. Error: ", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := make([]*IngestionRun, 0)
+	for rows.Next() {
+		var run IngestionRun
+		var id string
+		err := rows.Scan(&id, &run.Feed, &run.Trigger, &run.ArticleID, &run.StartedAt, &run.FinishedAt, &run.HTTPStatus,
+			&run.Seen, &run.New, &run.Updated, &run.Failed, &run.Withdrawn, &run.Error)
+		if err != nil {
+			log.Error("Could not decode ingestion runs. Error: ", err)
+			return nil, err
+		}
+		if run.ID, err = primitive.ObjectIDFromHex(id); err != nil {
+			return nil, err
+		}
+		run.StartedAt = run.StartedAt.UTC()
+		run.FinishedAt = run.FinishedAt.UTC()
+		runs = append(runs, &run)
+	}
+	return runs, rows.Err()
+}
+
+// List retrieves a page of the ingestion runs of a feed, or of all feeds when feed is empty, newest first.
+func (r postgresRunRepository) List(ctx context.Context, feed string, page int, pageSize int) ([]*IngestionRun, int64, error) {
+	ctx, cancel := db.WithPostgresTimeout(ctx)
+	defer cancel()
+	var total int64
+	if err := r.pool.QueryRow(ctx, "SELECT COUNT(*) FROM ingestion_runs WHERE $1 = '' OR feed = $1", feed).Scan(&total); err != nil {
+		log.Error("Could not count ingestion runs in the database. Error: ", err)
+		return nil, 0, err
+	}
+	query := "SELECT " + runColumns + " FROM ingestion_runs WHERE $1 = '' OR feed = $1 ORDER BY started_at DESC LIMIT $2 OFFSET $3"
+	runs, err := r.queryRuns(ctx, query, feed, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	return runs, total, nil
+}
+
+// LastSuccessful returns the last successful ingestion run of every feed.
+func (r postgresRunRepository) LastSuccessful(ctx context.Context) (map[string]*IngestionRun, error) {
+	ctx, cancel := db.WithPostgresTimeout(ctx)
+	defer cancel()
+	query := "SELECT DISTINCT ON (feed) " + runColumns + " FROM ingestion_runs WHERE error = '' AND trigger <> $1 ORDER BY feed, started_at DESC"
+	runs, err := r.queryRuns(ctx, query, runTriggerRefresh)
+	if err != nil {
+		return nil, err
+	}
+	runsByFeed := make(map[string]*IngestionRun)
+	for _, run := range runs {
+		runsByFeed[run.Feed] = run
+	}
+	return runsByFeed, nil
+}
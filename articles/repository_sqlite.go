@@ -0,0 +1,813 @@
+package articles
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/SkaisgirisMarius/article-processor/config"
+	"github.com/SkaisgirisMarius/article-processor/db"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"strings"
+	"time"
+)
+
+// sqliteSchema creates the tables of the SQLite backend. They mirror the tables of the PostgreSQL backend: the
+// taxonomies and gallery image URLs are stored as JSON arrays, and times as text in db.SQLiteTimeLayout so that
+// they sort and compare in time order.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS articles (
+	id               TEXT PRIMARY KEY,
+	team_id          TEXT NOT NULL,
+	article_id       TEXT NOT NULL,
+	opta_match_id    TEXT,
+	title            TEXT NOT NULL DEFAULT '',
+	type             TEXT,
+	teaser           TEXT,
+	content          TEXT NOT NULL DEFAULT '',
+	content_text     TEXT NOT NULL DEFAULT '',
+	content_markdown TEXT NOT NULL DEFAULT '',
+	word_count       INTEGER NOT NULL DEFAULT 0,
+	reading_time     INTEGER NOT NULL DEFAULT 0,
+	excerpt          TEXT NOT NULL DEFAULT '',
+	url              TEXT NOT NULL DEFAULT '',
+	image_url        TEXT NOT NULL DEFAULT '',
+	gallery_urls     TEXT,
+	video_url        TEXT,
+	published        TEXT NOT NULL,
+	last_updated     TEXT NOT NULL,
+	state            TEXT NOT NULL DEFAULT '',
+	UNIQUE (team_id, article_id)
+);
+
+CREATE TABLE IF NOT EXISTS article_revisions (
+	id             TEXT PRIMARY KEY,
+	article_ref    TEXT NOT NULL,
+	revision       INTEGER NOT NULL,
+	created_at     TEXT NOT NULL,
+	changed_fields TEXT,
+	article        TEXT NOT NULL,
+	UNIQUE (article_ref, revision)
+);
+
+CREATE TABLE IF NOT EXISTS failed_articles (
+	id           TEXT PRIMARY KEY,
+	team_id      TEXT NOT NULL,
+	article_id   TEXT NOT NULL,
+	error        TEXT NOT NULL DEFAULT '',
+	attempts     INTEGER NOT NULL DEFAULT 0,
+	last_attempt TEXT NOT NULL,
+	next_retry   TEXT NOT NULL,
+	UNIQUE (team_id, article_id)
+);
+
+CREATE TABLE IF NOT EXISTS feed_states (
+	club_key      TEXT PRIMARY KEY,
+	etag          TEXT NOT NULL DEFAULT '',
+	last_modified TEXT NOT NULL DEFAULT '',
+	skipped_polls INTEGER NOT NULL DEFAULT 0,
+	last_polled   TEXT NOT NULL DEFAULT '0001-01-01T00:00:00.000000000Z',
+	backfill      TEXT,
+	paused        INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS ingestion_runs (
+	id          TEXT PRIMARY KEY,
+	feed        TEXT NOT NULL,
+	trigger     TEXT NOT NULL,
+	article_id  TEXT NOT NULL DEFAULT '',
+	started_at  TEXT NOT NULL,
+	finished_at TEXT NOT NULL,
+	http_status INTEGER NOT NULL DEFAULT 0,
+	seen        INTEGER NOT NULL DEFAULT 0,
+	added       INTEGER NOT NULL DEFAULT 0,
+	updated     INTEGER NOT NULL DEFAULT 0,
+	failed      INTEGER NOT NULL DEFAULT 0,
+	withdrawn   INTEGER NOT NULL DEFAULT 0,
+	error       TEXT NOT NULL DEFAULT ''
+);
+`
+
+type sqliteArticleRepository struct {
+	database *sql.DB
+}
+
+type sqliteRevisionRepository struct {
+	database *sql.DB
+}
+
+type sqliteFailureRepository struct {
+	database *sql.DB
+}
+
+type sqliteFeedStateRepository struct {
+	database *sql.DB
+}
+
+type sqliteRunRepository struct {
+	database *sql.DB
+}
+
+// sqliteRow is a row of a query result, either a single row or the current row of several.
+type sqliteRow interface {
+	Scan(dest ...interface{}) error
+}
+
+// NewSQLiteStorage returns the storage backed by the given SQLite database, creating its tables if needed.
+func NewSQLiteStorage(ctx context.Context, database *sql.DB) (*Storage, error) {
+	if _, err := database.ExecContext(ctx, sqliteSchema); err != nil {
+		log.Error("Could not create the SQLite schema. Error: ", err)
+		return nil, err
+	}
+	return &Storage{
+		Articles:   sqliteArticleRepository{database: database},
+		Revisions:  sqliteRevisionRepository{database: database},
+		Failures:   sqliteFailureRepository{database: database},
+		FeedStates: sqliteFeedStateRepository{database: database},
+		Runs:       sqliteRunRepository{database: database},
+	}, nil
+}
+
+// sqliteArray encodes a slice of strings or numbers as a JSON array, the form in which lists are stored and
+// passed to json_each.
+func sqliteArray(values interface{}) string {
+	data, _ := json.Marshal(values)
+	return string(data)
+}
+
+// sqliteList encodes a list column, a nil list is stored as NULL.
+func sqliteList(values []string) interface{} {
+	if values == nil {
+		return nil
+	}
+	return sqliteArray(values)
+}
+
+// parseSQLiteList decodes a list column.
+func parseSQLiteList(value sql.NullString) ([]string, error) {
+	if !value.Valid {
+		return nil, nil
+	}
+	var values []string
+	err := json.Unmarshal([]byte(value.String), &values)
+	return values, err
+}
+
+// parseSQLiteTimes parses the stored times into the given destinations.
+func parseSQLiteTimes(values map[*time.Time]string) error {
+	for dest, value := range values {
+		parsed, err := db.ParseSQLiteTime(value)
+		if err != nil {
+			return err
+		}
+		*dest = parsed
+	}
+	return nil
+}
+
+// toSQLite converts the filter to a WHERE clause of the articles table and its arguments.
+func (f ArticleFilter) toSQLite() (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	add := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if f.TeamID != "" {
+		add("team_id = ?%d", f.TeamID)
+	}
+	if len(f.ExcludeArticleIDs) > 0 {
+		add("article_id NOT IN (SELECT value FROM json_each(?%d))", sqliteArray(f.ExcludeArticleIDs))
+	}
+	if !f.PublishedSince.IsZero() {
+		add("published >= ?%d", db.SQLiteTime(f.PublishedSince))
+	}
+	if !f.IncludeWithdrawn {
+		add("state NOT IN (SELECT value FROM json_each(?%d))", sqliteArray(hiddenStates))
+	}
+	if f.MinReadingTime > 0 {
+		add("reading_time >= ?%d", f.MinReadingTime)
+	}
+	if f.MaxReadingTime > 0 {
+		add("reading_time <= ?%d", f.MaxReadingTime)
+	}
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// scanSQLiteArticle reads an article from a row of the articleColumns.
+func scanSQLiteArticle(row sqliteRow) (*Article, error) {
+	var a Article
+	var id, published, lastUpdated string
+	var types, galleryURLs sql.NullString
+	err := row.Scan(&id, &a.TeamID, &a.ArticleID, &a.OptaMatchID, &a.Title, &types, &a.Teaser, &a.Content,
+		&a.ContentText, &a.ContentMarkdown, &a.WordCount, &a.ReadingTime, &a.Excerpt, &a.URL, &a.ImageURL,
+		&galleryURLs, &a.VideoURL, &published, &lastUpdated, &a.State)
+	if err != nil {
+		return nil, err
+	}
+	if a.ID, err = primitive.ObjectIDFromHex(id); err != nil {
+		return nil, err
+	}
+	if a.Type, err = parseSQLiteList(types); err != nil {
+		return nil, err
+	}
+	if a.GalleryURLs, err = parseSQLiteList(galleryURLs); err != nil {
+		return nil, err
+	}
+	if err := parseSQLiteTimes(map[*time.Time]string{&a.Published: published, &a.LastUpdated: lastUpdated}); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// queryArticles runs a query returning rows of the articleColumns and reads the articles from them.
+func (r sqliteArticleRepository) queryArticles(ctx context.Context, query string, args ...interface{}) ([]*Article, error) {
+	rows, err := r.database.QueryContext(ctx, query, args...)
+	if err != nil {
+		log.Error("Could not get articles from the database. Error: ", err)
+		return nil, err
+	}
+	defer rows.Close()
+	articles := make([]*Article, 0)
+	for rows.Next() {
+		article, err := scanSQLiteArticle(rows)
+		if err != nil {
+			log.Error("Could not decode articles. Error: ", err)
+			return nil, err
+		}
+		articles = append(articles, article)
+	}
+	return articles, rows.Err()
+}
+
+// FindByID retrieves an article from the database based on its ID.
+func (r sqliteArticleRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*Article, error) {
+	ctx, cancel := db.WithSQLiteTimeout(ctx)
+	defer cancel()
+	query := "SELECT " + strings.Join(articleColumns, ", ") + " FROM articles WHERE id = ?1"
+	article, err := scanSQLiteArticle(r.database.QueryRowContext(ctx, query, id.Hex()))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		log.Errorf("could not find article with ID: %v, error: %v", id.Hex(), err)
+		return nil, err
+	}
+	return article, nil
+}
+
+// FindByArticleIDs retrieves the articles of a team with the given upstream IDs from the database.
+func (r sqliteArticleRepository) FindByArticleIDs(ctx context.Context, teamID string, articleIDs []string) ([]Article, error) {
+	ctx, cancel := db.WithSQLiteTimeout(ctx)
+	defer cancel()
+	if len(articleIDs) == 0 {
+		return nil, nil
+	}
+	query := "SELECT " + strings.Join(articleColumns, ", ") + " FROM articles" +
+		" WHERE team_id = ?1 AND article_id IN (SELECT value FROM json_each(?2))"
+	found, err := r.queryArticles(ctx, query, teamID, sqliteArray(articleIDs))
+	if err != nil {
+		return nil, err
+	}
+	var articles []Article
+	for _, a := range found {
+		articles = append(articles, *a)
+	}
+	return articles, nil
+}
+
+// List retrieves the articles matching the filter from the database, in the order they were added.
+func (r sqliteArticleRepository) List(ctx context.Context, filter ArticleFilter) ([]*Article, error) {
+	ctx, cancel := db.WithSQLiteTimeout(ctx)
+	defer cancel()
+	where, args := filter.toSQLite()
+	query := "SELECT " + strings.Join(articleColumns, ", ") + " FROM articles" + where + " ORDER BY id"
+	return r.queryArticles(ctx, query, args...)
+}
+
+// sqliteUpsertArticleQuery inserts an article, or overwrites the stored article with the same team and upstream ID
+// when any of its fields differ.
+var sqliteUpsertArticleQuery = func() string {
+	var placeholders, updates, differences []string
+	for i, column := range articleColumns {
+		placeholders = append(placeholders, fmt.Sprintf("?%d", i+1))
+		if column == "id" {
+			continue
+		}
+		updates = append(updates, column+" = EXCLUDED."+column)
+		differences = append(differences, "articles."+column+" IS NOT EXCLUDED."+column)
+	}
+	return "INSERT INTO articles (" + strings.Join(articleColumns, ", ") + ") VALUES (" + strings.Join(placeholders, ", ") + ")" +
+		" ON CONFLICT (team_id, article_id) DO UPDATE SET " + strings.Join(updates, ", ") +
+		" WHERE " + strings.Join(differences, " OR ")
+}()
+
+// Upsert upserts the articles into the database in a single transaction, keyed on their TeamID and ArticleID.
+func (r sqliteArticleRepository) Upsert(ctx context.Context, articles []Article) (int, int, error) {
+	ctx, cancel := db.WithSQLiteTimeout(ctx)
+	defer cancel()
+	if len(articles) == 0 {
+		return 0, 0, nil
+	}
+	tx, err := r.database.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	added, changed := 0, 0
+	for _, a := range articles {
+		var exists bool
+		query := "SELECT EXISTS (SELECT 1 FROM articles WHERE team_id = ?1 AND article_id = ?2)"
+		if err := tx.QueryRowContext(ctx, query, a.TeamID, a.ArticleID).Scan(&exists); err != nil {
+			log.Println("Failed to insert article to the DB: ", err)
+			return 0, 0, err
+		}
+		id := a.ID
+		if id.IsZero() {
+			id = primitive.NewObjectID()
+		}
+		result, err := tx.ExecContext(ctx, sqliteUpsertArticleQuery, id.Hex(), a.TeamID, a.ArticleID, a.OptaMatchID,
+			a.Title, sqliteList(a.Type), a.Teaser, a.Content, a.ContentText, a.ContentMarkdown, a.WordCount, a.ReadingTime,
+			a.Excerpt, a.URL, a.ImageURL, sqliteList(a.GalleryURLs), a.VideoURL, db.SQLiteTime(a.Published),
+			db.SQLiteTime(a.LastUpdated), a.State)
+		if err != nil {
+			log.Println("Failed to insert article to the DB: ", err)
+			return 0, 0, err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return 0, 0, err
+		}
+		switch {
+		case affected == 0:
+		case exists:
+			changed++
+		default:
+			added++
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Println("Failed to insert article to the DB: ", err)
+		return 0, 0, err
+	}
+	return added, changed, nil
+}
+
+// SetState sets the publication state of the given articles of a team in the database.
+func (r sqliteArticleRepository) SetState(ctx context.Context, teamID string, articleIDs []string, state string) (int, error) {
+	ctx, cancel := db.WithSQLiteTimeout(ctx)
+	defer cancel()
+	query := "UPDATE articles SET state = ?3 WHERE team_id = ?1 AND article_id IN (SELECT value FROM json_each(?2)) AND state <> ?3"
+	result, err := r.database.ExecContext(ctx, query, teamID, sqliteArray(articleIDs), state)
+	if err != nil {
+		log.Printf("Failed to set the state of articles to %v in the DB: %v", state, err)
+		return 0, err
+	}
+	affected, err := result.RowsAffected()
+	return int(affected), err
+}
+
+// Delete removes the given articles of a team from the database.
+func (r sqliteArticleRepository) Delete(ctx context.Context, teamID string, articleIDs []string) (int, error) {
+	ctx, cancel := db.WithSQLiteTimeout(ctx)
+	defer cancel()
+	query := "DELETE FROM articles WHERE team_id = ?1 AND article_id IN (SELECT value FROM json_each(?2))"
+	result, err := r.database.ExecContext(ctx, query, teamID, sqliteArray(articleIDs))
+	if err != nil {
+		log.Println("Failed to delete articles from the DB: ", err)
+		return 0, err
+	}
+	affected, err := result.RowsAffected()
+	return int(affected), err
+}
+
+// MoveTeam moves the articles of a team to another team in a single transaction, removing the copies of the
+// articles the other team has as well.
+func (r sqliteArticleRepository) MoveTeam(ctx context.Context, fromTeamID string, toTeamID string) (int, int, error) {
+	ctx, cancel := db.WithSQLiteTimeout(ctx)
+	defer cancel()
+	tx, err := r.database.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	query := "DELETE FROM articles WHERE team_id = ?1 AND article_id IN (SELECT article_id FROM articles WHERE team_id = ?2)"
+	removed, err := tx.ExecContext(ctx, query, fromTeamID, toTeamID)
+	if err != nil {
+		log.Println("Failed to delete articles from the DB: ", err)
+		return 0, 0, err
+	}
+	moved, err := tx.ExecContext(ctx, "UPDATE articles SET team_id = ?2 WHERE team_id = ?1", fromTeamID, toTeamID)
+	if err != nil {
+		log.Println("Failed to move articles in the DB: ", err)
+		return 0, 0, err
+	}
+	removedCount, err := removed.RowsAffected()
+	if err != nil {
+		return 0, 0, err
+	}
+	movedCount, err := moved.RowsAffected()
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(movedCount), int(removedCount), tx.Commit()
+}
+
+// Add numbers the revisions after the latest revision of their article and stores them in a single transaction.
+func (r sqliteRevisionRepository) Add(ctx context.Context, revisions []ArticleRevision) error {
+	ctx, cancel := db.WithSQLiteTimeout(ctx)
+	defer cancel()
+	if len(revisions) == 0 {
+		return nil
+	}
+	tx, err := r.database.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, revision := range revisions {
+		article, err := bson.MarshalExtJSON(revision.Article, false, false)
+		if err != nil {
+			return err
+		}
+		id := revision.ID
+		if id.IsZero() {
+			id = primitive.NewObjectID()
+		}
+		query := "INSERT INTO article_revisions (" + revisionColumns + ")" +
+			" SELECT ?1, ?2, COALESCE(MAX(revision), 0) + 1, ?3, ?4, ?5 FROM article_revisions WHERE article_ref = ?2"
+		_, err = tx.ExecContext(ctx, query, id.Hex(), revision.ArticleRef.Hex(), db.SQLiteTime(revision.CreatedAt),
+			sqliteList(revision.ChangedFields), string(article))
+		if err != nil {
+			log.Error("Could not store article revisions. Error: ", err)
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// queryRevisions runs a query returning rows of the revisionColumns and reads the revisions from them.
+func (r sqliteRevisionRepository) queryRevisions(ctx context.Context, query string, args ...interface{}) ([]*ArticleRevision, error) {
+	rows, err := r.database.QueryContext(ctx, query, args...)
+	if err != nil {
+		log.Error("Could not get article revisions from the database. Error: ", err)
+		return nil, err
+	}
+	defer rows.Close()
+	revisions := make([]*ArticleRevision, 0)
+	for rows.Next() {
+		var revision ArticleRevision
+		var id, articleRef, createdAt, article string
+		var changedFields sql.NullString
+		err := rows.Scan(&id, &articleRef, &revision.Revision, &createdAt, &changedFields, &article)
+		if err == nil {
+			revision.ID, err = primitive.ObjectIDFromHex(id)
+		}
+		if err == nil {
+			revision.ArticleRef, err = primitive.ObjectIDFromHex(articleRef)
+		}
+		if err == nil {
+			revision.ChangedFields, err = parseSQLiteList(changedFields)
+		}
+		if err == nil {
+			revision.CreatedAt, err = db.ParseSQLiteTime(createdAt)
+		}
+		if err == nil {
+			err = bson.UnmarshalExtJSON([]byte(article), false, &revision.Article)
+		}
+		if err != nil {
+			log.Error("Could not decode article revisions. Error: ", err)
+			return nil, err
+		}
+		revisions = append(revisions, &revision)
+	}
+	return revisions, rows.Err()
+}
+
+// List retrieves all revisions of an article from the database, oldest first.
+func (r sqliteRevisionRepository) List(ctx context.Context, articleRef primitive.ObjectID) ([]*ArticleRevision, error) {
+	ctx, cancel := db.WithSQLiteTimeout(ctx)
+	defer cancel()
+	query := "SELECT " + revisionColumns + " FROM article_revisions WHERE article_ref = ?1 ORDER BY revision"
+	return r.queryRevisions(ctx, query, articleRef.Hex())
+}
+
+// Find retrieves the revisions of an article with the given numbers from the database.
+func (r sqliteRevisionRepository) Find(ctx context.Context, articleRef primitive.ObjectID, numbers []int) ([]ArticleRevision, error) {
+	ctx, cancel := db.WithSQLiteTimeout(ctx)
+	defer cancel()
+	query := "SELECT " + revisionColumns + " FROM article_revisions" +
+		" WHERE article_ref = ?1 AND revision IN (SELECT value FROM json_each(?2))"
+	found, err := r.queryRevisions(ctx, query, articleRef.Hex(), sqliteArray(numbers))
+	if err != nil {
+		return nil, err
+	}
+	var revisions []ArticleRevision
+	for _, revision := range found {
+		revisions = append(revisions, *revision)
+	}
+	return revisions, nil
+}
+
+// Save upserts the failed articles into the failed_articles table in a single transaction, keyed on their
+// TeamID and ArticleID.
+func (r sqliteFailureRepository) Save(ctx context.Context, failures []FailedArticle) error {
+	ctx, cancel := db.WithSQLiteTimeout(ctx)
+	defer cancel()
+	if len(failures) == 0 {
+		return nil
+	}
+	tx, err := r.database.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := "INSERT INTO failed_articles (" + failureColumns + ") VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7)" +
+		" ON CONFLICT (team_id, article_id) DO UPDATE SET error = EXCLUDED.error, attempts = EXCLUDED.attempts," +
+		" last_attempt = EXCLUDED.last_attempt, next_retry = EXCLUDED.next_retry"
+	for _, f := range failures {
+		id := f.ID
+		if id.IsZero() {
+			id = primitive.NewObjectID()
+		}
+		_, err := tx.ExecContext(ctx, query, id.Hex(), f.TeamID, f.ArticleID, f.Error, f.Attempts,
+			db.SQLiteTime(f.LastAttempt), db.SQLiteTime(f.NextRetry))
+		if err != nil {
+			log.Println("Failed to store failed articles to the DB: ", err)
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Delete removes the given articles of a team from the failed_articles table.
+func (r sqliteFailureRepository) Delete(ctx context.Context, teamID string, articleIDs []string) error {
+	ctx, cancel := db.WithSQLiteTimeout(ctx)
+	defer cancel()
+	if len(articleIDs) == 0 {
+		return nil
+	}
+	query := "DELETE FROM failed_articles WHERE team_id = ?1 AND article_id IN (SELECT value FROM json_each(?2))"
+	if _, err := r.database.ExecContext(ctx, query, teamID, sqliteArray(articleIDs)); err != nil {
+		log.Println("Failed to clear failed articles in the DB: ", err)
+		return err
+	}
+	return nil
+}
+
+// List retrieves the failed articles of a team, or of all teams when teamID is empty, ordered by their next retry time.
+func (r sqliteFailureRepository) List(ctx context.Context, teamID string) ([]*FailedArticle, error) {
+	ctx, cancel := db.WithSQLiteTimeout(ctx)
+	defer cancel()
+	query := "SELECT " + failureColumns + " FROM failed_articles WHERE ?1 = '' OR team_id = ?1 ORDER BY next_retry"
+	rows, err := r.database.QueryContext(ctx, query, teamID)
+	if err != nil {
+		log.Error("Could not get failed articles from the database. Error: ", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	failures := make([]*FailedArticle, 0)
+	for rows.Next() {
+		var f FailedArticle
+		var id, lastAttempt, nextRetry string
+		err := rows.Scan(&id, &f.TeamID, &f.ArticleID, &f.Error, &f.Attempts, &lastAttempt, &nextRetry)
+		if err == nil {
+			f.ID, err = primitive.ObjectIDFromHex(id)
+		}
+		if err == nil {
+			err = parseSQLiteTimes(map[*time.Time]string{&f.LastAttempt: lastAttempt, &f.NextRetry: nextRetry})
+		}
+		if err != nil {
+			log.Error("Could not decode failed articles. Error: ", err)
+			return nil, err
+		}
+		failures = append(failures, &f)
+	}
+	return failures, rows.Err()
+}
+
+// scanSQLiteFeedState reads the state of a feed from a row of the feedColumns.
+func scanSQLiteFeedState(row sqliteRow) (*FeedState, error) {
+	var state FeedState
+	var lastPolled string
+	var backfill sql.NullString
+	if err := row.Scan(&state.ClubKey, &state.ETag, &state.LastModified, &state.SkippedPolls, &lastPolled, &backfill, &state.Paused); err != nil {
+		return nil, err
+	}
+	if backfill.Valid {
+		if err := json.Unmarshal([]byte(backfill.String), &state.Backfill); err != nil {
+			return nil, err
+		}
+	}
+	var err error
+	state.LastPolled, err = db.ParseSQLiteTime(lastPolled)
+	return &state, err
+}
+
+// Get retrieves the state of the given feed. A feed that was never polled gets an empty state.
+func (r sqliteFeedStateRepository) Get(ctx context.Context, clubKey string) (*FeedState, error) {
+	ctx, cancel := db.WithSQLiteTimeout(ctx)
+	defer cancel()
+	row := r.database.QueryRowContext(ctx, "SELECT "+feedColumns+" FROM feed_states WHERE club_key = ?1", clubKey)
+	state, err := scanSQLiteFeedState(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &FeedState{ClubKey: clubKey}, nil
+	}
+	if err != nil {
+		log.Errorf("could not get state of feed %v, error: %v", clubKey, err)
+		return nil, err
+	}
+	return state, nil
+}
+
+// List retrieves the states of all feeds that were polled at least once.
+func (r sqliteFeedStateRepository) List(ctx context.Context) ([]*FeedState, error) {
+	ctx, cancel := db.WithSQLiteTimeout(ctx)
+	defer cancel()
+	rows, err := r.database.QueryContext(ctx, "SELECT "+feedColumns+" FROM feed_states ORDER BY club_key")
+	if err != nil {
+		log.Error("Could not get feed states from the database. Error: ", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	states := make([]*FeedState, 0)
+	for rows.Next() {
+		state, err := scanSQLiteFeedState(rows)
+		if err != nil {
+			log.Error("Could not decode feed states. Error: ", err)
+			return nil, err
+		}
+		states = append(states, state)
+	}
+	return states, rows.Err()
+}
+
+// SaveValidators stores the ETag and Last-Modified values of the last processed list response of a feed.
+func (r sqliteFeedStateRepository) SaveValidators(ctx context.Context, clubKey string, etag string, lastModified string, polled time.Time) error {
+	ctx, cancel := db.WithSQLiteTimeout(ctx)
+	defer cancel()
+	query := "INSERT INTO feed_states (club_key, etag, last_modified, last_polled) VALUES (?1, ?2, ?3, ?4)" +
+		" ON CONFLICT (club_key) DO UPDATE SET etag = EXCLUDED.etag, last_modified = EXCLUDED.last_modified, last_polled = EXCLUDED.last_polled"
+	return r.updateFeedState(ctx, clubKey, query, clubKey, etag, lastModified, db.SQLiteTime(polled))
+}
+
+// IncrementSkippedPolls counts a poll of the feed that was answered with 304 Not Modified.
+func (r sqliteFeedStateRepository) IncrementSkippedPolls(ctx context.Context, clubKey string, polled time.Time) error {
+	ctx, cancel := db.WithSQLiteTimeout(ctx)
+	defer cancel()
+	query := "INSERT INTO feed_states (club_key, skipped_polls, last_polled) VALUES (?1, 1, ?2)" +
+		" ON CONFLICT (club_key) DO UPDATE SET skipped_polls = feed_states.skipped_polls + 1, last_polled = EXCLUDED.last_polled"
+	return r.updateFeedState(ctx, clubKey, query, clubKey, db.SQLiteTime(polled))
+}
+
+// SaveBackfill stores the progress of a feed's backfill.
+func (r sqliteFeedStateRepository) SaveBackfill(ctx context.Context, clubKey string, checkpoint *BackfillCheckpoint) error {
+	ctx, cancel := db.WithSQLiteTimeout(ctx)
+	defer cancel()
+	backfill, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	query := "INSERT INTO feed_states (club_key, backfill) VALUES (?1, ?2)" +
+		" ON CONFLICT (club_key) DO UPDATE SET backfill = EXCLUDED.backfill"
+	return r.updateFeedState(ctx, clubKey, query, clubKey, string(backfill))
+}
+
+// SetPaused stores whether the schedule of a feed is paused.
+func (r sqliteFeedStateRepository) SetPaused(ctx context.Context, clubKey string, paused bool) error {
+	ctx, cancel := db.WithSQLiteTimeout(ctx)
+	defer cancel()
+	query := "INSERT INTO feed_states (club_key, paused) VALUES (?1, ?2)" +
+		" ON CONFLICT (club_key) DO UPDATE SET paused = EXCLUDED.paused"
+	return r.updateFeedState(ctx, clubKey, query, clubKey, paused)
+}
+
+// Save replaces the state of a feed.
+func (r sqliteFeedStateRepository) Save(ctx context.Context, state *FeedState) error {
+	ctx, cancel := db.WithSQLiteTimeout(ctx)
+	defer cancel()
+	var backfill interface{}
+	if state.Backfill != nil {
+		data, err := json.Marshal(state.Backfill)
+		if err != nil {
+			return err
+		}
+		backfill = string(data)
+	}
+	query := "INSERT INTO feed_states (" + feedColumns + ") VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7)" +
+		" ON CONFLICT (club_key) DO UPDATE SET etag = EXCLUDED.etag, last_modified = EXCLUDED.last_modified," +
+		" skipped_polls = EXCLUDED.skipped_polls, last_polled = EXCLUDED.last_polled, backfill = EXCLUDED.backfill, paused = EXCLUDED.paused"
+	return r.updateFeedState(ctx, state.ClubKey, query, state.ClubKey, state.ETag, state.LastModified, state.SkippedPolls,
+		db.SQLiteTime(state.LastPolled), backfill, state.Paused)
+}
+
+// updateFeedState runs an upsert of the state of a feed.
+func (r sqliteFeedStateRepository) updateFeedState(ctx context.Context, clubKey string, query string, args ...interface{}) error {
+	if _, err := r.database.ExecContext(ctx, query, args...); err != nil {
+		log.Errorf("could not update state of feed %v, error: %v", clubKey, err)
+		return err
+	}
+	return nil
+}
+
+// Save stores the record of an ingestion run in the ingestion_runs table, replacing the stored run with the same ID.
+// Adding a run removes the expired runs.
+func (r sqliteRunRepository) Save(ctx context.Context, run *IngestionRun) error {
+	ctx, cancel := db.WithSQLiteTimeout(ctx)
+	defer cancel()
+	id := run.ID
+	if id.IsZero() {
+		id = primitive.NewObjectID()
+		expiry := time.Now().Add(-config.Conf.Ingestion.RunRetentionDuration())
+		if _, err := r.database.ExecContext(ctx, "DELETE FROM ingestion_runs WHERE started_at < ?1", db.SQLiteTime(expiry)); err != nil {
+			log.Errorf("could not remove expired ingestion runs, error: %v", err)
+			return err
+		}
+	}
+	query := "INSERT INTO ingestion_runs (" + runColumns + ") VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9, ?10, ?11, ?12, ?13)" +
+		runConflictUpdate
+	_, err := r.database.ExecContext(ctx, query, id.Hex(), run.Feed, run.Trigger, run.ArticleID, db.SQLiteTime(run.StartedAt),
+		db.SQLiteTime(run.FinishedAt), run.HTTPStatus, run.Seen, run.New, run.Updated, run.Failed, run.Withdrawn, run.Error)
+	if err != nil {
+		log.Errorf("could not store ingestion run of %v, error: %v", run.Feed, err)
+		return err
+	}
+	run.ID = id
+	return nil
+}
+
+// queryRuns runs a query returning rows of the runColumns and reads the runs from them.
+func (r sqliteRunRepository) queryRuns(ctx context.Context, query string, args ...interface{}) ([]*IngestionRun, error) {
+	rows, err := r.database.QueryContext(ctx, query, args...)
+	if err != nil {
+		log.Error("Could not get ingestion runs from the database. Error: ", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := make([]*IngestionRun, 0)
+	for rows.Next() {
+		var run IngestionRun
+		var id, startedAt, finishedAt string
+		err := rows.Scan(&id, &run.Feed, &run.Trigger, &run.ArticleID, &startedAt, &finishedAt, &run.HTTPStatus,
+			&run.Seen, &run.New, &run.Updated, &run.Failed, &run.Withdrawn, &run.Error)
+		if err == nil {
+			run.ID, err = primitive.ObjectIDFromHex(id)
+		}
+		if err == nil {
+			err = parseSQLiteTimes(map[*time.Time]string{&run.StartedAt: startedAt, &run.FinishedAt: finishedAt})
+		}
+		if err != nil {
+			log.Error("Could not decode ingestion runs. Error: ", err)
+			return nil, err
+		}
+		runs = append(runs, &run)
+	}
+	return runs, rows.Err()
+}
+
+// List retrieves a page of the ingestion runs of a feed, or of all feeds when feed is empty, newest first.
+func (r sqliteRunRepository) List(ctx context.Context, feed string, page int, pageSize int) ([]*IngestionRun, int64, error) {
+	ctx, cancel := db.WithSQLiteTimeout(ctx)
+	defer cancel()
+	var total int64
+	if err := r.database.QueryRowContext(ctx, "SELECT COUNT(*) FROM ingestion_runs WHERE ?1 = '' OR feed = ?1", feed).Scan(&total); err != nil {
+		log.Error("Could not count ingestion runs in the database. Error: ", err)
+		return nil, 0, err
+	}
+	query := "SELECT " + runColumns + " FROM ingestion_runs WHERE ?1 = '' OR feed = ?1 ORDER BY started_at DESC LIMIT ?2 OFFSET ?3"
+	runs, err := r.queryRuns(ctx, query, feed, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	return runs, total, nil
+}
+
+// LastSuccessful returns the last successful ingestion run of every feed.
+func (r sqliteRunRepository) LastSuccessful(ctx context.Context) (map[string]*IngestionRun, error) {
+	ctx, cancel := db.WithSQLiteTimeout(ctx)
+	defer cancel()
+	query := "SELECT " + runColumns + " FROM (SELECT *, ROW_NUMBER() OVER (PARTITION BY feed ORDER BY started_at DESC) AS n" +
+		" FROM ingestion_runs WHERE error = '' AND trigger <> ?1) WHERE n = 1"
+	runs, err := r.queryRuns(ctx, query, runTriggerRefresh)
+	if err != nil {
+		return nil, err
+	}
+	runsByFeed := make(map[string]*IngestionRun)
+	for _, run := range runs {
+		runsByFeed[run.Feed] = run
+	}
+	return runsByFeed, nil
+}
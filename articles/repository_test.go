@@ -0,0 +1,341 @@
+package articles
+
+import (
+	"context"
+	"github.com/SkaisgirisMarius/article-processor/config"
+	"github.com/SkaisgirisMarius/article-processor/db"
+	"github.com/SkaisgirisMarius/article-processor/migration"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testStorages returns the storages the repository tests run on: the in-memory storage, a SQLite storage in a
+// temporary file, and a PostgreSQL storage on the emptied database of the POSTGRES_TEST_URL environment variable
+// when it is set.
+func testStorages(t *testing.T) map[string]*Storage {
+	storages := map[string]*Storage{"memory": NewMemoryStorage()}
+	database, err := db.OpenSQLite(filepath.Join(t.TempDir(), "articles.db"))
+	if err != nil {
+		t.Fatal("Failed to open SQLite: ", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	sqliteStore, err := NewSQLiteStorage(context.Background(), database)
+	if err != nil {
+		t.Fatal("Failed to create the SQLite schema: ", err)
+	}
+	storages["sqlite"] = sqliteStore
+	if url := os.Getenv("POSTGRES_TEST_URL"); url != "" {
+		ctx := context.Background()
+		pool, err := db.OpenPostgres(ctx, url)
+		if err != nil {
+			t.Fatal("Failed to connect to PostgreSQL: ", err)
+		}
+		t.Cleanup(pool.Close)
+		store, err := NewPostgresStorage(ctx, pool)
+		if err != nil {
+			t.Fatal("Failed to create the PostgreSQL schema: ", err)
+		}
+		if _, err := pool.Exec(ctx, "TRUNCATE articles, article_revisions, failed_articles, feed_states, ingestion_runs"); err != nil {
+			t.Fatal("Failed to clean up test data: ", err)
+		}
+		storages["postgres"] = store
+	}
+	return storages
+}
+
+func TestArticleRepository(t *testing.T) {
+	for name, store := range testStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			published := time.Date(2023, 7, 1, 10, 0, 0, 0, time.UTC)
+			articles := []Article{
+				{TeamID: "a", ArticleID: "1", Title: "One", Type: []string{"first-team"}, Published: published, LastUpdated: published, ReadingTime: 2, State: statePublished},
+				{TeamID: "a", ArticleID: "2", Title: "Two", Published: published.Add(time.Hour), LastUpdated: published, ReadingTime: 5, State: statePublished},
+				{TeamID: "b", ArticleID: "1", Title: "Other club", GalleryURLs: []string{"https://example.com/1.jpg"}, Published: published, LastUpdated: published, State: statePublished},
+			}
+			added, changed, err := store.Articles.Upsert(ctx, articles)
+			assert.NoError(t, err)
+			assert.Equal(t, 3, added)
+			assert.Equal(t, 0, changed)
+
+			// Storing the same articles again changes nothing, a changed article keeps its ID
+			added, changed, err = store.Articles.Upsert(ctx, articles)
+			assert.NoError(t, err)
+			assert.Equal(t, 0, added+changed)
+			stored, err := store.Articles.FindByArticleIDs(ctx, "a", []string{"1"})
+			assert.NoError(t, err)
+			assert.Equal(t, 1, len(stored))
+			articles[0].Title = "One (edited)"
+			added, changed, err = store.Articles.Upsert(ctx, articles[:1])
+			assert.NoError(t, err)
+			assert.Equal(t, 0, added)
+			assert.Equal(t, 1, changed)
+			article, err := store.Articles.FindByID(ctx, stored[0].ID)
+			assert.NoError(t, err)
+			assert.Equal(t, "One (edited)", article.Title)
+			assert.Equal(t, []string{"first-team"}, article.Type)
+			assert.Equal(t, published, article.Published)
+
+			// Filters
+			list, err := store.Articles.List(ctx, ArticleFilter{TeamID: "a", PublishedSince: published.Add(time.Minute)})
+			assert.NoError(t, err)
+			assert.Equal(t, 1, len(list))
+			assert.Equal(t, "2", list[0].ArticleID)
+			list, err = store.Articles.List(ctx, ArticleFilter{TeamID: "a", ExcludeArticleIDs: []string{"2"}})
+			assert.NoError(t, err)
+			assert.Equal(t, 1, len(list))
+			list, err = store.Articles.List(ctx, ArticleFilter{MinReadingTime: 3, MaxReadingTime: 10})
+			assert.NoError(t, err)
+			assert.Equal(t, 1, len(list))
+			assert.Equal(t, 5, list[0].ReadingTime)
+
+			// Withdrawn articles are only listed on request
+			withdrawn, err := store.Articles.SetState(ctx, "a", []string{"1"}, stateWithdrawn)
+			assert.NoError(t, err)
+			assert.Equal(t, 1, withdrawn)
+			list, err = store.Articles.List(ctx, ArticleFilter{})
+			assert.NoError(t, err)
+			assert.Equal(t, 2, len(list))
+			list, err = store.Articles.List(ctx, ArticleFilter{IncludeWithdrawn: true})
+			assert.NoError(t, err)
+			assert.Equal(t, 3, len(list))
+
+			deleted, err := store.Articles.Delete(ctx, "b", []string{"1"})
+			assert.NoError(t, err)
+			assert.Equal(t, 1, deleted)
+			_, err = store.Articles.FindByID(ctx, list[2].ID)
+			assert.Equal(t, ErrNotFound, err)
+		})
+	}
+}
+
+func TestArticleRepositoryMoveTeam(t *testing.T) {
+	for name, store := range testStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			published := time.Date(2023, 7, 1, 10, 0, 0, 0, time.UTC)
+			_, _, err := store.Articles.Upsert(ctx, []Article{
+				{TeamID: "Huddersfield Town", ArticleID: "1", Title: "Legacy only", Published: published, LastUpdated: published},
+				{TeamID: "Huddersfield Town", ArticleID: "2", Title: "Legacy copy", Published: published, LastUpdated: published},
+				{TeamID: "htafc", ArticleID: "2", Title: "Club key copy", Published: published, LastUpdated: published},
+				{TeamID: "other", ArticleID: "1", Title: "Other club", Published: published, LastUpdated: published},
+			})
+			assert.NoError(t, err)
+
+			moved, removed, err := store.Articles.MoveTeam(ctx, "Huddersfield Town", "htafc")
+			assert.NoError(t, err)
+			assert.Equal(t, 1, moved)
+			assert.Equal(t, 1, removed)
+			list, err := store.Articles.List(ctx, ArticleFilter{TeamID: "htafc"})
+			assert.NoError(t, err)
+			titles := make(map[string]string)
+			for _, a := range list {
+				titles[a.ArticleID] = a.Title
+			}
+			assert.Equal(t, map[string]string{"1": "Legacy only", "2": "Club key copy"}, titles)
+			list, err = store.Articles.List(ctx, ArticleFilter{})
+			assert.NoError(t, err)
+			assert.Equal(t, 3, len(list))
+
+			// Moving again finds nothing left to move
+			moved, removed, err = store.Articles.MoveTeam(ctx, "Huddersfield Town", "htafc")
+			assert.NoError(t, err)
+			assert.Equal(t, 0, moved+removed)
+		})
+	}
+}
+
+func TestRevisionRepository(t *testing.T) {
+	for name, store := range testStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			published := time.Date(2023, 7, 1, 10, 0, 0, 0, time.UTC)
+			_, _, err := store.Articles.Upsert(ctx, []Article{{TeamID: "a", ArticleID: "1", Title: "One", Published: published, LastUpdated: published}})
+			assert.NoError(t, err)
+			stored, err := store.Articles.FindByArticleIDs(ctx, "a", []string{"1"})
+			assert.NoError(t, err)
+
+			for _, title := range []string{"First", "Second"} {
+				revision := ArticleRevision{ArticleRef: stored[0].ID, CreatedAt: published, ChangedFields: []string{"title"}, Article: stored[0]}
+				revision.Article.Title = title
+				assert.NoError(t, store.Revisions.Add(ctx, []ArticleRevision{revision}))
+			}
+			revisions, err := store.Revisions.List(ctx, stored[0].ID)
+			assert.NoError(t, err)
+			assert.Equal(t, 2, len(revisions))
+			assert.Equal(t, 1, revisions[0].Revision)
+			assert.Equal(t, "First", revisions[0].Article.Title)
+			assert.Equal(t, published, revisions[0].Article.Published)
+			assert.Equal(t, 2, revisions[1].Revision)
+
+			found, err := store.Revisions.Find(ctx, stored[0].ID, []int{2, 3})
+			assert.NoError(t, err)
+			assert.Equal(t, 1, len(found))
+			assert.Equal(t, "Second", found[0].Article.Title)
+		})
+	}
+}
+
+func TestIngestionStateRepositories(t *testing.T) {
+	for name, store := range testStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Date(2023, 7, 1, 10, 0, 0, 0, time.UTC)
+
+			// Failed articles are overwritten per article
+			failure := FailedArticle{TeamID: "a", ArticleID: "1", Error: "timeout", Attempts: 1, LastAttempt: now, NextRetry: now.Add(time.Minute)}
+			assert.NoError(t, store.Failures.Save(ctx, []FailedArticle{failure}))
+			failure.Attempts = 2
+			assert.NoError(t, store.Failures.Save(ctx, []FailedArticle{failure}))
+			failures, err := store.Failures.List(ctx, "")
+			assert.NoError(t, err)
+			assert.Equal(t, 1, len(failures))
+			assert.Equal(t, 2, failures[0].Attempts)
+			assert.NoError(t, store.Failures.Delete(ctx, "a", []string{"1"}))
+			failures, err = store.Failures.List(ctx, "a")
+			assert.NoError(t, err)
+			assert.Empty(t, failures)
+
+			// Feed states are created by any update
+			assert.NoError(t, store.FeedStates.SaveValidators(ctx, "a", "etag", "yesterday", now))
+			assert.NoError(t, store.FeedStates.IncrementSkippedPolls(ctx, "a", now))
+			assert.NoError(t, store.FeedStates.SetPaused(ctx, "b", true))
+			assert.NoError(t, store.FeedStates.SaveBackfill(ctx, "b", &BackfillCheckpoint{NextPage: 3, PageSize: 50, StartedAt: now}))
+			state, err := store.FeedStates.Get(ctx, "a")
+			assert.NoError(t, err)
+			assert.Equal(t, "etag", state.ETag)
+			assert.Equal(t, int64(1), state.SkippedPolls)
+			assert.Equal(t, now, state.LastPolled)
+			states, err := store.FeedStates.List(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, 2, len(states))
+			assert.True(t, states[1].Paused)
+			assert.Equal(t, 3, states[1].Backfill.NextPage)
+			state, err = store.FeedStates.Get(ctx, "unknown")
+			assert.NoError(t, err)
+			assert.Equal(t, "unknown", state.ClubKey)
+
+			// Runs are listed newest first, the last successful run skips failed runs and refreshes. Adding a run
+			// removes the runs started longer than the run retention ago.
+			started := time.Now().UTC().Truncate(time.Second).Add(-time.Hour)
+			expired := IngestionRun{Feed: "a", Trigger: runTriggerSchedule, StartedAt: started.AddDate(0, 0, -config.Conf.Ingestion.RunRetention)}
+			assert.NoError(t, store.Runs.Save(ctx, &expired))
+			for i, run := range []IngestionRun{
+				{Feed: "a", Trigger: runTriggerSchedule, New: 1},
+				{Feed: "a", Trigger: runTriggerSchedule, Error: "failed"},
+				{Feed: "a", Trigger: runTriggerRefresh},
+				{Feed: "b", Trigger: runTriggerManual},
+			} {
+				run := run
+				run.StartedAt = started.Add(time.Duration(i) * time.Minute)
+				run.FinishedAt = run.StartedAt
+				assert.NoError(t, store.Runs.Save(ctx, &run))
+				assert.False(t, run.ID.IsZero())
+			}
+			runs, total, err := store.Runs.List(ctx, "a", 1, 2)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(3), total)
+			assert.Equal(t, 2, len(runs))
+			assert.Equal(t, runTriggerRefresh, runs[0].Trigger)
+
+			// A run saved again with its ID replaces the stored run
+			runs[0].Seen = 1
+			assert.NoError(t, store.Runs.Save(ctx, runs[0]))
+			runs, total, err = store.Runs.List(ctx, "a", 1, 2)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(3), total)
+			assert.Equal(t, 1, runs[0].Seen)
+			lastRuns, err := store.Runs.LastSuccessful(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, 2, len(lastRuns))
+			assert.Equal(t, 1, lastRuns["a"].New)
+		})
+	}
+}
+
+func TestCopyStorage(t *testing.T) {
+	ctx := context.Background()
+	from := NewMemoryStorage()
+	now := time.Date(2023, 7, 1, 10, 0, 0, 0, time.UTC)
+	_, _, err := insertArticlesToDatabaseInBatch(ctx, from, []Article{{TeamID: "a", ArticleID: "1", Title: "One", Published: now}})
+	assert.NoError(t, err)
+	_, _, err = insertArticlesToDatabaseInBatch(ctx, from, []Article{{TeamID: "a", ArticleID: "1", Title: "One (edited)", Published: now}})
+	assert.NoError(t, err)
+	assert.NoError(t, from.FeedStates.SetPaused(ctx, "a", true))
+	assert.NoError(t, from.Runs.Save(ctx, &IngestionRun{Feed: "a", Trigger: runTriggerSchedule, StartedAt: now}))
+
+	for name, to := range testStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			assert.NoError(t, CopyStorage(ctx, from, to))
+
+			// The article keeps its ID and its revision
+			source, err := from.Articles.FindByArticleIDs(ctx, "a", []string{"1"})
+			assert.NoError(t, err)
+			article, err := to.Articles.FindByID(ctx, source[0].ID)
+			assert.NoError(t, err)
+			assert.Equal(t, "One (edited)", article.Title)
+			revisions, err := to.Revisions.List(ctx, article.ID)
+			assert.NoError(t, err)
+			assert.Equal(t, 1, len(revisions))
+			assert.Equal(t, "One", revisions[0].Article.Title)
+
+			state, err := to.FeedStates.Get(ctx, "a")
+			assert.NoError(t, err)
+			assert.True(t, state.Paused)
+			_, total, err := to.Runs.List(ctx, "", 1, 10)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(1), total)
+
+			// Copying again only adds what is missing in the target
+			assert.NoError(t, CopyStorage(ctx, from, to))
+			revisions, err = to.Revisions.List(ctx, article.ID)
+			assert.NoError(t, err)
+			assert.Equal(t, 1, len(revisions))
+			_, total, err = to.Runs.List(ctx, "", 1, 10)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(1), total)
+		})
+	}
+}
+
+func TestSQLiteMigrations(t *testing.T) {
+	ctx := context.Background()
+	database, err := db.OpenSQLite(filepath.Join(t.TempDir(), "articles.db"))
+	if err != nil {
+		t.Fatal("Failed to open SQLite: ", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if _, err := NewSQLiteStorage(ctx, database); err != nil {
+		t.Fatal("Failed to create the SQLite schema: ", err)
+	}
+	migrationStore, err := migration.NewSQLiteStore(ctx, database)
+	if err != nil {
+		t.Fatal("Failed to create the SQLite migration table: ", err)
+	}
+	runner := migration.NewRunner(migrationStore, nil, "", SQLiteMigrations(database))
+	indexCount := func() int {
+		var count int
+		err := database.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master WHERE type = 'index'"+
+			" AND name IN ('articles_published_idx', 'ingestion_runs_feed_started_at_idx')").Scan(&count)
+		assert.NoError(t, err)
+		return count
+	}
+
+	applied, err := runner.UpSafe(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, applied)
+	assert.Equal(t, 2, indexCount())
+
+	// The applied migrations are recorded in the database, a restart applies nothing
+	applied, err = migration.NewRunner(migrationStore, nil, "", SQLiteMigrations(database)).UpSafe(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, applied)
+
+	reverted, err := runner.Down(ctx, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, reverted)
+	assert.Equal(t, 0, indexCount())
+}
@@ -0,0 +1,167 @@
+package articles
+
+import (
+	"context"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"reflect"
+	"time"
+)
+
+// ArticleRevision is an earlier version of an article, kept when the article is overwritten by a newer version.
+type ArticleRevision struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	ArticleRef    primitive.ObjectID `bson:"articleRef" json:"articleRef"`
+	Revision      int                `bson:"revision" json:"revision"`
+	CreatedAt     time.Time          `bson:"createdAt" json:"createdAt"`
+	ChangedFields []string           `bson:"changedFields" json:"changedFields"`
+	Article       Article            `bson:"article" json:"article"`
+}
+
+// FieldDiff is the old and new value of a single article field.
+type FieldDiff struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
+
+// RevisionDiff is the field-level difference between a revision and the version of the article that replaced it.
+// ComparedTo is the revision number of the newer version, or 0 when it is the current article.
+type RevisionDiff struct {
+	ArticleRef primitive.ObjectID `json:"articleRef"`
+	Revision   int                `json:"revision"`
+	ComparedTo int                `json:"comparedTo"`
+	Changes    []FieldDiff        `json:"changes"`
+}
+
+// diffArticles returns the differences between the tracked fields of two versions of an article.
+func diffArticles(oldArticle, newArticle *Article) []FieldDiff {
+	fields := []struct {
+		name     string
+		old, new interface{}
+	}{
+		{"title", oldArticle.Title, newArticle.Title},
+		{"teaser", oldArticle.Teaser, newArticle.Teaser},
+		{"content", oldArticle.Content, newArticle.Content},
+		{"imageUrl", oldArticle.ImageURL, newArticle.ImageURL},
+		{"galleryUrls", oldArticle.GalleryURLs, newArticle.GalleryURLs},
+		{"videoUrl", oldArticle.VideoURL, newArticle.VideoURL},
+	}
+
+	diffs := make([]FieldDiff, 0)
+	for _, f := range fields {
+		if !reflect.DeepEqual(f.old, f.new) {
+			diffs = append(diffs, FieldDiff{Field: f.name, Old: f.old, New: f.new})
+		}
+	}
+	return diffs
+}
+
+// saveArticleRevisions stores the existing versions of the given articles as new revisions before they are overwritten.
+// Articles that are not in the database yet have no earlier version and are skipped, as are articles whose tracked
+// fields did not change, so that re-ingesting an unchanged article does not add an empty revision.
+func saveArticleRevisions(ctx context.Context, store *Storage, articles []Article) error {
+	if len(articles) == 0 {
+		return nil
+	}
+
+	// Find the currently stored versions of the articles, by team
+	articleIDs := make(map[string][]string)
+	for _, a := range articles {
+		articleIDs[a.TeamID] = append(articleIDs[a.TeamID], a.ArticleID)
+	}
+	existingArticles := make(map[string]Article)
+	for teamID, ids := range articleIDs {
+		storedArticles, err := store.Articles.FindByArticleIDs(ctx, teamID, ids)
+		if err != nil {
+			log.Error("Could not get existing articles from the database. Error: ", err)
+			return err
+		}
+		for _, a := range storedArticles {
+			existingArticles[a.TeamID+"/"+a.ArticleID] = a
+		}
+	}
+
+	var revisions []ArticleRevision
+	now := time.Now().UTC()
+	for i := range articles {
+		existingArticle, found := existingArticles[articles[i].TeamID+"/"+articles[i].ArticleID]
+		if !found {
+			continue
+		}
+		var changedFields []string
+		for _, diff := range diffArticles(&existingArticle, &articles[i]) {
+			changedFields = append(changedFields, diff.Field)
+		}
+		if len(changedFields) == 0 {
+			continue
+		}
+		revisions = append(revisions, ArticleRevision{
+			ArticleRef:    existingArticle.ID,
+			CreatedAt:     now,
+			ChangedFields: changedFields,
+			Article:       existingArticle,
+		})
+	}
+
+	if len(revisions) == 0 {
+		return nil
+	}
+	if err := store.Revisions.Add(ctx, revisions); err != nil {
+		return err
+	}
+	log.Printf("Stored %v article revisions.", len(revisions))
+	return nil
+}
+
+// getArticleRevisionsFromDatabase retrieves all revisions of an article, oldest first.
+func getArticleRevisionsFromDatabase(ctx context.Context, store *Storage, id string) ([]*ArticleRevision, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		log.Error("could not get primitive.ObjectID from provided id. ", err)
+		return nil, err
+	}
+	return store.Revisions.List(ctx, objID)
+}
+
+// getArticleRevisionDiff compares revision n of an article with the version that replaced it,
+// which is either revision n+1 or the current article. It returns ErrNotFound when the revision does not exist.
+func getArticleRevisionDiff(ctx context.Context, store *Storage, id string, n int) (*RevisionDiff, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		log.Error("could not get primitive.ObjectID from provided id. ", err)
+		return nil, err
+	}
+
+	// Fetch the requested revision together with its successor, if there is one
+	revisions, err := store.Revisions.Find(ctx, objID, []int{n, n + 1})
+	if err != nil {
+		return nil, err
+	}
+
+	var revision, successor *ArticleRevision
+	for i := range revisions {
+		if revisions[i].Revision == n {
+			revision = &revisions[i]
+		} else {
+			successor = &revisions[i]
+		}
+	}
+	if revision == nil {
+		return nil, ErrNotFound
+	}
+
+	diff := &RevisionDiff{ArticleRef: objID, Revision: n}
+	if successor != nil {
+		diff.ComparedTo = successor.Revision
+		diff.Changes = diffArticles(&revision.Article, &successor.Article)
+		return diff, nil
+	}
+
+	current, err := store.Articles.FindByID(ctx, objID)
+	if err != nil {
+		return nil, err
+	}
+	diff.Changes = diffArticles(&revision.Article, current)
+	return diff, nil
+}
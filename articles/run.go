@@ -0,0 +1,66 @@
+package articles
+
+import (
+	"context"
+	"github.com/SkaisgirisMarius/article-processor/config"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Triggers of an ingestion run: the scheduler, a manual trigger of the feed or a refresh of a single article.
+const (
+	runTriggerSchedule = "schedule"
+	runTriggerManual   = "manual"
+	runTriggerRefresh  = "refresh"
+)
+
+// IngestionRun is the record of a single ingestion run of a feed. ArticleID is only set for the refresh of a single
+// article. HTTPStatus is the status of the list response, Seen the number of listed articles, New and Updated the
+// number of added and changed articles, Failed the number of articles that could not be read or fetched and
+// Withdrawn the number of articles taken down upstream. Error is only set when the run failed.
+type IngestionRun struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Feed       string             `bson:"feed" json:"feed"`
+	Trigger    string             `bson:"trigger" json:"trigger"`
+	ArticleID  string             `bson:"articleID,omitempty" json:"articleID,omitempty"`
+	StartedAt  time.Time          `bson:"startedAt" json:"startedAt"`
+	FinishedAt time.Time          `bson:"finishedAt" json:"finishedAt"`
+	HTTPStatus int                `bson:"httpStatus" json:"httpStatus"`
+	Seen       int                `bson:"seen" json:"seen"`
+	New        int                `bson:"new" json:"new"`
+	Updated    int                `bson:"updated" json:"updated"`
+	Failed     int                `bson:"failed" json:"failed"`
+	Withdrawn  int                `bson:"withdrawn" json:"withdrawn"`
+	Error      string             `bson:"error,omitempty" json:"error,omitempty"`
+}
+
+// FeedIngestionStatus is the ingestion status of a configured feed. LastSuccessfulRun is nil when the feed
+// had no successful run within the run retention.
+type FeedIngestionStatus struct {
+	Feed              string        `json:"feed"`
+	Enabled           bool          `json:"enabled"`
+	LastSuccessfulRun *IngestionRun `json:"lastSuccessfulRun"`
+}
+
+// saveIngestionRun stores the record of an ingestion run.
+func saveIngestionRun(store *Storage, run *IngestionRun) {
+	store.Runs.Save(context.Background(), run)
+}
+
+// getIngestionStatusFromDatabase returns the last successful ingestion run of every configured feed.
+func getIngestionStatusFromDatabase(ctx context.Context, store *Storage) ([]*FeedIngestionStatus, error) {
+	runsByFeed, err := store.Runs.LastSuccessful(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]*FeedIngestionStatus, 0, len(config.Conf.Feeds))
+	for _, feed := range config.Conf.Feeds {
+		statuses = append(statuses, &FeedIngestionStatus{
+			Feed:              feed.ClubKey,
+			Enabled:           feed.Enabled,
+			LastSuccessfulRun: runsByFeed[feed.ClubKey],
+		})
+	}
+	return statuses, nil
+}
@@ -0,0 +1,164 @@
+package articles
+
+import (
+	"context"
+	"errors"
+	"github.com/SkaisgirisMarius/article-processor/config"
+	"github.com/SkaisgirisMarius/article-processor/leader"
+	"github.com/SkaisgirisMarius/article-processor/scheduler"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+// errSchedulerNotRunning is returned when the schedule of a feed is changed before the scheduler was started.
+var errSchedulerNotRunning = errors.New("the ingestion scheduler is not running")
+
+// pausedSyncInterval is how often the running scheduler picks up the feeds paused and resumed through other replicas.
+const pausedSyncInterval = 10 * time.Second
+
+// feedScheduler runs the scheduled ingestion of the enabled feeds, it is nil until InitializeArticleRetriever ran.
+var feedScheduler *scheduler.Scheduler
+
+// FeedSchedule is the schedule of an enabled feed. Next is the time of the next run, unset while the feed is paused
+// or when this replica does not run the scheduler.
+type FeedSchedule struct {
+	Feed     string    `json:"feed"`
+	Cron     []string  `json:"cron,omitempty"`
+	Interval int       `json:"interval,omitempty"`
+	Timezone string    `json:"timezone,omitempty"`
+	Next     time.Time `json:"next"`
+	Paused   bool      `json:"paused"`
+	Running  bool      `json:"running"`
+}
+
+// feedSchedule returns the schedule of a feed: its cron expressions evaluated in the feed's timezone,
+// or its interval when it has none.
+func feedSchedule(feed config.Feed) (scheduler.Schedule, error) {
+	if len(feed.Cron) == 0 {
+		return scheduler.Every(time.Duration(feed.Interval) * time.Second), nil
+	}
+	location, err := feed.Location()
+	if err != nil {
+		return nil, err
+	}
+	var schedules []scheduler.Schedule
+	for _, expression := range feed.Cron {
+		schedule, err := scheduler.ParseCron(expression, location)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, schedule)
+	}
+	return scheduler.Combine(schedules...), nil
+}
+
+// RunScheduler runs the scheduled ingestion of the feeds until the context is done, then waits up to the shutdown
+// timeout for the runs in progress before cancelling them. When several replicas share the database only the
+// elected leader runs it. When the context was cancelled because the leader lost its lease the runs are cancelled
+// right away, another replica may already be running the scheduler. The paused feeds are synced from the database
+// on start and every pausedSyncInterval, since a feed may have been paused or resumed through another replica.
+func RunScheduler(ctx context.Context, store *Storage) {
+	if feedScheduler == nil {
+		log.Println("Article retrieval is not initialized, not running the scheduler")
+		return
+	}
+	syncPausedFeeds(ctx, store, feedScheduler)
+	feedScheduler.Start()
+	log.Println("Running the article retrieval scheduler")
+
+	ticker := time.NewTicker(pausedSyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Stopping the article retrieval scheduler")
+			stopCtx, cancel := context.WithTimeout(context.Background(), config.Conf.ShutdownTimeoutDuration())
+			defer cancel()
+			if errors.Is(context.Cause(ctx), leader.ErrLeaseLost) {
+				cancel()
+			}
+			if err := feedScheduler.Stop(stopCtx); err != nil {
+				log.Println("Ingestion runs were cancelled before they finished:", err)
+			}
+			return
+		case <-ticker.C:
+			syncPausedFeeds(ctx, store, feedScheduler)
+		}
+	}
+}
+
+// syncPausedFeeds pauses and resumes the scheduled feeds according to their paused state in the database.
+func syncPausedFeeds(ctx context.Context, store *Storage, s *scheduler.Scheduler) {
+	states, err := store.FeedStates.List(ctx)
+	if err != nil {
+		log.Println("Error syncing the paused feeds:", err)
+		return
+	}
+	paused := make(map[string]bool)
+	for _, state := range states {
+		paused[state.ClubKey] = state.Paused
+	}
+	for _, job := range s.Jobs() {
+		switch {
+		case paused[job.Name] && !job.Paused:
+			s.Pause(job.Name)
+			log.Printf("Feed %v is paused, not running it until it is resumed", job.Name)
+		case !paused[job.Name] && job.Paused:
+			s.Resume(job.Name)
+			log.Printf("Feed %v was resumed", job.Name)
+		}
+	}
+}
+
+// setFeedPaused pauses or resumes the schedule of a feed and stores the change in the state of the feed,
+// so that it survives a restart.
+func setFeedPaused(store *Storage, clubKey string, paused bool) (*FeedSchedule, error) {
+	if feedScheduler == nil {
+		return nil, errSchedulerNotRunning
+	}
+	var err error
+	if paused {
+		err = feedScheduler.Pause(clubKey)
+	} else {
+		err = feedScheduler.Resume(clubKey)
+	}
+	if err != nil {
+		return nil, err
+	}
+	store.FeedStates.SetPaused(context.Background(), clubKey, paused)
+
+	schedules, err := getFeedSchedules()
+	if err != nil {
+		return nil, err
+	}
+	for _, schedule := range schedules {
+		if schedule.Feed == clubKey {
+			return schedule, nil
+		}
+	}
+	return nil, scheduler.ErrUnknownJob
+}
+
+// getFeedSchedules returns the schedules of the scheduled feeds, including their next run time.
+func getFeedSchedules() ([]*FeedSchedule, error) {
+	if feedScheduler == nil {
+		return nil, errSchedulerNotRunning
+	}
+	schedules := make([]*FeedSchedule, 0)
+	for _, job := range feedScheduler.Jobs() {
+		feed, _ := config.Conf.FindFeed(job.Name)
+		schedule := &FeedSchedule{
+			Feed:     job.Name,
+			Cron:     feed.Cron,
+			Timezone: feed.Timezone,
+			Next:     job.Next,
+			Paused:   job.Paused,
+			Running:  job.Running,
+		}
+		if len(feed.Cron) == 0 {
+			schedule.Interval = feed.Interval
+		}
+		schedules = append(schedules, schedule)
+	}
+	return schedules, nil
+}
@@ -0,0 +1,24 @@
+package articles
+
+import (
+	"github.com/SkaisgirisMarius/article-processor/config"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestFeedSchedule(t *testing.T) {
+	after := time.Date(2023, 7, 1, 9, 30, 0, 0, time.UTC)
+
+	interval, err := feedSchedule(config.Feed{Interval: 600})
+	assert.NoError(t, err)
+	assert.Equal(t, after.Add(10*time.Minute), interval.Next(after))
+
+	// 07:00 and 19:00 London time are 06:00 and 18:00 UTC in summer
+	cron, err := feedSchedule(config.Feed{Cron: []string{"0 19 * * *", "0 7 * * *"}, Timezone: "Europe/London"})
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2023, 7, 1, 18, 0, 0, 0, time.UTC), cron.Next(after).UTC())
+
+	_, err = feedSchedule(config.Feed{Cron: []string{"0 7 * *"}})
+	assert.Error(t, err)
+}
@@ -1,10 +1,9 @@
 package articles
 
 import (
-	"github.com/SkaisgirisMarius/article-processor/db"
+	"context"
+	"github.com/SkaisgirisMarius/article-processor/config"
 	log "github.com/sirupsen/logrus"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -12,22 +11,50 @@ import (
 
 const statusSuccess = "success"
 
+// Publication states of an article. Unpublished articles were never published upstream,
+// withdrawn articles were published once and then taken down by the club.
+const (
+	statePublished   = "published"
+	stateUnpublished = "unpublished"
+	stateWithdrawn   = "withdrawn"
+)
+
+// hiddenStates are the publication states of articles that are not shown by the read endpoints by default.
+var hiddenStates = []string{stateUnpublished, stateWithdrawn}
+
 //Internal Structures
 
+// Article is an article of a club. Content is sanitized HTML, ContentText and ContentMarkdown are derived from it
+// and are only returned by the read endpoints in place of Content when requested with the format query parameter.
+// WordCount, ReadingTime (in minutes) and Excerpt are computed from the text, the Excerpt is the fallback of a
+// missing Teaser.
 type Article struct {
-	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	ArticleID   string             `bson:"articleID,omitempty" json:"articleID"`
-	TeamID      string             `bson:"teamId" json:"teamId"`
-	OptaMatchID *string            `bson:"optaMatchId,omitempty" json:"optaMatchId"`
-	Title       string             `bson:"title" json:"title"`
-	Type        []string           `bson:"type" json:"type"`
-	Teaser      *string            `bson:"teaser" json:"teaser"`
-	Content     string             `bson:"content" json:"content"`
-	URL         string             `bson:"url" json:"url"`
-	ImageURL    string             `bson:"imageUrl" json:"imageUrl"`
-	GalleryURLs []string           `bson:"galleryUrls,omitempty" json:"galleryUrls,omitempty"`
-	VideoURL    *string            `bson:"videoUrl,omitempty" json:"videoUrl,omitempty"`
-	Published   time.Time          `bson:"published" json:"published"`
+	ID              primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	ArticleID       string             `bson:"articleID,omitempty" json:"articleID"`
+	TeamID          string             `bson:"teamId" json:"teamId"`
+	OptaMatchID     *string            `bson:"optaMatchId,omitempty" json:"optaMatchId"`
+	Title           string             `bson:"title" json:"title"`
+	Type            []string           `bson:"type" json:"type"`
+	Teaser          *string            `bson:"teaser" json:"teaser"`
+	Content         string             `bson:"content" json:"content"`
+	ContentText     string             `bson:"contentText" json:"-"`
+	ContentMarkdown string             `bson:"contentMarkdown" json:"-"`
+	WordCount       int                `bson:"wordCount" json:"wordCount"`
+	ReadingTime     int                `bson:"readingTime" json:"readingTime"`
+	Excerpt         string             `bson:"excerpt" json:"excerpt"`
+	URL             string             `bson:"url" json:"url"`
+	ImageURL        string             `bson:"imageUrl" json:"imageUrl"`
+	GalleryURLs     []string           `bson:"galleryUrls,omitempty" json:"galleryUrls,omitempty"`
+	VideoURL        *string            `bson:"videoUrl,omitempty" json:"videoUrl,omitempty"`
+	Published       time.Time          `bson:"published" json:"published"`
+	LastUpdated     time.Time          `bson:"lastUpdated" json:"lastUpdated"`
+	State           string             `bson:"state" json:"state"`
+}
+
+// isHidden reports whether the article should be hidden from the read endpoints by default.
+// Articles stored before publication states were introduced have no state and are treated as published.
+func (a *Article) isHidden() bool {
+	return a.State == stateUnpublished || a.State == stateWithdrawn
 }
 
 type SingleArticleResponse struct {
@@ -40,167 +67,280 @@ type MultipleArticlesResponse struct {
 	Data   []*Article `json:"data"`
 }
 
-// External XML structures
+type ArticleRevisionsResponse struct {
+	Status string             `json:"status"`
+	Data   []*ArticleRevision `json:"data"`
+}
+
+type RevisionDiffResponse struct {
+	Status string        `json:"status"`
+	Data   *RevisionDiff `json:"data"`
+}
+
+type FailedArticlesResponse struct {
+	Status string           `json:"status"`
+	Data   []*FailedArticle `json:"data"`
+}
 
-type ExternalArticleItem struct {
-	ArticleURL        string  `xml:"ArticleURL"`
-	NewsArticleID     string  `xml:"NewsArticleID"`
-	PublishDate       string  `xml:"PublishDate"`
-	Taxonomies        string  `xml:"Taxonomies"`
-	TeaserText        *string `xml:"TeaserText"`
-	Subtitle          string  `xml:"Subtitle"`
-	ThumbnailImageURL string  `xml:"ThumbnailImageURL"`
-	Title             string  `xml:"Title"`
-	BodyText          string  `xml:"BodyText"`
-	GalleryImageURLs  string  `xml:"GalleryImageURLs"`
-	VideoURL          *string `xml:"VideoURL"`
-	OptaMatchID       *string `xml:"OptaMatchId"`
-	LastUpdateDate    string  `xml:"LastUpdateDate"`
-	IsPublished       string  `xml:"IsPublished"`
+type MessageResponse struct {
+	Status string `json:"status"`
+	Data   string `json:"data"`
 }
 
-type ExternalArticleItems struct {
-	Items []ExternalArticleItem `xml:"NewsletterNewsItem"`
+type FeedStatesResponse struct {
+	Status string       `json:"status"`
+	Data   []*FeedState `json:"data"`
 }
 
-type ExternalArticleListData struct {
-	ClubName            string               `xml:"ClubName"`
-	ClubWebsiteURL      string               `xml:"ClubWebsiteURL"`
-	NewsletterNewsItems ExternalArticleItems `xml:"NewsletterNewsItems"`
+type IngestionRunsResponse struct {
+	Status   string          `json:"status"`
+	Data     []*IngestionRun `json:"data"`
+	Page     int             `json:"page"`
+	PageSize int             `json:"pageSize"`
+	Total    int64           `json:"total"`
 }
 
-type ExternalArticleData struct {
-	ClubName       string              `xml:"ClubName"`
-	ClubWebsiteURL string              `xml:"ClubWebsiteURL"`
-	NewsArticle    ExternalArticleItem `xml:"NewsArticle"`
+type IngestionRunResponse struct {
+	Status string        `json:"status"`
+	Data   *IngestionRun `json:"data"`
 }
 
-// getMissingArticlesFromDatabase retrieves missing articles by comparing the given list of articles
-// with the existing articles in the database.
-func getMissingArticlesFromDatabase(articles []Article) ([]Article, error) {
+type IngestionStatusResponse struct {
+	Status string                 `json:"status"`
+	Data   []*FeedIngestionStatus `json:"data"`
+}
+
+type FeedSchedulesResponse struct {
+	Status string          `json:"status"`
+	Data   []*FeedSchedule `json:"data"`
+}
+
+type FeedScheduleResponse struct {
+	Status string        `json:"status"`
+	Data   *FeedSchedule `json:"data"`
+}
+
+// getNewAndUpdatedArticlesFromDatabase compares the given list of articles with the existing articles of the
+// feed's club in the database and returns the full versions of the articles that are either missing from the
+// database, were updated upstream after they were stored, or were published again after being hidden. Stored
+// articles that were updated and unpublished upstream at the same time are returned as withdrawn.
+// The details of these articles are fetched by fetchChangedArticles, the number of articles whose details could
+// not be fetched is returned with them.
+func getNewAndUpdatedArticlesFromDatabase(ctx context.Context, store *Storage, feed config.Feed, articles []Article) ([]Article, int, error) {
 	var articleIDs []string
 	for _, a := range articles {
 		articleIDs = append(articleIDs, a.ArticleID)
 	}
-	collection := getArticlesCollection()
-	ctx, _ := db.GetTimeoutContext()
-
-	// Create a filter to find documents with ArticleIDs in the given list
-	filter := bson.M{"articleID": bson.M{"$in": articleIDs}}
 
-	// Execute the find operation with the filter
-	cur, err := collection.Find(ctx, filter)
+	// Find the stored articles of the club with ArticleIDs in the given list
+	storedArticles, err := store.Articles.FindByArticleIDs(ctx, feed.ClubKey, articleIDs)
 	if err != nil {
-		log.Error("Error while querying the db: ", err)
-		return nil, err
+		return nil, 0, err
 	}
-	defer cur.Close(ctx)
-
-	// Create a map to store existing ArticleIDs
-	existingArticleIDs := make(map[string]bool)
 
-	// Iterate through the cursor and store the existing ArticleIDs in the map
-	for cur.Next(ctx) {
-		var existingArticle Article
-		if err := cur.Decode(&existingArticle); err != nil {
-			return nil, err
-		}
-		existingArticleIDs[existingArticle.ArticleID] = true
+	// Create a map to store the last update time and state of the existing ArticleIDs
+	existingArticles := make(map[string]Article)
+	for _, existingArticle := range storedArticles {
+		existingArticles[existingArticle.ArticleID] = existingArticle
 	}
 
-	// Create a slice to store the missing articles
-	var missingArticles []Article
+	// Create a slice to store the articles that have to be fetched again
+	var changedArticles []Article
+	newCount, updatedCount := 0, 0
 
-	// Iterate through the input articles and check which ones are not present in the existingArticleIDs map
+	// Iterate through the input articles and check which ones are missing, have a newer upstream update time
+	// or are published upstream while hidden in the database
 	for _, article := range articles {
-		if _, found := existingArticleIDs[article.ArticleID]; !found {
-			// Article is missing, add it to the missingArticles slice
-			missingArticles = append(missingArticles, article)
+		existingArticle, found := existingArticles[article.ArticleID]
+		switch {
+		case !found:
+			newCount++
+			changedArticles = append(changedArticles, article)
+		case article.LastUpdated.After(existingArticle.LastUpdated):
+			updatedCount++
+			changedArticles = append(changedArticles, article)
+		case article.State == statePublished && existingArticle.isHidden():
+			updatedCount++
+			changedArticles = append(changedArticles, article)
 		}
 	}
+	if len(changedArticles) > 0 {
+		log.Printf("Found %v new and %v updated articles for %v", newCount, updatedCount, feed.ClubKey)
+	}
 
-	// Range through the missingArticles and call getArticleByID for each of them
-	var updatedMissingArticles []Article
-	for _, missingArticle := range missingArticles {
-		updatedArticle, err := getArticleByID(missingArticle.ArticleID)
-		if err != nil {
-			return nil, err
+	var changedIDs []string
+	for _, changedArticle := range changedArticles {
+		changedIDs = append(changedIDs, changedArticle.ArticleID)
+	}
+	fetchedArticles, failed, err := fetchChangedArticles(ctx, store, feed, changedIDs)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// An article that was stored as published or withdrawn and is unpublished upstream was taken down, storing it as
+	// unpublished would hide it from getWithdrawnArticleIDs
+	for i, fetchedArticle := range fetchedArticles {
+		existingArticle, found := existingArticles[fetchedArticle.ArticleID]
+		if found && fetchedArticle.State == stateUnpublished && existingArticle.State != stateUnpublished {
+			log.Printf("Article %v of %v was unpublished upstream, withdrawing it", fetchedArticle.ArticleID, feed.ClubKey)
+			fetchedArticles[i].State = stateWithdrawn
 		}
-		updatedMissingArticles = append(updatedMissingArticles, *updatedArticle)
 	}
 
-	// Return the updated missing articles
-	return updatedMissingArticles, nil
+	// Return the fetched articles
+	return fetchedArticles, failed, nil
 }
 
-// insertArticlesToDatabaseInBatch inserts a batch of articles into the database using bulk write operations.
-// It checks if each article already exists in the database based on its ArticleID before adding them.
-func insertArticlesToDatabaseInBatch(articles []Article) {
-	collection := getArticlesCollection()
-	ctx, _ := db.GetTimeoutContext()
-	// Prepare the bulk write operations
-	var bulkOps []mongo.WriteModel
+// fetchChangedArticles fetches the details of the given changed articles of a feed concurrently, see fetchArticles.
+// Articles whose details could not be fetched are recorded as failed articles, the failed articles that are due
+// for a retry are fetched again even when they are not among the changed ones.
+func fetchChangedArticles(ctx context.Context, store *Storage, feed config.Feed, changedIDs []string) ([]Article, int, error) {
+	// Skip the changed articles whose earlier fetches failed and are still backing off,
+	// and retry the failed articles that are due even when they are no longer in the feed
+	failures, err := store.Failures.List(ctx, feed.ClubKey)
+	if err != nil {
+		return nil, 0, err
+	}
+	now := time.Now()
+	nextRetries := make(map[string]time.Time)
+	for _, f := range failures {
+		nextRetries[f.ArticleID] = f.NextRetry
+	}
+	var fetchIDs []string
+	for _, changedID := range changedIDs {
+		if nextRetry, failed := nextRetries[changedID]; failed && nextRetry.After(now) {
+			continue
+		}
+		fetchIDs = append(fetchIDs, changedID)
+		delete(nextRetries, changedID)
+	}
+	for _, f := range failures {
+		if nextRetry, pending := nextRetries[f.ArticleID]; pending && !nextRetry.After(now) {
+			fetchIDs = append(fetchIDs, f.ArticleID)
+		}
+	}
 
-	for _, article := range articles {
-		// Create a filter to check if the article already exists in the database
-		filter := bson.M{"articleID": article.ArticleID}
+	// Fetch the details of the articles, a failed fetch does not stop the others from being stored
+	var fetchedArticles []Article
+	var failedResults []fetchResult
+	var resolvedIDs []string
+	for _, result := range fetchArticles(ctx, feed, fetchIDs) {
+		switch {
+		case result.Err == errArticleNotFound:
+			log.Printf("Article %v of %v is listed but its details are not available, skipping it", result.ArticleID, feed.ClubKey)
+			resolvedIDs = append(resolvedIDs, result.ArticleID)
+		case result.Err != nil:
+			log.Printf("Failed to fetch article %v of %v: %v", result.ArticleID, feed.ClubKey, result.Err)
+			failedResults = append(failedResults, result)
+		default:
+			fetchedArticles = append(fetchedArticles, *result.Article)
+			resolvedIDs = append(resolvedIDs, result.ArticleID)
+		}
+	}
+	recordFailedArticles(store, feed.ClubKey, failedResults)
+	clearFailedArticles(store, feed.ClubKey, resolvedIDs)
 
-		// Create the update operation. Here, we use upsert to insert the document if it doesn't exist.
-		update := bson.M{"$set": article}
+	return fetchedArticles, len(failedResults), nil
+}
 
-		updateModel := mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(update).SetUpsert(true)
-		bulkOps = append(bulkOps, updateModel)
+// getWithdrawnArticleIDs returns the IDs of the published articles of the feed's club that were taken down upstream.
+// An article is taken down when the feed marks it as unpublished, or when it should be in the feed based on its
+// publish date but is missing from it and its detail endpoint no longer returns it. The skipped items of the list
+// are still listed, so they are never taken down.
+func getWithdrawnArticleIDs(ctx context.Context, store *Storage, feed config.Feed, articles []Article, skipped []fetchResult) ([]string, error) {
+	if len(articles) == 0 {
+		return nil, nil
 	}
 
-	// Execute the bulk write operation
-	_, err := collection.BulkWrite(ctx, bulkOps)
-	if err != nil {
-		log.Println("Failed to insert article to the DB: ", err)
-		return
+	var withdrawnIDs, unpublishedIDs, listedIDs []string
+	for _, s := range skipped {
+		listedIDs = append(listedIDs, s.ArticleID)
+	}
+	oldestPublished := articles[0].Published
+	for _, a := range articles {
+		listedIDs = append(listedIDs, a.ArticleID)
+		if a.State == stateUnpublished {
+			unpublishedIDs = append(unpublishedIDs, a.ArticleID)
+		}
+		if a.Published.Before(oldestPublished) {
+			oldestPublished = a.Published
+		}
 	}
-	log.Println("Added ", len(bulkOps), " new articles.")
-}
 
-// getArticleByIDFromDatabase retrieves an article from the database based on its ID.
-func getArticleByIDFromDatabase(id string) (*Article, error) {
-	objID, err := primitive.ObjectIDFromHex(id)
+	// Articles that are visible in the database but are marked as unpublished in the feed
+	if len(unpublishedIDs) > 0 {
+		unpublishedArticles, err := store.Articles.FindByArticleIDs(ctx, feed.ClubKey, unpublishedIDs)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range unpublishedArticles {
+			if !a.isHidden() {
+				withdrawnIDs = append(withdrawnIDs, a.ArticleID)
+			}
+		}
+	}
+
+	// Articles that are visible in the database, fall into the time window of the feed but are not listed in it
+	filter := ArticleFilter{TeamID: feed.ClubKey, ExcludeArticleIDs: listedIDs, PublishedSince: oldestPublished}
+	unlistedArticles, err := store.Articles.List(ctx, filter)
 	if err != nil {
-		log.Error("could not get primitive.ObjectID from provided id. ", err)
 		return nil, err
 	}
-	var article Article
-	filter := bson.M{"_id": objID}
-	ctx, _ := db.GetTimeoutContext()
-	singleResult := getArticlesCollection().FindOne(ctx, filter)
-	if err := singleResult.Decode(&article); err != nil {
-		log.Errorf("could not find article with ID: %v, error: %v", id, err)
-		return nil, err
+	var unlistedIDs []string
+	for _, a := range unlistedArticles {
+		unlistedIDs = append(unlistedIDs, a.ArticleID)
 	}
-	return &article, nil
+	for _, result := range fetchArticles(ctx, feed, unlistedIDs) {
+		if result.Err == errArticleNotFound {
+			withdrawnIDs = append(withdrawnIDs, result.ArticleID)
+		} else if result.Err != nil {
+			log.Printf("Could not check whether article %v of %v was withdrawn: %v", result.ArticleID, feed.ClubKey, result.Err)
+		}
+	}
+	return withdrawnIDs, nil
 }
 
-// getArticleListFromDatabase retrieves a list of articles from the database.
-func getArticleListFromDatabase() ([]*Article, error) {
-	filter := bson.M{}
-	ctx, _ := db.GetTimeoutContext()
-
-	articles := make([]*Article, 0)
-	result, err := getArticlesCollection().Find(ctx, filter)
+// withdrawArticlesInDatabase marks the given articles of a team as withdrawn and returns how many were changed.
+func withdrawArticlesInDatabase(ctx context.Context, store *Storage, teamID string, articleIDs []string) (int, error) {
+	withdrawn, err := store.Articles.SetState(ctx, teamID, articleIDs, stateWithdrawn)
 	if err != nil {
-		log.Error("Could not get articles from the database. Error: ", err)
-		return nil, err
+		log.Println("Failed to withdraw articles in the DB: ", err)
+		return 0, err
 	}
-	// Iterate through the cursor to process each retrieved article.
-	for result.Next(ctx) {
-		var a Article
-		if err = result.Decode(&a); err != nil {
-			log.Fatal(err)
-		}
-		articles = append(articles, &a)
+	log.Printf("Withdrew %v articles of %v.", withdrawn, teamID)
+	return withdrawn, nil
+}
+
+// insertArticlesToDatabaseInBatch upserts a batch of articles into the database.
+// Articles that already exist in the database, based on their TeamID and ArticleID, are overwritten
+// after their current version has been stored as a revision. The content of the articles is sanitized
+// and converted to plain text and Markdown, and their reading metrics are computed first.
+// It returns how many articles were added and how many existing articles were changed.
+func insertArticlesToDatabaseInBatch(ctx context.Context, store *Storage, articles []Article) (int, int, error) {
+	for i := range articles {
+		prepareArticleContent(&articles[i])
+	}
+
+	// Keep the versions that are about to be overwritten, never overwrite without history
+	if err := saveArticleRevisions(ctx, store, articles); err != nil {
+		log.Println("Failed to store article revisions, skipping the update: ", err)
+		return 0, 0, err
 	}
-	return articles, nil
+
+	added, changed, err := store.Articles.Upsert(ctx, articles)
+	if err != nil {
+		return 0, 0, err
+	}
+	log.Printf("Added %v new articles and updated %v existing articles.", added, changed)
+	return added, changed, nil
 }
 
-func getArticlesCollection() *mongo.Collection {
-	return db.GetMongoCollection("articles")
+// getArticleByIDFromDatabase retrieves an article from the database based on its ID.
+func getArticleByIDFromDatabase(ctx context.Context, store *Storage, id string) (*Article, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		log.Error("could not get primitive.ObjectID from provided id. ", err)
+		return nil, err
+	}
+	return store.Articles.FindByID(ctx, objID)
 }
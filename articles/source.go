@@ -0,0 +1,142 @@
+package articles
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/SkaisgirisMarius/article-processor/config"
+	"sync"
+	"time"
+)
+
+// Source types a feed can choose from. A feed without a source type uses the incrowd XML feed.
+// The rss and atom types both read RSS 2.0 as well as Atom feeds, the format is detected from the document.
+// The json type reads any JSON API through the field mapping configured for the feed.
+const (
+	sourceIncrowd = "incrowd"
+	sourceRSS     = "rss"
+	sourceAtom    = "atom"
+	sourceJSON    = "json"
+)
+
+// listCacheTTL is how long the articles of a downloaded list are reused. Sources whose list is the only source of
+// the article details serve the fetches of single articles during a run from the list downloaded by the run.
+const listCacheTTL = time.Minute
+
+// errArticleNotFound is returned when the source of a feed does not return the requested article anymore.
+var errArticleNotFound = errors.New("article not found in the source")
+
+// errPagingNotSupported is returned when a page of the archive is requested from a source that cannot page.
+var errPagingNotSupported = errors.New("source does not support paging through the archive")
+
+// ArticleSource is a provider of articles for a feed. It lists the articles of the feed and fetches the full details
+// of single articles, both normalized into Article values belonging to the feed's club. The scheduler and the
+// persistence code only work with this interface, so a new provider only needs a new implementation.
+type ArticleSource interface {
+	// ListArticles lists the articles of the feed. The listed articles only need to carry the fields required to
+	// detect new and changed articles: ArticleID, Published, LastUpdated and State.
+	ListArticles(ctx context.Context, request ListRequest) (*ListResult, error)
+	// FetchArticle fetches the full details of a single article, or returns errArticleNotFound when it is gone.
+	FetchArticle(ctx context.Context, articleID string) (*Article, error)
+}
+
+// ListRequest describes which articles ListArticles should list. A zero Page lists the newest articles of the feed,
+// any other Page lists that page of the archive for a backfill. ETag and LastModified are the validators of the last
+// processed list, a source that supports conditional requests returns a NotModified result when nothing changed.
+type ListRequest struct {
+	Page         int
+	PageSize     int
+	ETag         string
+	LastModified string
+}
+
+// ListResult is the outcome of ListArticles. Skipped holds the listed items that could not be read, e.g. because
+// of an unparsable date, so that they are reported without failing the rest of the list.
+type ListResult struct {
+	Articles     []Article
+	Skipped      []fetchResult
+	StatusCode   int
+	NotModified  bool
+	ETag         string
+	LastModified string
+}
+
+// sourceFactories create the ArticleSource of a feed, keyed by the source type of the feed.
+var sourceFactories = map[string]func(feed config.Feed) (ArticleSource, error){
+	sourceIncrowd: newIncrowdSource,
+	sourceRSS:     newSyndicationSource,
+	sourceAtom:    newSyndicationSource,
+	sourceJSON:    newJSONSource,
+}
+
+// newArticleSource creates the ArticleSource of the given feed based on its source type.
+func newArticleSource(feed config.Feed) (ArticleSource, error) {
+	sourceType := feed.Source
+	if sourceType == "" {
+		sourceType = sourceIncrowd
+	}
+	factory, found := sourceFactories[sourceType]
+	if !found {
+		return nil, fmt.Errorf("feed %v has unknown source type %v", feed.ClubKey, sourceType)
+	}
+	return factory(feed)
+}
+
+// listCacheEntry is a downloaded list of articles. Its mutex is held while the list is downloaded,
+// so concurrent fetches of single articles from the same list share the download.
+type listCacheEntry struct {
+	sync.Mutex
+	fetchedAt time.Time
+	articles  []Article
+}
+
+// listCache keeps the last downloaded list of articles of every list URL. Its mutex only guards the map,
+// so downloading one list never blocks the lookups in another one.
+var listCache = struct {
+	sync.Mutex
+	entries map[string]*listCacheEntry
+}{entries: make(map[string]*listCacheEntry)}
+
+// listCacheEntryFor returns the cache entry of the given list URL, adding an empty one when there is none yet.
+func listCacheEntryFor(listURL string) *listCacheEntry {
+	listCache.Lock()
+	defer listCache.Unlock()
+	entry, found := listCache.entries[listURL]
+	if !found {
+		entry = &listCacheEntry{}
+		listCache.entries[listURL] = entry
+	}
+	return entry
+}
+
+// cacheListedArticles stores the articles listed at the given URL.
+func cacheListedArticles(listURL string, articles []Article) {
+	entry := listCacheEntryFor(listURL)
+	entry.Lock()
+	defer entry.Unlock()
+	entry.fetchedAt, entry.articles = time.Now(), articles
+}
+
+// findListedArticle looks an article up in the list downloaded from the given URL. The list is loaded again
+// with the given function when it is not cached or the cached copy is too old.
+func findListedArticle(listURL string, articleID string, load func() ([]Article, error)) (*Article, error) {
+	entry := listCacheEntryFor(listURL)
+	entry.Lock()
+	defer entry.Unlock()
+
+	if entry.fetchedAt.IsZero() || time.Since(entry.fetchedAt) > listCacheTTL {
+		articles, err := load()
+		if err != nil {
+			return nil, err
+		}
+		entry.fetchedAt, entry.articles = time.Now(), articles
+	}
+
+	for i := range entry.articles {
+		if entry.articles[i].ArticleID == articleID {
+			article := entry.articles[i]
+			return &article, nil
+		}
+	}
+	return nil, errArticleNotFound
+}
@@ -0,0 +1,230 @@
+package articles
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/SkaisgirisMarius/article-processor/config"
+	"github.com/SkaisgirisMarius/article-processor/upstream"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+)
+
+// externalDateLayout is the layout of the dates returned by the incrowd XML endpoints.
+const externalDateLayout = "2006-01-02 15:04:05"
+
+// External XML structures
+
+type ExternalArticleItem struct {
+	ArticleURL        string  `xml:"ArticleURL"`
+	NewsArticleID     string  `xml:"NewsArticleID"`
+	PublishDate       string  `xml:"PublishDate"`
+	Taxonomies        string  `xml:"Taxonomies"`
+	TeaserText        *string `xml:"TeaserText"`
+	Subtitle          string  `xml:"Subtitle"`
+	ThumbnailImageURL string  `xml:"ThumbnailImageURL"`
+	Title             string  `xml:"Title"`
+	BodyText          string  `xml:"BodyText"`
+	GalleryImageURLs  string  `xml:"GalleryImageURLs"`
+	VideoURL          *string `xml:"VideoURL"`
+	OptaMatchID       *string `xml:"OptaMatchId"`
+	LastUpdateDate    string  `xml:"LastUpdateDate"`
+	IsPublished       string  `xml:"IsPublished"`
+}
+
+type ExternalArticleItems struct {
+	Items []ExternalArticleItem `xml:"NewsletterNewsItem"`
+}
+
+type ExternalArticleListData struct {
+	ClubName            string               `xml:"ClubName"`
+	ClubWebsiteURL      string               `xml:"ClubWebsiteURL"`
+	NewsletterNewsItems ExternalArticleItems `xml:"NewsletterNewsItems"`
+}
+
+type ExternalArticleData struct {
+	ClubName       string              `xml:"ClubName"`
+	ClubWebsiteURL string              `xml:"ClubWebsiteURL"`
+	NewsArticle    ExternalArticleItem `xml:"NewsArticle"`
+}
+
+// incrowdSource is the ArticleSource of the incrowd XML feeds. The article list comes from the feed's ListURL,
+// or from its Backfill URL for a page of the archive, and the details of an article from its ArticleURL.
+type incrowdSource struct {
+	feed  config.Feed
+	dates dateParser
+}
+
+// newIncrowdSource creates the incrowd ArticleSource of the given feed.
+func newIncrowdSource(feed config.Feed) (ArticleSource, error) {
+	dates, err := newDateParser(feed, defaultDateLayouts)
+	if err != nil {
+		return nil, err
+	}
+	return &incrowdSource{feed: feed, dates: dates}, nil
+}
+
+// ListArticles retrieves the article list of the feed with a conditional GET request and reads its XML content.
+func (s *incrowdSource) ListArticles(ctx context.Context, request ListRequest) (*ListResult, error) {
+	listURL := s.feed.ListURL
+	if request.Page > 0 {
+		if s.feed.Backfill.URL == "" {
+			return nil, errPagingNotSupported
+		}
+		listURL = s.feed.Backfill.PageURL(request.Page, request.PageSize)
+	}
+
+	response, err := upstream.GetClient().GetConditional(ctx, listURL, request.ETag, request.LastModified)
+	if err != nil {
+		log.Println("Error getting the article list:", err)
+		return nil, err
+	}
+	result := &ListResult{
+		StatusCode:   response.StatusCode,
+		NotModified:  response.NotModified(),
+		ETag:         response.ETag,
+		LastModified: response.LastModified,
+	}
+	if result.NotModified {
+		return result, nil
+	}
+
+	result.Articles, result.Skipped, err = readXMLContent(string(response.Body), s.feed.ClubKey, s.dates)
+	if err != nil {
+		log.Println("Error reading XML: ", err)
+		return nil, err
+	}
+	return result, nil
+}
+
+// readXMLContent takes the XML content as input, unmarshals it into the ExternalArticleListData struct,
+// and transforms the received XML feeds into a slice of Article structs belonging to the given team.
+// Items whose dates cannot be parsed are skipped and returned separately.
+func readXMLContent(xmlContent string, teamID string, dates dateParser) ([]Article, []fetchResult, error) {
+	var result ExternalArticleListData
+	err := xml.Unmarshal([]byte(xmlContent), &result)
+	if err != nil {
+		log.Println("Failed to unmarshal XML: ", err)
+		return nil, nil, err
+	}
+
+	// Transform the received XML feeds into the Article struct
+	var articles []Article
+	var skipped []fetchResult
+	for _, item := range result.NewsletterNewsItems.Items {
+		publishDate, err := dates.parse(item.PublishDate)
+		if err != nil {
+			log.Printf("Skipping article %v of %v, failed to parse publish date: %v", item.NewsArticleID, teamID, err)
+			skipped = append(skipped, fetchResult{ArticleID: item.NewsArticleID, Err: fmt.Errorf("invalid publish date: %w", err)})
+			continue
+		}
+		lastUpdated, err := dates.parseOptional(item.LastUpdateDate)
+		if err != nil {
+			log.Printf("Skipping article %v of %v, failed to parse last update date: %v", item.NewsArticleID, teamID, err)
+			skipped = append(skipped, fetchResult{ArticleID: item.NewsArticleID, Err: fmt.Errorf("invalid last update date: %w", err)})
+			continue
+		}
+		article := Article{
+			ArticleID:   item.NewsArticleID,
+			TeamID:      teamID,
+			OptaMatchID: nil,
+			Title:       item.Title,
+			Type:        normalizeTaxonomies(splitList(item.Taxonomies)),
+			Teaser:      item.TeaserText,
+			URL:         item.ArticleURL,
+			ImageURL:    item.ThumbnailImageURL,
+			Published:   publishDate,
+			LastUpdated: lastUpdated,
+			State:       externalPublicationState(item.IsPublished),
+		}
+		articles = append(articles, article)
+	}
+	return articles, skipped, nil
+}
+
+// readXMLContentForSingleArticle takes the XML content for a single article as input, unmarshals it into the ExternalArticleData struct,
+// and creates an Article struct belonging to the given team from the parsed data.
+func readXMLContentForSingleArticle(xmlContent string, teamID string, dates dateParser) (*Article, error) {
+	var result *ExternalArticleData
+	err := xml.Unmarshal([]byte(xmlContent), &result)
+	if err != nil {
+		log.Println("Failed to unmarshal XML: ", err)
+		return nil, err
+	}
+
+	// Check if there are any items in the XML
+	if result == nil {
+		return nil, fmt.Errorf("no articles found in the XML")
+	}
+	if result.NewsArticle.NewsArticleID == "" {
+		return nil, errArticleNotFound
+	}
+
+	publishDate, err := dates.parse(result.NewsArticle.PublishDate)
+	if err != nil {
+		log.Println("Failed to parse publish date: ", err)
+		return nil, err
+	}
+	lastUpdated, err := dates.parseOptional(result.NewsArticle.LastUpdateDate)
+	if err != nil {
+		log.Println("Failed to parse last update date: ", err)
+		return nil, err
+	}
+
+	// Create and return the Article struct
+	article := &Article{
+		ArticleID:   result.NewsArticle.NewsArticleID,
+		TeamID:      teamID,
+		OptaMatchID: result.NewsArticle.OptaMatchID,
+		Title:       result.NewsArticle.Title,
+		Type:        normalizeTaxonomies(splitList(result.NewsArticle.Taxonomies)),
+		Teaser:      result.NewsArticle.TeaserText,
+		Content:     result.NewsArticle.BodyText,
+		URL:         result.NewsArticle.ArticleURL,
+		ImageURL:    result.NewsArticle.ThumbnailImageURL,
+		GalleryURLs: splitList(result.NewsArticle.GalleryImageURLs),
+		VideoURL:    result.NewsArticle.VideoURL,
+		Published:   publishDate,
+		LastUpdated: lastUpdated,
+		State:       externalPublicationState(result.NewsArticle.IsPublished),
+	}
+
+	return article, nil
+}
+
+// externalPublicationState maps the IsPublished flag of an external article to a publication state.
+// Articles without the flag are treated as published.
+func externalPublicationState(isPublished string) string {
+	if strings.EqualFold(strings.TrimSpace(isPublished), "false") {
+		return stateUnpublished
+	}
+	return statePublished
+}
+
+// FetchArticle retrieves an article from the feed's detail URL by sending a GET request with the given ID
+// through the shared upstream client. It reads the XML response body, parses it into an Article struct using the readXMLContentForSingleArticle function,
+// and returns the resulting article or an error if any occurred during the process.
+// The request is cancelled together with the given context.
+func (s *incrowdSource) FetchArticle(ctx context.Context, id string) (*Article, error) {
+	bodyContent, err := upstream.GetClient().Get(ctx, s.feed.DetailURL(id))
+	var statusErr *upstream.StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		return nil, errArticleNotFound
+	}
+	if err != nil {
+		log.Println("Error getting the article:", err)
+		return nil, err
+	}
+
+	article, err := readXMLContentForSingleArticle(string(bodyContent), s.feed.ClubKey, s.dates)
+	if err == errArticleNotFound {
+		return nil, err
+	}
+	if err != nil {
+		log.Println("Error reading XML: ", err)
+		return nil, err
+	}
+	return article, nil
+}
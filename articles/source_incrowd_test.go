@@ -0,0 +1,98 @@
+package articles
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/SkaisgirisMarius/article-processor/config"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// assertGoldenJSON compares the JSON encoding of the value with the golden file in the testdata directory.
+func assertGoldenJSON(t *testing.T, name string, value interface{}) {
+	actual, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		t.Fatal("Failed to encode the articles: ", err)
+	}
+	goldenFile := filepath.Join("testdata", name+".golden.json")
+	if *updateGolden {
+		if err := os.WriteFile(goldenFile, append(actual, '\n'), 0644); err != nil {
+			t.Fatal("Failed to update the golden file: ", err)
+		}
+	}
+	expected, err := os.ReadFile(goldenFile)
+	if err != nil {
+		t.Fatal("Failed to read the golden file, run the test with -update to create it: ", err)
+	}
+	assert.Equal(t, strings.TrimSpace(string(expected)), string(actual))
+}
+
+// The golden files hold the articles the incrowd source produces from the sample responses. They started as the
+// output of the XML parsing before it was moved behind ArticleSource and only change with intended changes to the
+// articles, such as the normalized taxonomies and gallery image URLs.
+func TestIncrowdSourceMatchesPreviousParsing(t *testing.T) {
+	config.GetConfig("../conf_test.yaml")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := "incrowd_list.xml"
+		if r.URL.Path == "/article" {
+			name = "incrowd_article.xml"
+		}
+		http.ServeFile(w, r, filepath.Join("testdata", name))
+	}))
+	defer server.Close()
+
+	source, err := newArticleSource(config.Feed{ClubKey: "htafc", ListURL: server.URL + "/list", ArticleURL: server.URL + "/article?id={id}"})
+	assert.NoError(t, err)
+
+	result, err := source.ListArticles(context.Background(), ListRequest{})
+	assert.NoError(t, err)
+	assertGoldenJSON(t, "incrowd_list", result.Articles)
+
+	article, err := source.FetchArticle(context.Background(), "611234")
+	assert.NoError(t, err)
+	assertGoldenJSON(t, "incrowd_article", article)
+}
+
+func TestReadXMLContentParsesDatesInFeedTimezone(t *testing.T) {
+	dates, err := newDateParser(config.Feed{Timezone: "Europe/London"}, defaultDateLayouts)
+	assert.NoError(t, err)
+
+	articles, skipped, err := readXMLContent(`<?xml version="1.0" encoding="utf-8"?>
+<NewListInformation>
+	<NewsletterNewsItems>
+		<NewsletterNewsItem>
+			<NewsArticleID>1</NewsArticleID>
+			<PublishDate>2023-07-01 10:00:00</PublishDate>
+			<LastUpdateDate>2023-07-01 11:30:00</LastUpdateDate>
+		</NewsletterNewsItem>
+		<NewsletterNewsItem>
+			<NewsArticleID>2</NewsArticleID>
+			<PublishDate>01/07/2023 10:00</PublishDate>
+		</NewsletterNewsItem>
+		<NewsletterNewsItem>
+			<NewsArticleID>3</NewsArticleID>
+			<PublishDate>Sat, 14 Jan 2023 15:00:00 GMT</PublishDate>
+		</NewsletterNewsItem>
+		<NewsletterNewsItem>
+			<NewsArticleID>4</NewsArticleID>
+			<PublishDate>2023-07-01T10:00:00Z</PublishDate>
+		</NewsletterNewsItem>
+	</NewsletterNewsItems>
+</NewListInformation>`, "test", dates)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(articles))
+	assert.Equal(t, time.Date(2023, 7, 1, 9, 0, 0, 0, time.UTC), articles[0].Published)
+	assert.Equal(t, time.Date(2023, 7, 1, 10, 30, 0, 0, time.UTC), articles[0].LastUpdated)
+	assert.Equal(t, time.Date(2023, 1, 14, 15, 0, 0, 0, time.UTC), articles[1].Published)
+	assert.Equal(t, time.Date(2023, 7, 1, 10, 0, 0, 0, time.UTC), articles[2].Published)
+	assert.Equal(t, 1, len(skipped))
+	assert.Equal(t, "2", skipped[0].ArticleID)
+	assert.Error(t, skipped[0].Err)
+}
@@ -0,0 +1,286 @@
+package articles
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/SkaisgirisMarius/article-processor/config"
+	"github.com/SkaisgirisMarius/article-processor/upstream"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Formats of numeric publish dates in JSON feeds, any other publishedFormat is a Go time layout.
+const (
+	jsonFormatUnix      = "unix"
+	jsonFormatUnixMilli = "unixMilli"
+)
+
+// jsonSource is the ArticleSource of JSON feeds. The configuration of the feed declares where the articles are in
+// the responses and which field of an article maps onto which Article field, so a new provider needs no code.
+type jsonSource struct {
+	feed       config.Feed
+	itemsPath  jsonPath
+	detailPath jsonPath
+	fields     map[string]jsonPath
+	dates      dateParser
+}
+
+// newJSONSource creates the JSON ArticleSource of the given feed, validating its field mapping.
+func newJSONSource(feed config.Feed) (ArticleSource, error) {
+	mapping := feed.JSON
+	if mapping.Fields.ID == "" {
+		return nil, fmt.Errorf("feed %v has no JSON path for the article id", feed.ClubKey)
+	}
+	source := &jsonSource{feed: feed, fields: make(map[string]jsonPath)}
+
+	layouts := defaultDateLayouts
+	if format := mapping.PublishedFormat; format != "" && format != jsonFormatUnix && format != jsonFormatUnixMilli {
+		layouts = []string{format}
+	}
+	var err error
+	if source.dates, err = newDateParser(feed, layouts); err != nil {
+		return nil, err
+	}
+	if source.itemsPath, err = parseJSONPath(mapping.ItemsPath); err != nil {
+		return nil, err
+	}
+	if source.detailPath, err = parseJSONPath(mapping.DetailPath); err != nil {
+		return nil, err
+	}
+	fieldPaths := map[string]string{
+		"id":         mapping.Fields.ID,
+		"title":      mapping.Fields.Title,
+		"teaser":     mapping.Fields.Teaser,
+		"body":       mapping.Fields.Body,
+		"image":      mapping.Fields.Image,
+		"url":        mapping.Fields.URL,
+		"categories": mapping.Fields.Categories,
+		"published":  mapping.Fields.Published,
+		"updated":    mapping.Fields.Updated,
+	}
+	for field, path := range fieldPaths {
+		if path == "" {
+			continue
+		}
+		if source.fields[field], err = parseJSONPath(path); err != nil {
+			return nil, err
+		}
+	}
+	return source, nil
+}
+
+// ListArticles retrieves the article list of the feed with a conditional GET request and maps its items onto articles.
+// Pages of the archive are read from the feed's Backfill URL.
+func (s *jsonSource) ListArticles(ctx context.Context, request ListRequest) (*ListResult, error) {
+	listURL := s.feed.ListURL
+	if request.Page > 0 {
+		if s.feed.Backfill.URL == "" {
+			return nil, errPagingNotSupported
+		}
+		listURL = s.feed.Backfill.PageURL(request.Page, request.PageSize)
+	}
+
+	response, err := upstream.GetClient().GetConditional(ctx, listURL, request.ETag, request.LastModified)
+	if err != nil {
+		log.Println("Error getting the article list:", err)
+		return nil, err
+	}
+	result := &ListResult{
+		StatusCode:   response.StatusCode,
+		NotModified:  response.NotModified(),
+		ETag:         response.ETag,
+		LastModified: response.LastModified,
+	}
+	if result.NotModified {
+		return result, nil
+	}
+
+	result.Articles, result.Skipped, err = s.readList(response.Body)
+	if err != nil {
+		log.Println("Error reading JSON: ", err)
+		return nil, err
+	}
+	if request.Page == 0 {
+		cacheListedArticles(s.feed.ListURL, result.Articles)
+	}
+	return result, nil
+}
+
+// FetchArticle retrieves a single article from the feed's detail URL, or looks it up in the list
+// when the feed has no detail URL.
+func (s *jsonSource) FetchArticle(ctx context.Context, articleID string) (*Article, error) {
+	if s.feed.ArticleURL == "" {
+		return findListedArticle(s.feed.ListURL, articleID, func() ([]Article, error) {
+			body, err := upstream.GetClient().Get(ctx, s.feed.ListURL)
+			if err != nil {
+				log.Println("Error getting the article list:", err)
+				return nil, err
+			}
+			articles, _, err := s.readList(body)
+			return articles, err
+		})
+	}
+
+	body, err := upstream.GetClient().Get(ctx, s.feed.DetailURL(articleID))
+	var statusErr *upstream.StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		return nil, errArticleNotFound
+	}
+	if err != nil {
+		log.Println("Error getting the article:", err)
+		return nil, err
+	}
+	document, err := decodeJSON(body)
+	if err != nil {
+		log.Println("Error reading JSON: ", err)
+		return nil, err
+	}
+	item, found := s.detailPath.lookup(document)
+	if !found || item == nil {
+		return nil, errArticleNotFound
+	}
+	article, err := s.mapArticle(item)
+	if err != nil {
+		return nil, err
+	}
+	return &article, nil
+}
+
+// readList maps the items of a JSON list response onto articles. Items without an id are skipped, items that
+// cannot be mapped otherwise are skipped and returned separately.
+func (s *jsonSource) readList(body []byte) ([]Article, []fetchResult, error) {
+	document, err := decodeJSON(body)
+	if err != nil {
+		return nil, nil, err
+	}
+	value, found := s.itemsPath.lookup(document)
+	items, isArray := value.([]interface{})
+	if !found || !isArray {
+		return nil, nil, fmt.Errorf("no array of articles found at %q", s.feed.JSON.ItemsPath)
+	}
+
+	articles := make([]Article, 0, len(items))
+	var skipped []fetchResult
+	for i, item := range items {
+		article, err := s.mapArticle(item)
+		if err != nil {
+			log.Printf("Skipping article %v of %v: %v", i, s.feed.ClubKey, err)
+			if article.ArticleID != "" {
+				skipped = append(skipped, fetchResult{ArticleID: article.ArticleID, Err: err})
+			}
+			continue
+		}
+		articles = append(articles, article)
+	}
+	return articles, skipped, nil
+}
+
+// mapArticle maps a single JSON article onto an Article through the configured field paths.
+func (s *jsonSource) mapArticle(item interface{}) (Article, error) {
+	article := Article{
+		ArticleID: s.stringField(item, "id"),
+		TeamID:    s.feed.ClubKey,
+		Title:     s.stringField(item, "title"),
+		Type:      normalizeTaxonomies(s.listField(item, "categories")),
+		Teaser:    optionalText(s.stringField(item, "teaser")),
+		Content:   s.stringField(item, "body"),
+		URL:       s.stringField(item, "url"),
+		ImageURL:  s.stringField(item, "image"),
+		State:     statePublished,
+	}
+	if article.ArticleID == "" {
+		return article, errors.New("article has no id")
+	}
+
+	var err error
+	if article.Published, err = s.timeField(item, "published"); err != nil {
+		return article, fmt.Errorf("failed to parse publish date: %w", err)
+	}
+	if article.LastUpdated, err = s.timeField(item, "updated"); err != nil {
+		return article, fmt.Errorf("failed to parse last update date: %w", err)
+	}
+	return article, nil
+}
+
+// stringField returns the value of a mapped field as a trimmed string, or an empty string when it is missing.
+func (s *jsonSource) stringField(item interface{}, field string) string {
+	path, mapped := s.fields[field]
+	if !mapped {
+		return ""
+	}
+	value, _ := path.lookup(item)
+	return strings.TrimSpace(jsonString(value))
+}
+
+// listField returns the value of a mapped field as a list of strings. A single value is split on the list delimiters.
+func (s *jsonSource) listField(item interface{}, field string) []string {
+	path, mapped := s.fields[field]
+	if !mapped {
+		return nil
+	}
+	value, _ := path.lookup(item)
+	if values, isArray := value.([]interface{}); isArray {
+		var result []string
+		for _, v := range values {
+			result = append(result, jsonString(v))
+		}
+		return trimmedValues(result)
+	}
+	return splitList(jsonString(value))
+}
+
+// timeField parses the value of a mapped date field with the feed's publishedFormat, or the accepted date layouts
+// of the feed when it has none, and returns it in UTC. A missing value gives the zero time.
+func (s *jsonSource) timeField(item interface{}, field string) (time.Time, error) {
+	value := s.stringField(item, field)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	switch format := s.feed.JSON.PublishedFormat; format {
+	case jsonFormatUnix, jsonFormatUnixMilli:
+		timestamp, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if format == jsonFormatUnixMilli {
+			return time.UnixMilli(timestamp).UTC(), nil
+		}
+		return time.Unix(timestamp, 0).UTC(), nil
+	default:
+		return s.dates.parse(value)
+	}
+}
+
+// decodeJSON decodes a JSON document, keeping numbers as json.Number so that numeric ids are not rounded.
+func decodeJSON(body []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var document interface{}
+	if err := decoder.Decode(&document); err != nil {
+		return nil, err
+	}
+	return document, nil
+}
+
+// jsonString converts a decoded JSON scalar to a string. Objects and arrays are converted back to JSON.
+func jsonString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		encoded, _ := json.Marshal(v)
+		return string(encoded)
+	}
+}
@@ -0,0 +1,111 @@
+package articles
+
+import (
+	"github.com/SkaisgirisMarius/article-processor/config"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParseJSONPath(t *testing.T) {
+	document, err := decodeJSON([]byte(`{"data": {"items": [{"id": 1}, {"id": 12345678901234567, "media": {"image-url": "a.jpg"}}]}}`))
+	assert.NoError(t, err)
+
+	for path, expected := range map[string]string{
+		"$.data.items[1].id":                 "12345678901234567",
+		"data.items[0].id":                   "1",
+		"$.data.items[1].media['image-url']": "a.jpg",
+		`$["data"].items[1].media`:           `{"image-url":"a.jpg"}`,
+	} {
+		parsed, err := parseJSONPath(path)
+		assert.NoError(t, err, path)
+		value, found := parsed.lookup(document)
+		assert.True(t, found, path)
+		assert.Equal(t, expected, jsonString(value), path)
+	}
+
+	missing, _ := parseJSONPath("$.data.items[5].id")
+	_, found := missing.lookup(document)
+	assert.False(t, found)
+
+	_, err = parseJSONPath("$.data['items")
+	assert.Error(t, err)
+}
+
+func TestJSONSourceMapsJSONFeedItems(t *testing.T) {
+	feed := config.Feed{
+		ClubKey: "test",
+		Source:  sourceJSON,
+		JSON: config.JSONFeed{
+			ItemsPath: "$.items",
+			Fields: config.JSONFields{
+				ID:         "id",
+				Title:      "title",
+				Teaser:     "summary",
+				Body:       "content_html",
+				Image:      "image",
+				URL:        "url",
+				Categories: "tags",
+				Published:  "date_published",
+				Updated:    "date_modified",
+			},
+		},
+	}
+	source, err := newArticleSource(feed)
+	assert.NoError(t, err)
+
+	articles, _, err := source.(*jsonSource).readList([]byte(`{
+		"version": "https://jsonfeed.org/version/1.1",
+		"title": "Club News",
+		"items": [
+			{
+				"id": "2023-07-01-new-kit",
+				"url": "https://club.example/news/new-kit",
+				"title": "New home kit revealed",
+				"summary": "The club has revealed its home kit for the new season.",
+				"content_html": "<p>The club has revealed its home kit.</p>",
+				"image": "https://club.example/images/kit.jpg",
+				"date_published": "2023-07-01T10:00:00+01:00",
+				"date_modified": "2023-07-01T11:30:00+01:00",
+				"tags": ["Club News", "Retail"]
+			},
+			{"title": "An item without an id is skipped"}
+		]
+	}`))
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(articles))
+	article := articles[0]
+	assert.Equal(t, "2023-07-01-new-kit", article.ArticleID)
+	assert.Equal(t, "test", article.TeamID)
+	assert.Equal(t, "New home kit revealed", article.Title)
+	assert.Equal(t, "The club has revealed its home kit for the new season.", *article.Teaser)
+	assert.Equal(t, "<p>The club has revealed its home kit.</p>", article.Content)
+	assert.Equal(t, "https://club.example/images/kit.jpg", article.ImageURL)
+	assert.Equal(t, []string{"club-news", "Retail"}, article.Type)
+	assert.Equal(t, time.Date(2023, 7, 1, 9, 0, 0, 0, time.UTC), article.Published)
+	assert.Equal(t, time.Date(2023, 7, 1, 10, 30, 0, 0, time.UTC), article.LastUpdated)
+}
+
+func TestJSONSourceParsesUnixTimestamps(t *testing.T) {
+	feed := config.Feed{
+		ClubKey: "test",
+		JSON: config.JSONFeed{
+			ItemsPath:       "$.data.articles",
+			PublishedFormat: jsonFormatUnixMilli,
+			Fields:          config.JSONFields{ID: "$.articleId", Title: "$.headline.text", Published: "$.publishedAt"},
+		},
+	}
+	source, err := newJSONSource(feed)
+	assert.NoError(t, err)
+
+	articles, _, err := source.(*jsonSource).readList([]byte(`{"data": {"articles": [
+		{"articleId": 991, "headline": {"text": "Match preview"}, "publishedAt": 1688205600000}
+	]}}`))
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(articles))
+	assert.Equal(t, "991", articles[0].ArticleID)
+	assert.Equal(t, "Match preview", articles[0].Title)
+	assert.Equal(t, time.Date(2023, 7, 1, 10, 0, 0, 0, time.UTC), articles[0].Published)
+}
@@ -0,0 +1,318 @@
+package articles
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"github.com/SkaisgirisMarius/article-processor/config"
+	"github.com/SkaisgirisMarius/article-processor/upstream"
+	log "github.com/sirupsen/logrus"
+	"strings"
+	"time"
+)
+
+// syndicationDateLayouts are the date layouts used by RSS (RFC 822 dates) and Atom (RFC 3339 dates) feeds.
+var syndicationDateLayouts = []string{time.RFC1123Z, time.RFC1123, time.RFC3339, "Mon, 2 Jan 2006 15:04:05 -0700", "2 Jan 2006 15:04:05 -0700"}
+
+// RSS 2.0 structures
+
+type rssDocument struct {
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Items []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	GUID            string         `xml:"guid"`
+	Link            string         `xml:"link"`
+	Title           string         `xml:"title"`
+	Description     string         `xml:"description"`
+	ContentEncoded  string         `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	PubDate         string         `xml:"pubDate"`
+	Categories      []string       `xml:"category"`
+	Enclosures      []rssEnclosure `xml:"enclosure"`
+	MediaThumbnails []mediaElement `xml:"http://search.yahoo.com/mrss/ thumbnail"`
+	MediaContents   []mediaElement `xml:"http://search.yahoo.com/mrss/ content"`
+}
+
+type rssEnclosure struct {
+	URL  string `xml:"url,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type mediaElement struct {
+	URL    string `xml:"url,attr"`
+	Medium string `xml:"medium,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// Atom structures
+
+type atomDocument struct {
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	ID              string         `xml:"id"`
+	Title           string         `xml:"title"`
+	Summary         atomText       `xml:"summary"`
+	Content         atomText       `xml:"content"`
+	Published       string         `xml:"published"`
+	Updated         string         `xml:"updated"`
+	Links           []atomLink     `xml:"link"`
+	Categories      []atomCategory `xml:"category"`
+	MediaThumbnails []mediaElement `xml:"http://search.yahoo.com/mrss/ thumbnail"`
+}
+
+// atomText is an Atom text construct. XHTML content is kept as markup, text and HTML content as its character data.
+type atomText struct {
+	Type     string `xml:"type,attr"`
+	Text     string `xml:",chardata"`
+	InnerXML string `xml:",innerxml"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+// syndicationSource is the ArticleSource of RSS 2.0 and Atom feeds read from the feed's ListURL.
+// The feed items already carry the full articles, so single articles are looked up in the feed.
+type syndicationSource struct {
+	feed  config.Feed
+	dates dateParser
+}
+
+// newSyndicationSource creates the RSS/Atom ArticleSource of the given feed.
+func newSyndicationSource(feed config.Feed) (ArticleSource, error) {
+	dates, err := newDateParser(feed, syndicationDateLayouts)
+	if err != nil {
+		return nil, err
+	}
+	return &syndicationSource{feed: feed, dates: dates}, nil
+}
+
+// ListArticles downloads the feed with a conditional GET request and maps its items onto articles.
+func (s *syndicationSource) ListArticles(ctx context.Context, request ListRequest) (*ListResult, error) {
+	if request.Page > 0 {
+		return nil, errPagingNotSupported
+	}
+	response, err := upstream.GetClient().GetConditional(ctx, s.feed.ListURL, request.ETag, request.LastModified)
+	if err != nil {
+		log.Println("Error getting the syndication feed:", err)
+		return nil, err
+	}
+	result := &ListResult{
+		StatusCode:   response.StatusCode,
+		NotModified:  response.NotModified(),
+		ETag:         response.ETag,
+		LastModified: response.LastModified,
+	}
+	if result.NotModified {
+		return result, nil
+	}
+
+	result.Articles, result.Skipped, err = readSyndicationFeed(response.Body, s.feed.ClubKey, s.dates)
+	if err != nil {
+		log.Println("Error reading syndication feed: ", err)
+		return nil, err
+	}
+	cacheListedArticles(s.feed.ListURL, result.Articles)
+	return result, nil
+}
+
+// FetchArticle looks the article up in the feed, which is downloaded again when the cached copy is too old.
+func (s *syndicationSource) FetchArticle(ctx context.Context, articleID string) (*Article, error) {
+	return findListedArticle(s.feed.ListURL, articleID, func() ([]Article, error) {
+		body, err := upstream.GetClient().Get(ctx, s.feed.ListURL)
+		if err != nil {
+			log.Println("Error getting the syndication feed:", err)
+			return nil, err
+		}
+		articles, _, err := readSyndicationFeed(body, s.feed.ClubKey, s.dates)
+		return articles, err
+	})
+}
+
+// readSyndicationFeed detects whether the document is an RSS 2.0 or an Atom feed and maps its items onto
+// articles belonging to the given team. Items whose dates cannot be parsed are skipped and returned separately.
+func readSyndicationFeed(content []byte, teamID string, dates dateParser) ([]Article, []fetchResult, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not find the root element of the feed: %w", err)
+		}
+		root, isStart := token.(xml.StartElement)
+		if !isStart {
+			continue
+		}
+		switch root.Name.Local {
+		case "rss":
+			return readRSSFeed(content, teamID, dates)
+		case "feed":
+			return readAtomFeed(content, teamID, dates)
+		default:
+			return nil, nil, fmt.Errorf("unsupported feed format with root element %v", root.Name.Local)
+		}
+	}
+}
+
+// readRSSFeed maps the items of an RSS 2.0 feed onto articles. The guid becomes the ArticleID (the link when
+// there is no guid), the description the Teaser and content:encoded the Content.
+func readRSSFeed(content []byte, teamID string, dates dateParser) ([]Article, []fetchResult, error) {
+	var document rssDocument
+	if err := xml.Unmarshal(content, &document); err != nil {
+		log.Println("Failed to unmarshal RSS: ", err)
+		return nil, nil, err
+	}
+
+	articles := make([]Article, 0, len(document.Channel.Items))
+	var skipped []fetchResult
+	for _, item := range document.Channel.Items {
+		articleID := strings.TrimSpace(item.GUID)
+		if articleID == "" {
+			articleID = strings.TrimSpace(item.Link)
+		}
+		publishDate, err := dates.parse(item.PubDate)
+		if err != nil {
+			log.Printf("Skipping article %v of %v, failed to parse publish date: %v", articleID, teamID, err)
+			skipped = append(skipped, fetchResult{ArticleID: articleID, Err: fmt.Errorf("invalid publish date: %w", err)})
+			continue
+		}
+		articles = append(articles, Article{
+			ArticleID: articleID,
+			TeamID:    teamID,
+			Title:     strings.TrimSpace(item.Title),
+			Type:      normalizeTaxonomies(item.Categories),
+			Teaser:    optionalText(item.Description),
+			Content:   strings.TrimSpace(item.ContentEncoded),
+			URL:       strings.TrimSpace(item.Link),
+			ImageURL:  rssImageURL(item),
+			Published: publishDate,
+			State:     statePublished,
+		})
+	}
+	return articles, skipped, nil
+}
+
+// readAtomFeed maps the entries of an Atom feed onto articles. The id becomes the ArticleID,
+// the summary the Teaser and the content the Content.
+func readAtomFeed(content []byte, teamID string, dates dateParser) ([]Article, []fetchResult, error) {
+	var document atomDocument
+	if err := xml.Unmarshal(content, &document); err != nil {
+		log.Println("Failed to unmarshal Atom: ", err)
+		return nil, nil, err
+	}
+
+	articles := make([]Article, 0, len(document.Entries))
+	var skipped []fetchResult
+	for _, entry := range document.Entries {
+		articleID := strings.TrimSpace(entry.ID)
+		published := entry.Published
+		if published == "" {
+			published = entry.Updated
+		}
+		publishDate, err := dates.parse(published)
+		if err != nil {
+			log.Printf("Skipping article %v of %v, failed to parse publish date: %v", articleID, teamID, err)
+			skipped = append(skipped, fetchResult{ArticleID: articleID, Err: fmt.Errorf("invalid publish date: %w", err)})
+			continue
+		}
+		lastUpdated, err := dates.parseOptional(entry.Updated)
+		if err != nil {
+			log.Printf("Skipping article %v of %v, failed to parse last update date: %v", articleID, teamID, err)
+			skipped = append(skipped, fetchResult{ArticleID: articleID, Err: fmt.Errorf("invalid last update date: %w", err)})
+			continue
+		}
+
+		var categories []string
+		for _, category := range entry.Categories {
+			categories = append(categories, category.Term)
+		}
+		var imageURL string
+		if len(entry.MediaThumbnails) > 0 {
+			imageURL = entry.MediaThumbnails[0].URL
+		}
+
+		articles = append(articles, Article{
+			ArticleID:   articleID,
+			TeamID:      teamID,
+			Title:       strings.TrimSpace(entry.Title),
+			Type:        normalizeTaxonomies(categories),
+			Teaser:      optionalText(entry.Summary.value()),
+			Content:     strings.TrimSpace(entry.Content.value()),
+			URL:         atomAlternateLink(entry.Links),
+			ImageURL:    imageURL,
+			Published:   publishDate,
+			LastUpdated: lastUpdated,
+			State:       statePublished,
+		})
+	}
+	return articles, skipped, nil
+}
+
+// value returns the content of the text construct, the markup for XHTML and the character data otherwise.
+func (t atomText) value() string {
+	if t.Type == "xhtml" {
+		return t.InnerXML
+	}
+	return t.Text
+}
+
+// rssImageURL returns the image of an RSS item: the first image enclosure, else the first media thumbnail,
+// else the first image media content.
+func rssImageURL(item rssItem) string {
+	for _, enclosure := range item.Enclosures {
+		if strings.HasPrefix(enclosure.Type, "image/") {
+			return enclosure.URL
+		}
+	}
+	if len(item.MediaThumbnails) > 0 {
+		return item.MediaThumbnails[0].URL
+	}
+	for _, media := range item.MediaContents {
+		if media.Medium == "image" || strings.HasPrefix(media.Type, "image/") {
+			return media.URL
+		}
+	}
+	return ""
+}
+
+// atomAlternateLink returns the link to the HTML version of an Atom entry.
+func atomAlternateLink(links []atomLink) string {
+	for _, link := range links {
+		if link.Rel == "" || link.Rel == "alternate" {
+			return link.Href
+		}
+	}
+	return ""
+}
+
+// optionalText returns the trimmed text, or nil when it is empty.
+func optionalText(value string) *string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil
+	}
+	return &value
+}
+
+// trimmedValues returns the trimmed, non-empty values.
+func trimmedValues(values []string) []string {
+	var result []string
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			result = append(result, value)
+		}
+	}
+	return result
+}
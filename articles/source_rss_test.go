@@ -0,0 +1,52 @@
+package articles
+
+import (
+	"encoding/json"
+	"flag"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files of the feed tests")
+
+var syndicationDates = dateParser{location: time.UTC, layouts: syndicationDateLayouts}
+
+func TestReadSyndicationFeedGoldenFiles(t *testing.T) {
+	for _, name := range []string{"rss_bbc_sport", "rss_wordpress", "atom_club"} {
+		t.Run(name, func(t *testing.T) {
+			content, err := os.ReadFile(filepath.Join("testdata", name+".xml"))
+			if err != nil {
+				t.Fatal("Failed to read the feed sample: ", err)
+			}
+
+			articles, skipped, err := readSyndicationFeed(content, "test", syndicationDates)
+			assert.NoError(t, err)
+			assert.Empty(t, skipped)
+			actual, err := json.MarshalIndent(articles, "", "  ")
+			if err != nil {
+				t.Fatal("Failed to encode the articles: ", err)
+			}
+
+			goldenFile := filepath.Join("testdata", name+".golden.json")
+			if *updateGolden {
+				if err := os.WriteFile(goldenFile, append(actual, '\n'), 0644); err != nil {
+					t.Fatal("Failed to update the golden file: ", err)
+				}
+			}
+			expected, err := os.ReadFile(goldenFile)
+			if err != nil {
+				t.Fatal("Failed to read the golden file, run the test with -update to create it: ", err)
+			}
+			assert.Equal(t, strings.TrimSpace(string(expected)), string(actual))
+		})
+	}
+}
+
+func TestReadSyndicationFeedRejectsUnknownFormats(t *testing.T) {
+	_, _, err := readSyndicationFeed([]byte(`<?xml version="1.0"?><html><body>Service unavailable</body></html>`), "test", syndicationDates)
+	assert.Error(t, err)
+}
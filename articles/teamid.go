@@ -0,0 +1,60 @@
+package articles
+
+import (
+	"context"
+	"github.com/SkaisgirisMarius/article-processor/config"
+	log "github.com/sirupsen/logrus"
+	"sort"
+)
+
+// RewriteLegacyTeamIDs is a one-off migration of the articles stored before the feeds were keyed by their club key,
+// which have the ClubName of the incrowd feed as their team ID. It moves the articles stored under the LegacyTeamIDs
+// of every feed to the feed's club key. When an article is already stored under the club key as well, it was
+// ingested again after the switch and that copy is kept, the legacy copy is removed. It can be run again after more
+// legacy team IDs were configured, articles that were already moved are left as they are.
+func RewriteLegacyTeamIDs(ctx context.Context, store *Storage) error {
+	for _, feed := range config.Conf.Feeds {
+		for _, teamID := range feed.LegacyTeamIDs {
+			moved, removed, err := store.Articles.MoveTeam(ctx, teamID, feed.ClubKey)
+			if err != nil {
+				return err
+			}
+			log.Printf("Moved %v articles from team ID %v to %v, removed %v legacy copies of articles stored under both",
+				moved, teamID, feed.ClubKey, removed)
+		}
+	}
+
+	teamIDs, err := getUnknownTeamIDs(ctx, store)
+	if err != nil {
+		return err
+	}
+	if len(teamIDs) > 0 {
+		log.Warnf("Articles with the team IDs %v do not belong to a configured feed, add them to the legacyTeamIDs of their feed", teamIDs)
+	}
+	return nil
+}
+
+// getUnknownTeamIDs returns the team IDs of the stored articles that are neither the club key nor a legacy team ID of
+// a configured feed, they are most likely legacy team IDs missing from the configuration.
+func getUnknownTeamIDs(ctx context.Context, store *Storage) ([]string, error) {
+	known := make(map[string]bool)
+	for _, feed := range config.Conf.Feeds {
+		known[feed.ClubKey] = true
+		for _, teamID := range feed.LegacyTeamIDs {
+			known[teamID] = true
+		}
+	}
+	storedArticles, err := store.Articles.List(ctx, ArticleFilter{IncludeWithdrawn: true})
+	if err != nil {
+		return nil, err
+	}
+	var teamIDs []string
+	for _, article := range storedArticles {
+		if !known[article.TeamID] {
+			known[article.TeamID] = true
+			teamIDs = append(teamIDs, article.TeamID)
+		}
+	}
+	sort.Strings(teamIDs)
+	return teamIDs, nil
+}
@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"github.com/SkaisgirisMarius/article-processor/config"
+	"github.com/SkaisgirisMarius/article-processor/helper"
+	"net/http"
+)
+
+// HeaderAPIKey is the request header carrying the API key of the caller.
+const HeaderAPIKey = "X-API-Key"
+
+// RequireAPIKey is a middleware that only lets requests through that carry one of the configured API keys.
+// Without configured keys every request is rejected.
+func RequireAPIKey(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !validAPIKey(r.Header.Get(HeaderAPIKey)) {
+			helper.SendJsonError(w, http.StatusUnauthorized, "missing or invalid API key")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// HasAPIKey reports whether the request carries one of the configured API keys, for handlers that only unlock
+// parts of a public endpoint to authenticated callers.
+func HasAPIKey(r *http.Request) bool {
+	return validAPIKey(r.Header.Get(HeaderAPIKey))
+}
+
+// validAPIKey reports whether the key is one of the configured API keys, comparing in constant time.
+func validAPIKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	valid := false
+	for _, apiKey := range config.Conf.Auth.APIKeys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(apiKey)) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"github.com/SkaisgirisMarius/article-processor/config"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireAPIKey(t *testing.T) {
+	config.Conf = &config.Config{Auth: config.Auth{APIKeys: []string{"editor-key", "ops-key"}}}
+	handler := RequireAPIKey(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	for key, expectedStatus := range map[string]int{
+		"ops-key":   http.StatusNoContent,
+		"editor":    http.StatusUnauthorized,
+		"wrong-key": http.StatusUnauthorized,
+		"":          http.StatusUnauthorized,
+	} {
+		request := httptest.NewRequest(http.MethodPost, "/api/ingestion/trigger", nil)
+		if key != "" {
+			request.Header.Set(HeaderAPIKey, key)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		assert.Equal(t, expectedStatus, recorder.Code, "API key %q", key)
+	}
+
+	config.Conf = &config.Config{}
+	request := httptest.NewRequest(http.MethodPost, "/api/ingestion/trigger", nil)
+	request.Header.Set(HeaderAPIKey, "ops-key")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
+
+func TestHasAPIKey(t *testing.T) {
+	config.Conf = &config.Config{Auth: config.Auth{APIKeys: []string{"ops-key"}}}
+	defer func() { config.Conf = &config.Config{} }()
+
+	request := httptest.NewRequest(http.MethodGet, "/api/article/list?includeWithdrawn=true", nil)
+	assert.False(t, HasAPIKey(request))
+	request.Header.Set(HeaderAPIKey, "wrong-key")
+	assert.False(t, HasAPIKey(request))
+	request.Header.Set(HeaderAPIKey, "ops-key")
+	assert.True(t, HasAPIKey(request))
+}
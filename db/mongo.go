@@ -7,15 +7,22 @@ import (
 	log "github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"sync"
 	"time"
 )
 
-var mongoDb *mongo.Client
+var (
+	mongoDb *mongo.Client
+	mongoMu sync.Mutex
+)
 
 const MongoTimeout = 15 * time.Second
 
 // MongoConnect establishes a connection to the MongoDB database and returns the client instance.
+// The client is created once and shared until Disconnect is called.
 func MongoConnect() *mongo.Client {
+	mongoMu.Lock()
+	defer mongoMu.Unlock()
 	if mongoDb != nil {
 		return mongoDb
 	}
@@ -25,20 +32,33 @@ func MongoConnect() *mongo.Client {
 	clientOptions := options.Client().ApplyURI(mongoURI)
 
 	// Connect to the MongoDB server using the specified client options.
-	mongoDb, err := mongo.Connect(context.TODO(), clientOptions)
+	client, err := mongo.Connect(context.TODO(), clientOptions)
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	// Check if the connection to the MongoDB server is successful.
-	err = mongoDb.Ping(context.TODO(), nil)
+	err = client.Ping(context.TODO(), nil)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	mongoDb = client
 	return mongoDb
 }
 
+// Disconnect closes the connection to the MongoDB database if it was established.
+func Disconnect(ctx context.Context) error {
+	mongoMu.Lock()
+	defer mongoMu.Unlock()
+	if mongoDb == nil {
+		return nil
+	}
+	err := mongoDb.Disconnect(ctx)
+	mongoDb = nil
+	return err
+}
+
 func getDbName() string {
 	dbName := config.Conf.MongoDb.DbName
 	return dbName
@@ -55,3 +75,8 @@ func GetMongoCollection(name string) *mongo.Collection {
 func GetTimeoutContext() (context.Context, context.CancelFunc) {
 	return context.WithTimeout(context.Background(), MongoTimeout)
 }
+
+// WithTimeout derives a context from the given one that is bounded by the MongoDB timeout.
+func WithTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, MongoTimeout)
+}
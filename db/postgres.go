@@ -0,0 +1,65 @@
+package db
+
+import (
+	"context"
+	"github.com/SkaisgirisMarius/article-processor/config"
+	"github.com/jackc/pgx/v5/pgxpool"
+	log "github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+var (
+	postgresPool *pgxpool.Pool
+	postgresMu   sync.Mutex
+)
+
+// PostgresTimeout bounds a single call of the PostgreSQL repositories.
+const PostgresTimeout = 15 * time.Second
+
+// PostgresConnect establishes a connection pool to the configured PostgreSQL database and returns it.
+// The pool is created once and shared until ClosePostgres is called.
+func PostgresConnect() *pgxpool.Pool {
+	postgresMu.Lock()
+	defer postgresMu.Unlock()
+	if postgresPool != nil {
+		return postgresPool
+	}
+
+	pool, err := OpenPostgres(context.TODO(), config.Conf.Postgres.URL)
+	if err != nil {
+		log.Fatal(err)
+	}
+	postgresPool = pool
+	return postgresPool
+}
+
+// OpenPostgres opens a new connection pool to the PostgreSQL database with the given connection string
+// and checks that the database can be reached.
+func OpenPostgres(ctx context.Context, url string) (*pgxpool.Pool, error) {
+	pool, err := pgxpool.New(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, err
+	}
+	return pool, nil
+}
+
+// ClosePostgres closes the connection pool to the PostgreSQL database if it was opened.
+func ClosePostgres() {
+	postgresMu.Lock()
+	defer postgresMu.Unlock()
+	if postgresPool == nil {
+		return
+	}
+	postgresPool.Close()
+	postgresPool = nil
+}
+
+// WithPostgresTimeout derives a context from the given one that is bounded by the PostgreSQL timeout.
+func WithPostgresTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, PostgresTimeout)
+}
@@ -0,0 +1,88 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"github.com/SkaisgirisMarius/article-processor/config"
+	log "github.com/sirupsen/logrus"
+	_ "modernc.org/sqlite"
+	"sync"
+	"time"
+)
+
+// SQLiteTimeLayout is the layout times are stored in by the SQLite backend. It always has the same width,
+// so the stored times sort and compare in time order as text.
+const SQLiteTimeLayout = "2006-01-02T15:04:05.000000000Z"
+
+// sqliteOptions make concurrent instances wait for a locked database instead of failing, take the write lock when
+// a transaction starts so that two writers cannot deadlock, and let readers run while a write is in progress.
+const sqliteOptions = "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate"
+
+// SQLiteTimeout bounds a single call of the SQLite repositories, including the wait for the single connection,
+// so that a stuck query does not block the other queries for longer.
+const SQLiteTimeout = 15 * time.Second
+
+var (
+	sqliteDB *sql.DB
+	sqliteMu sync.Mutex
+)
+
+// SQLiteConnect opens the configured SQLite database file and returns it.
+// The database is opened once and shared until CloseSQLite is called.
+func SQLiteConnect() *sql.DB {
+	sqliteMu.Lock()
+	defer sqliteMu.Unlock()
+	if sqliteDB != nil {
+		return sqliteDB
+	}
+
+	database, err := OpenSQLite(config.Conf.SQLite.Path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	sqliteDB = database
+	return sqliteDB
+}
+
+// OpenSQLite opens the SQLite database file at the given path, creating it if needed. SQLite allows a single
+// writer, so the database is used through a single connection and the queries of the service take turns on it.
+func OpenSQLite(path string) (*sql.DB, error) {
+	database, err := sql.Open("sqlite", path+sqliteOptions)
+	if err != nil {
+		return nil, err
+	}
+	database.SetMaxOpenConns(1)
+	if err := database.Ping(); err != nil {
+		database.Close()
+		return nil, err
+	}
+	return database, nil
+}
+
+// CloseSQLite closes the SQLite database if it was opened.
+func CloseSQLite() {
+	sqliteMu.Lock()
+	defer sqliteMu.Unlock()
+	if sqliteDB == nil {
+		return
+	}
+	if err := sqliteDB.Close(); err != nil {
+		log.Println("Could not close the SQLite database:", err)
+	}
+	sqliteDB = nil
+}
+
+// SQLiteTime formats a time for storing in SQLite.
+func SQLiteTime(t time.Time) string {
+	return t.UTC().Format(SQLiteTimeLayout)
+}
+
+// ParseSQLiteTime parses a time stored in SQLite.
+func ParseSQLiteTime(value string) (time.Time, error) {
+	return time.Parse(SQLiteTimeLayout, value)
+}
+
+// WithSQLiteTimeout derives a context from the given one that is bounded by the SQLite timeout.
+func WithSQLiteTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, SQLiteTimeout)
+}
@@ -2,18 +2,36 @@ package health
 
 import (
 	"github.com/SkaisgirisMarius/article-processor/helper"
+	"github.com/SkaisgirisMarius/article-processor/leader"
 	"github.com/go-chi/chi/v5"
 	"net/http"
+	"time"
 )
 
-func InitHealthRouter() http.Handler {
+// HealthResponse tells that the service is running, which instance answered and which instance leads the ingestion.
+type HealthResponse struct {
+	Status         string    `json:"status"`
+	Instance       string    `json:"instance"`
+	Leader         string    `json:"leader"`
+	IsLeader       bool      `json:"isLeader"`
+	LeaseExpiresAt time.Time `json:"leaseExpiresAt"`
+}
+
+func InitHealthRouter(elector *leader.Elector) http.Handler {
 	r := chi.NewRouter()
-	r.Get("/", getHealthHandler())
+	r.Get("/", getHealthHandler(elector))
 	return r
 }
 
-func getHealthHandler() http.HandlerFunc {
+func getHealthHandler(elector *leader.Elector) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		helper.SendJsonOk(w, "Service is running")
+		election := elector.Status()
+		helper.SendJsonOk(w, HealthResponse{
+			Status:         "Service is running",
+			Instance:       election.Instance,
+			Leader:         election.Leader,
+			IsLeader:       election.IsLeader,
+			LeaseExpiresAt: election.LeaseExpiresAt,
+		})
 	}
 }
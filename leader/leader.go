@@ -0,0 +1,161 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	log "github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+// storeTimeout bounds a single call to the lease store.
+const storeTimeout = 5 * time.Second
+
+// ErrLeaseLost is the cause of the cancellation of a context that was bound to a lease which could not be renewed.
+// Work done under the lease has to stop right away, another instance may take the lease over within a TTL.
+var ErrLeaseLost = errors.New("the lease was lost")
+
+// Lease is a named lease held by a single instance until it expires.
+type Lease struct {
+	Name      string    `bson:"_id" json:"name"`
+	Holder    string    `bson:"holder" json:"holder"`
+	ExpiresAt time.Time `bson:"expiresAt" json:"expiresAt"`
+}
+
+// Store keeps the leases shared by the instances.
+type Store interface {
+	// Acquire takes or renews the lease for the holder when it is free, expired or already held by the holder.
+	// It returns the current lease and whether the holder holds it.
+	Acquire(ctx context.Context, name string, holder string, ttl time.Duration) (Lease, bool, error)
+	// Release gives up the lease when it is held by the holder.
+	Release(ctx context.Context, name string, holder string) error
+}
+
+// Status is what an instance knows about the election. Leader is empty when the lease is not held by anyone.
+type Status struct {
+	Instance       string    `json:"instance"`
+	Leader         string    `json:"leader"`
+	IsLeader       bool      `json:"isLeader"`
+	LeaseExpiresAt time.Time `json:"leaseExpiresAt"`
+}
+
+// Elector competes with the other instances for a lease and runs a function for as long as it holds it.
+// The lease is renewed three times per TTL, so it fails over to another instance within a TTL when its holder dies.
+type Elector struct {
+	store         Store
+	name          string
+	instance      string
+	ttl           time.Duration
+	renewInterval time.Duration
+
+	mu     sync.Mutex
+	status Status
+}
+
+// New creates an elector for the lease with the given name, identifying this instance by the given ID.
+func New(store Store, name string, instance string, ttl time.Duration) *Elector {
+	return &Elector{
+		store:         store,
+		name:          name,
+		instance:      instance,
+		ttl:           ttl,
+		renewInterval: ttl / 3,
+		status:        Status{Instance: instance},
+	}
+}
+
+// Status returns the current state of the election as seen by this instance.
+func (e *Elector) Status() Status {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.status
+}
+
+// IsLeader reports whether this instance currently holds the lease.
+func (e *Elector) IsLeader() bool {
+	return e.Status().IsLeader
+}
+
+// Run competes for the lease until the context is done. Whenever this instance is elected, lead is started with
+// a context that is cancelled as soon as the lease is lost, with ErrLeaseLost as its cause, and the lease is not
+// competed for again until lead returned. A renewal that fails for any reason gives up the leadership, since the
+// lease may have expired meanwhile. When the context is done the lease is released, so that another instance takes
+// over without waiting for it to expire.
+func (e *Elector) Run(ctx context.Context, lead func(ctx context.Context)) {
+	var stopLeading func(cause error)
+	stepDown := func(cause error) {
+		if stopLeading == nil {
+			return
+		}
+		stopLeading(cause)
+		stopLeading = nil
+		log.Printf("Instance %v is no longer the leader of %v", e.instance, e.name)
+	}
+
+	ticker := time.NewTicker(e.renewInterval)
+	defer ticker.Stop()
+	for {
+		leading := e.renew(ctx)
+		if leading && stopLeading == nil {
+			log.Printf("Instance %v was elected the leader of %v", e.instance, e.name)
+			stopLeading = startLeading(ctx, lead)
+		}
+		if !leading {
+			stepDown(ErrLeaseLost)
+		}
+
+		select {
+		case <-ctx.Done():
+			stepDown(context.Cause(ctx))
+			e.release()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// startLeading runs lead in the background and returns a function that cancels it with the given cause and waits
+// for it to return.
+func startLeading(ctx context.Context, lead func(ctx context.Context)) func(cause error) {
+	leadCtx, cancel := context.WithCancelCause(ctx)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		lead(leadCtx)
+	}()
+	return func(cause error) {
+		cancel(cause)
+		<-stopped
+	}
+}
+
+// renew takes or renews the lease and updates the status, it returns whether this instance holds the lease.
+func (e *Elector) renew(ctx context.Context) bool {
+	storeCtx, cancel := context.WithTimeout(ctx, storeTimeout)
+	defer cancel()
+	lease, acquired, err := e.store.Acquire(storeCtx, e.name, e.instance, e.ttl)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Errorf("could not renew the lease %v, error: %v", e.name, err)
+		}
+		lease, acquired = Lease{}, false
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.status = Status{Instance: e.instance, Leader: lease.Holder, IsLeader: acquired, LeaseExpiresAt: lease.ExpiresAt}
+	return acquired
+}
+
+// release gives up the lease, the store leaves it alone when it is held by another instance.
+func (e *Elector) release() {
+	e.mu.Lock()
+	e.status = Status{Instance: e.instance}
+	e.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+	if err := e.store.Release(ctx, e.name, e.instance); err != nil {
+		log.Errorf("could not release the lease %v, error: %v", e.name, err)
+	}
+}
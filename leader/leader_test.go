@@ -0,0 +1,290 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"github.com/SkaisgirisMarius/article-processor/db"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testTTL = 60 * time.Millisecond
+
+// crashingStore is a lease store shared by the in-process instances of a test. Calls of a crashed holder fail,
+// as if the instance could no longer reach the database.
+type crashingStore struct {
+	*MemoryStore
+	mu      sync.Mutex
+	crashed map[string]bool
+}
+
+func newCrashingStore() *crashingStore {
+	return &crashingStore{MemoryStore: NewMemoryStore(), crashed: make(map[string]bool)}
+}
+
+func (s *crashingStore) Acquire(ctx context.Context, name string, holder string, ttl time.Duration) (Lease, bool, error) {
+	if s.isCrashed(holder) {
+		return Lease{}, false, errors.New("connection refused")
+	}
+	return s.MemoryStore.Acquire(ctx, name, holder, ttl)
+}
+
+func (s *crashingStore) Release(ctx context.Context, name string, holder string) error {
+	if s.isCrashed(holder) {
+		return errors.New("connection refused")
+	}
+	return s.MemoryStore.Release(ctx, name, holder)
+}
+
+func (s *crashingStore) crash(holder string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.crashed[holder] = true
+}
+
+func (s *crashingStore) isCrashed(holder string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.crashed[holder]
+}
+
+// cluster runs in-process instances competing for the same lease and counts how many of them lead at once.
+type cluster struct {
+	store      *crashingStore
+	electors   []*Elector
+	cancels    []context.CancelFunc
+	done       sync.WaitGroup
+	leading    int32
+	maxLeading int32
+}
+
+func startCluster(t *testing.T, instances ...string) *cluster {
+	c := &cluster{store: newCrashingStore()}
+	for _, instance := range instances {
+		elector := New(c.store, "scheduler", instance, testTTL)
+		ctx, cancel := context.WithCancel(context.Background())
+		c.electors = append(c.electors, elector)
+		c.cancels = append(c.cancels, cancel)
+		c.done.Add(1)
+		go func() {
+			defer c.done.Done()
+			elector.Run(ctx, c.lead)
+		}()
+	}
+	t.Cleanup(func() {
+		for _, cancel := range c.cancels {
+			cancel()
+		}
+		c.done.Wait()
+	})
+	return c
+}
+
+func (c *cluster) lead(ctx context.Context) {
+	leading := atomic.AddInt32(&c.leading, 1)
+	for {
+		max := atomic.LoadInt32(&c.maxLeading)
+		if leading <= max || atomic.CompareAndSwapInt32(&c.maxLeading, max, leading) {
+			break
+		}
+	}
+	<-ctx.Done()
+	atomic.AddInt32(&c.leading, -1)
+}
+
+// leader returns the index of the only instance that considers itself the leader, or -1.
+func (c *cluster) leader() int {
+	found := -1
+	for i, elector := range c.electors {
+		if elector.IsLeader() {
+			if found >= 0 {
+				return -1
+			}
+			found = i
+		}
+	}
+	return found
+}
+
+func TestElectsSingleLeader(t *testing.T) {
+	c := startCluster(t, "a", "b", "c")
+	assert.Eventually(t, func() bool { return c.leader() >= 0 }, time.Second, 5*time.Millisecond)
+	leader := c.leader()
+
+	time.Sleep(3 * testTTL)
+	assert.Equal(t, leader, c.leader())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&c.maxLeading))
+	for _, elector := range c.electors {
+		assert.Equal(t, c.electors[leader].instance, elector.Status().Leader)
+	}
+}
+
+func TestFailsOverWhenLeaderDies(t *testing.T) {
+	c := startCluster(t, "a", "b", "c")
+	assert.Eventually(t, func() bool { return c.leader() >= 0 }, time.Second, 5*time.Millisecond)
+	crashed := c.leader()
+	c.store.crash(c.electors[crashed].instance)
+
+	assert.Eventually(t, func() bool {
+		leader := c.leader()
+		return leader >= 0 && leader != crashed
+	}, time.Second, 5*time.Millisecond)
+	assert.False(t, c.electors[crashed].IsLeader())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&c.maxLeading))
+}
+
+func TestHandsOverWhenLeaderStops(t *testing.T) {
+	c := startCluster(t, "a", "b")
+	assert.Eventually(t, func() bool { return c.leader() >= 0 }, time.Second, 5*time.Millisecond)
+	stopped := c.leader()
+	c.cancels[stopped]()
+
+	assert.Eventually(t, func() bool { return c.leader() == 1-stopped }, time.Second, 5*time.Millisecond)
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&c.leading) == 1 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&c.maxLeading))
+}
+
+func TestCancelsLeadWithLeaseLostCause(t *testing.T) {
+	store := newCrashingStore()
+	elector := New(store, "scheduler", "a", testTTL)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	causes := make(chan error, 1)
+	go elector.Run(ctx, func(ctx context.Context) {
+		<-ctx.Done()
+		causes <- context.Cause(ctx)
+	})
+	assert.Eventually(t, elector.IsLeader, time.Second, 5*time.Millisecond)
+
+	store.crash("a")
+	select {
+	case cause := <-causes:
+		assert.ErrorIs(t, cause, ErrLeaseLost)
+	case <-time.After(time.Second):
+		t.Fatal("lead was not cancelled after the lease was lost")
+	}
+}
+
+func TestTryLock(t *testing.T) {
+	store := newCrashingStore()
+	ctx, unlock, err := TryLock(context.Background(), store, "feed", "a", testTTL)
+	assert.NoError(t, err)
+
+	// The lock is renewed while it is held, so it does not expire under its holder
+	time.Sleep(2 * testTTL)
+	_, _, err = TryLock(context.Background(), store, "feed", "b", testTTL)
+	assert.ErrorIs(t, err, ErrLocked)
+	assert.NoError(t, ctx.Err())
+
+	// Unlocking releases the lock right away
+	unlock()
+	_, unlockB, err := TryLock(context.Background(), store, "feed", "b", testTTL)
+	assert.NoError(t, err)
+	defer unlockB()
+
+	// A holder that cannot renew the lock is stopped
+	ctx, unlock, err = TryLock(context.Background(), store, "other", "a", testTTL)
+	assert.NoError(t, err)
+	defer unlock()
+	store.crash("a")
+	assert.Eventually(t, func() bool { return ctx.Err() != nil }, time.Second, 5*time.Millisecond)
+	assert.ErrorIs(t, context.Cause(ctx), ErrLeaseLost)
+}
+
+// testStores returns the lease stores the store tests run on: the in-memory store, a SQLite store in a temporary
+// file, a MongoDB store on the emptied leases collection of the MONGO_TEST_URL environment variable and a PostgreSQL
+// store on the emptied leases table of the POSTGRES_TEST_URL environment variable, when they are set.
+func testStores(t *testing.T) map[string]Store {
+	ctx := context.Background()
+	stores := map[string]Store{"memory": NewMemoryStore()}
+	database, err := db.OpenSQLite(filepath.Join(t.TempDir(), "leases.db"))
+	if err != nil {
+		t.Fatal("Failed to open SQLite: ", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	sqliteStore, err := NewSQLiteStore(ctx, database)
+	if err != nil {
+		t.Fatal("Failed to create the SQLite lease table: ", err)
+	}
+	stores["sqlite"] = sqliteStore
+	if url := os.Getenv("MONGO_TEST_URL"); url != "" {
+		client, err := mongo.Connect(ctx, options.Client().ApplyURI(url))
+		if err != nil {
+			t.Fatal("Failed to connect to MongoDB: ", err)
+		}
+		t.Cleanup(func() { client.Disconnect(context.Background()) })
+		collection := client.Database("article_processor_test").Collection("leases")
+		if err := collection.Drop(ctx); err != nil {
+			t.Fatal("Failed to clean up test data: ", err)
+		}
+		stores["mongo"] = NewMongoStore(collection)
+	}
+	if url := os.Getenv("POSTGRES_TEST_URL"); url != "" {
+		pool, err := db.OpenPostgres(ctx, url)
+		if err != nil {
+			t.Fatal("Failed to connect to PostgreSQL: ", err)
+		}
+		t.Cleanup(pool.Close)
+		postgresStore, err := NewPostgresStore(ctx, pool)
+		if err != nil {
+			t.Fatal("Failed to create the PostgreSQL lease table: ", err)
+		}
+		if _, err := pool.Exec(ctx, "TRUNCATE leases"); err != nil {
+			t.Fatal("Failed to clean up test data: ", err)
+		}
+		stores["postgres"] = postgresStore
+	}
+	return stores
+}
+
+func TestStore(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			lease, acquired, err := store.Acquire(ctx, "scheduler", "a", time.Minute)
+			assert.NoError(t, err)
+			assert.True(t, acquired)
+			assert.Equal(t, "a", lease.Holder)
+
+			// Another holder cannot take a valid lease, the holder renews it
+			lease, acquired, err = store.Acquire(ctx, "scheduler", "b", time.Minute)
+			assert.NoError(t, err)
+			assert.False(t, acquired)
+			assert.Equal(t, "a", lease.Holder)
+			_, acquired, err = store.Acquire(ctx, "scheduler", "a", time.Minute)
+			assert.NoError(t, err)
+			assert.True(t, acquired)
+
+			// Releasing a lease held by another holder leaves it alone
+			assert.NoError(t, store.Release(ctx, "scheduler", "b"))
+			_, acquired, err = store.Acquire(ctx, "scheduler", "b", time.Minute)
+			assert.NoError(t, err)
+			assert.False(t, acquired)
+
+			// A released lease is taken over right away
+			assert.NoError(t, store.Release(ctx, "scheduler", "a"))
+			lease, acquired, err = store.Acquire(ctx, "scheduler", "b", time.Minute)
+			assert.NoError(t, err)
+			assert.True(t, acquired)
+			assert.Equal(t, "b", lease.Holder)
+			assert.WithinDuration(t, time.Now().Add(time.Minute), lease.ExpiresAt, time.Second)
+
+			// An expired lease is taken over, leases with other names are independent
+			_, acquired, err = store.Acquire(ctx, "feed", "a", 10*time.Millisecond)
+			assert.NoError(t, err)
+			assert.True(t, acquired)
+			time.Sleep(20 * time.Millisecond)
+			lease, acquired, err = store.Acquire(ctx, "feed", "c", time.Minute)
+			assert.NoError(t, err)
+			assert.True(t, acquired)
+			assert.Equal(t, "c", lease.Holder)
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+// ErrLocked is returned by TryLock when the lock is held by another holder.
+var ErrLocked = errors.New("the lock is held by another holder")
+
+// TryLock takes the lease with the given name as a lock for a single task, without waiting when it is held by
+// another holder. The lease is renewed three times per TTL until the returned unlock function is called, which
+// releases it. The returned context is cancelled with ErrLeaseLost as soon as a renewal fails, since another holder
+// may take the lock over once the lease expired.
+func TryLock(ctx context.Context, store Store, name string, holder string, ttl time.Duration) (context.Context, func(), error) {
+	storeCtx, cancelStore := context.WithTimeout(ctx, storeTimeout)
+	_, acquired, err := store.Acquire(storeCtx, name, holder, ttl)
+	cancelStore()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !acquired {
+		return nil, nil, ErrLocked
+	}
+
+	lockCtx, cancel := context.WithCancelCause(ctx)
+	stopRenewing := make(chan struct{})
+	renewed := make(chan struct{})
+	go func() {
+		defer close(renewed)
+		ticker := time.NewTicker(ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopRenewing:
+				return
+			case <-lockCtx.Done():
+				return
+			case <-ticker.C:
+			}
+			storeCtx, cancelStore := context.WithTimeout(lockCtx, storeTimeout)
+			_, acquired, err := store.Acquire(storeCtx, name, holder, ttl)
+			cancelStore()
+			if lockCtx.Err() != nil {
+				return
+			}
+			if err != nil || !acquired {
+				log.Errorf("could not renew the lock %v, stopping its task, error: %v", name, err)
+				cancel(ErrLeaseLost)
+				return
+			}
+		}
+	}()
+
+	unlock := func() {
+		close(stopRenewing)
+		<-renewed
+		cancel(context.Canceled)
+		releaseCtx, cancelRelease := context.WithTimeout(context.Background(), storeTimeout)
+		defer cancelRelease()
+		if err := store.Release(releaseCtx, name, holder); err != nil {
+			log.Errorf("could not release the lock %v, error: %v", name, err)
+		}
+	}
+	return lockCtx, unlock, nil
+}
@@ -0,0 +1,43 @@
+package leader
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a lease store kept in the process. It only elects a leader among the electors sharing it,
+// so it is meant for a single instance running without a database, and for tests.
+type MemoryStore struct {
+	mu     sync.Mutex
+	leases map[string]Lease
+}
+
+// NewMemoryStore returns an empty in-memory lease store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{leases: make(map[string]Lease)}
+}
+
+// Acquire grants the lease to the holder when it is free, expired or already held by the holder.
+func (s *MemoryStore) Acquire(ctx context.Context, name string, holder string, ttl time.Duration) (Lease, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	lease, found := s.leases[name]
+	if found && lease.Holder != holder && lease.ExpiresAt.After(now) {
+		return lease, false, nil
+	}
+	lease = Lease{Name: name, Holder: holder, ExpiresAt: now.Add(ttl)}
+	s.leases[name] = lease
+	return lease, true, nil
+}
+
+// Release gives up the lease if it is held by the holder.
+func (s *MemoryStore) Release(ctx context.Context, name string, holder string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if lease, found := s.leases[name]; found && lease.Holder == holder {
+		delete(s.leases, name)
+	}
+	return nil
+}
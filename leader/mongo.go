@@ -0,0 +1,54 @@
+package leader
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// MongoStore keeps the leases in a MongoDB collection, one document per lease.
+// The expiry is compared with the clock of the instances, so their clocks must not drift apart by more than a fraction of the TTL.
+type MongoStore struct {
+	collection *mongo.Collection
+}
+
+// NewMongoStore creates a lease store on the given collection.
+func NewMongoStore(collection *mongo.Collection) *MongoStore {
+	return &MongoStore{collection: collection}
+}
+
+// Acquire takes or renews the lease in a single atomic upsert. The upsert only matches a lease that is held by the
+// holder or expired, for a lease held by another instance it fails on the unique _id and the current lease is returned.
+func (s *MongoStore) Acquire(ctx context.Context, name string, holder string, ttl time.Duration) (Lease, bool, error) {
+	now := time.Now().UTC()
+	filter := bson.M{
+		"_id": name,
+		"$or": bson.A{
+			bson.M{"holder": holder},
+			bson.M{"expiresAt": bson.M{"$lte": now}},
+		},
+	}
+	update := bson.M{"$set": bson.M{"holder": holder, "expiresAt": now.Add(ttl)}}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var lease Lease
+	err := s.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&lease)
+	if mongo.IsDuplicateKeyError(err) {
+		err = s.collection.FindOne(ctx, bson.M{"_id": name}).Decode(&lease)
+		return lease, false, err
+	}
+	if err != nil {
+		return Lease{}, false, err
+	}
+	return lease, true, nil
+}
+
+// Release expires the lease when it is held by the holder.
+func (s *MongoStore) Release(ctx context.Context, name string, holder string) error {
+	filter := bson.M{"_id": name, "holder": holder}
+	update := bson.M{"$set": bson.M{"holder": "", "expiresAt": time.Now().UTC()}}
+	_, err := s.collection.UpdateOne(ctx, filter, update)
+	return err
+}
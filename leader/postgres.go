@@ -0,0 +1,59 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"time"
+)
+
+// leasesSchema creates the table of the PostgreSQL lease store, one row per lease.
+const leasesSchema = `
+CREATE TABLE IF NOT EXISTS leases (
+	name       TEXT PRIMARY KEY,
+	holder     TEXT NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL
+)`
+
+// PostgresStore keeps the leases in a PostgreSQL table. Like MongoStore it compares the expiry with the clock
+// of the instances, so their clocks must not drift apart by more than a fraction of the TTL.
+type PostgresStore struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresStore creates a lease store on the given database, creating its table if needed.
+func NewPostgresStore(ctx context.Context, pool *pgxpool.Pool) (*PostgresStore, error) {
+	if _, err := pool.Exec(ctx, leasesSchema); err != nil {
+		return nil, err
+	}
+	return &PostgresStore{pool: pool}, nil
+}
+
+// Acquire takes or renews the lease in a single atomic upsert. The upsert only overwrites a lease that is held by
+// the holder or expired, for a lease held by another instance it returns no row and the current lease is returned.
+func (s *PostgresStore) Acquire(ctx context.Context, name string, holder string, ttl time.Duration) (Lease, bool, error) {
+	now := time.Now().UTC()
+	query := `INSERT INTO leases (name, holder, expires_at) VALUES ($1, $2, $3)
+		ON CONFLICT (name) DO UPDATE SET holder = EXCLUDED.holder, expires_at = EXCLUDED.expires_at
+		WHERE leases.holder = EXCLUDED.holder OR leases.expires_at <= $4
+		RETURNING name, holder, expires_at`
+
+	var lease Lease
+	err := s.pool.QueryRow(ctx, query, name, holder, now.Add(ttl), now).Scan(&lease.Name, &lease.Holder, &lease.ExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = s.pool.QueryRow(ctx, "SELECT name, holder, expires_at FROM leases WHERE name = $1", name).
+			Scan(&lease.Name, &lease.Holder, &lease.ExpiresAt)
+		return lease, false, err
+	}
+	if err != nil {
+		return Lease{}, false, err
+	}
+	return lease, true, nil
+}
+
+// Release expires the lease when it is held by the holder.
+func (s *PostgresStore) Release(ctx context.Context, name string, holder string) error {
+	_, err := s.pool.Exec(ctx, "UPDATE leases SET holder = '', expires_at = $3 WHERE name = $1 AND holder = $2", name, holder, time.Now().UTC())
+	return err
+}
@@ -0,0 +1,69 @@
+package leader
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/SkaisgirisMarius/article-processor/db"
+	"time"
+)
+
+// sqliteLeasesSchema creates the table of the SQLite lease store, one row per lease.
+const sqliteLeasesSchema = `
+CREATE TABLE IF NOT EXISTS leases (
+	name       TEXT PRIMARY KEY,
+	holder     TEXT NOT NULL,
+	expires_at TEXT NOT NULL
+)`
+
+// SQLiteStore keeps the leases in a SQLite table, so only the instances sharing the database file compete for them.
+type SQLiteStore struct {
+	database *sql.DB
+}
+
+// NewSQLiteStore creates a lease store on the given database, creating its table if needed.
+func NewSQLiteStore(ctx context.Context, database *sql.DB) (*SQLiteStore, error) {
+	if _, err := database.ExecContext(ctx, sqliteLeasesSchema); err != nil {
+		return nil, err
+	}
+	return &SQLiteStore{database: database}, nil
+}
+
+// Acquire takes or renews the lease in a single atomic upsert. The upsert only overwrites a lease that is held by
+// the holder or expired, for a lease held by another instance it returns no row and the current lease is returned.
+func (s *SQLiteStore) Acquire(ctx context.Context, name string, holder string, ttl time.Duration) (Lease, bool, error) {
+	now := time.Now().UTC()
+	query := `INSERT INTO leases (name, holder, expires_at) VALUES (?1, ?2, ?3)
+		ON CONFLICT (name) DO UPDATE SET holder = EXCLUDED.holder, expires_at = EXCLUDED.expires_at
+		WHERE leases.holder = EXCLUDED.holder OR leases.expires_at <= ?4
+		RETURNING name, holder, expires_at`
+
+	lease, err := s.scanLease(s.database.QueryRowContext(ctx, query, name, holder, db.SQLiteTime(now.Add(ttl)), db.SQLiteTime(now)))
+	if errors.Is(err, sql.ErrNoRows) {
+		lease, err = s.scanLease(s.database.QueryRowContext(ctx, "SELECT name, holder, expires_at FROM leases WHERE name = ?1", name))
+		return lease, false, err
+	}
+	if err != nil {
+		return Lease{}, false, err
+	}
+	return lease, true, nil
+}
+
+// scanLease reads a lease from a row of its name, holder and expiry.
+func (s *SQLiteStore) scanLease(row *sql.Row) (Lease, error) {
+	var lease Lease
+	var expiresAt string
+	if err := row.Scan(&lease.Name, &lease.Holder, &expiresAt); err != nil {
+		return Lease{}, err
+	}
+	var err error
+	lease.ExpiresAt, err = db.ParseSQLiteTime(expiresAt)
+	return lease, err
+}
+
+// Release expires the lease when it is held by the holder.
+func (s *SQLiteStore) Release(ctx context.Context, name string, holder string) error {
+	query := "UPDATE leases SET holder = '', expires_at = ?3 WHERE name = ?1 AND holder = ?2"
+	_, err := s.database.ExecContext(ctx, query, name, holder, db.SQLiteTime(time.Now().UTC()))
+	return err
+}
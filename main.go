@@ -1,26 +1,342 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
 	"github.com/SkaisgirisMarius/article-processor/articles"
 	"github.com/SkaisgirisMarius/article-processor/config"
+	"github.com/SkaisgirisMarius/article-processor/db"
+	"github.com/SkaisgirisMarius/article-processor/leader"
+	"github.com/SkaisgirisMarius/article-processor/migration"
 	"github.com/SkaisgirisMarius/article-processor/server"
+	"github.com/jackc/pgx/v5/pgxpool"
 	log "github.com/sirupsen/logrus"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
+// schedulerLease is the name of the lease held by the replica that runs the ingestion scheduler.
+const schedulerLease = "ingestion-scheduler"
+
 // init initializes the application configuration by reading it from the "conf.yaml" file.
 func init() {
 	config.GetConfig("conf.yaml")
 }
 
 func main() {
+	// Run a one-off command instead of the service when one is given
+	if len(os.Args) > 1 {
+		runCommand(os.Args[1], os.Args[2:])
+		return
+	}
+
 	log.Println("Starting Article Processor")
 
-	// Create a new router for handling HTTP requests
-	r := server.NewRouter()
+	// The root context is cancelled on SIGINT or SIGTERM, a second signal kills the service right away
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	store, leaseStore := newStorage(ctx)
 
 	// Initialize the article retriever to periodically fetch new articles
-	articles.InitializeArticleRetriever()
+	articles.InitializeArticleRetriever(ctx, store)
+
+	// Only the replica holding the lease runs the scheduler, the others only serve HTTP requests
+	elector := leader.New(leaseStore, schedulerLease, config.Conf.Leader.InstanceID, config.Conf.Leader.LeaseTTLDuration())
+	electionDone := make(chan struct{})
+	go func() {
+		defer close(electionDone)
+		elector.Run(ctx, func(ctx context.Context) { articles.RunScheduler(ctx, store) })
+	}()
+
+	// Create a new router for handling HTTP requests
+	r := server.NewRouter(elector, store)
+
+	// Serve HTTP requests until the service is stopped
+	if err := server.StartServer(ctx, r); err != nil {
+		log.Fatal("Could not run server. ", err)
+	}
+
+	// Wait for the scheduler to finish its runs and release the lease, and for the backfills started through the
+	// endpoint to stop at their next checkpoint, then close the database connections
+	waitCtx, cancelWait := context.WithTimeout(context.Background(), config.Conf.ShutdownTimeoutDuration())
+	defer cancelWait()
+	select {
+	case <-electionDone:
+	case <-waitCtx.Done():
+		log.Println("The scheduler did not stop in time:", waitCtx.Err())
+	}
+	if err := articles.WaitForBackgroundRuns(waitCtx); err != nil {
+		log.Println("Background runs did not stop in time:", err)
+	}
+	disconnectCtx, cancel := context.WithTimeout(context.Background(), db.MongoTimeout)
+	defer cancel()
+	if err := db.Disconnect(disconnectCtx); err != nil {
+		log.Println("Could not disconnect from MongoDB:", err)
+	}
+	db.ClosePostgres()
+	db.CloseSQLite()
+	log.Println("Article Processor stopped")
+}
+
+// newStorage returns the article storage and the lease store of the configured storage backend.
+// The runs of the feeds are locked in the same lease store as the scheduler.
+func newStorage(ctx context.Context) (*articles.Storage, leader.Store) {
+	var store *articles.Storage
+	var leaseStore leader.Store
+	switch config.Conf.Storage.Backend {
+	case config.StorageMemory:
+		log.Println("Using the in-memory storage, the articles are lost when the service stops")
+		store, leaseStore = articles.NewMemoryStorage(), leader.NewMemoryStore()
+	case config.StoragePostgres:
+		store, leaseStore = newPostgresStorage(ctx)
+	case config.StorageSQLite:
+		store, leaseStore = newSQLiteStorage(ctx)
+	default:
+		store, leaseStore = newMongoStorage(ctx)
+	}
+	store.Locks = leaseStore
+	return store, leaseStore
+}
+
+// newMongoStorage applies the pending migrations of the MongoDB collections and returns the article storage and
+// the lease store on them. The expiry of the ingestion runs is updated to the configured run retention.
+func newMongoStorage(ctx context.Context) (*articles.Storage, leader.Store) {
+	leaseStore := leader.NewMongoStore(db.GetMongoCollection("leases"))
+	applySafeMigrations(ctx, newMongoMigrationRunner(leaseStore), "MongoDB collections")
+	if err := articles.SyncRunRetention(ctx); err != nil {
+		log.Fatal("Could not update the retention of the ingestion runs: ", err)
+	}
+	return articles.NewMongoStorage(), leaseStore
+}
+
+// newPostgresStorage applies the pending migrations of the configured PostgreSQL database and returns the article
+// storage and the lease store on it.
+func newPostgresStorage(ctx context.Context) (*articles.Storage, leader.Store) {
+	pool := db.PostgresConnect()
+	store, err := articles.NewPostgresStorage(ctx, pool)
+	if err != nil {
+		log.Fatal("Could not prepare the PostgreSQL storage: ", err)
+	}
+	leaseStore, err := leader.NewPostgresStore(ctx, pool)
+	if err != nil {
+		log.Fatal("Could not prepare the PostgreSQL lease store: ", err)
+	}
+	applySafeMigrations(ctx, newPostgresMigrationRunner(ctx, pool, leaseStore), "PostgreSQL tables")
+	return store, leaseStore
+}
+
+// newSQLiteStorage applies the pending migrations of the configured SQLite database file and returns the article
+// storage and the lease store on it.
+func newSQLiteStorage(ctx context.Context) (*articles.Storage, leader.Store) {
+	database := db.SQLiteConnect()
+	store, err := articles.NewSQLiteStorage(ctx, database)
+	if err != nil {
+		log.Fatal("Could not prepare the SQLite storage: ", err)
+	}
+	leaseStore, err := leader.NewSQLiteStore(ctx, database)
+	if err != nil {
+		log.Fatal("Could not prepare the SQLite lease store: ", err)
+	}
+	applySafeMigrations(ctx, newSQLiteMigrationRunner(ctx, database, leaseStore), "SQLite tables")
+	return store, leaseStore
+}
+
+// applySafeMigrations applies the pending migrations on startup. Migrations that remove or rewrite stored data are
+// not applied, the service does not start until they were applied with the migrate up command.
+func applySafeMigrations(ctx context.Context, runner *migration.Runner, target string) {
+	if _, err := runner.UpSafe(ctx); err != nil {
+		if errors.Is(err, migration.ErrDestructivePending) {
+			log.Fatalf("%v, review it and apply it with: go run main.go migrate up", err)
+		}
+		log.Fatalf("Could not migrate the %v: %v", target, err)
+	}
+}
+
+// newMigrationRunner returns the runner of the migrations of the configured storage backend. Unlike newStorage it
+// applies no migrations, so that the migrate command can apply and revert them.
+func newMigrationRunner(ctx context.Context) *migration.Runner {
+	switch config.Conf.Storage.Backend {
+	case config.StorageMemory:
+		log.Fatalf("The %v storage backend has no migrations", config.StorageMemory)
+	case config.StoragePostgres:
+		pool := db.PostgresConnect()
+		leaseStore, err := leader.NewPostgresStore(ctx, pool)
+		if err != nil {
+			log.Fatal("Could not prepare the PostgreSQL lease store: ", err)
+		}
+		return newPostgresMigrationRunner(ctx, pool, leaseStore)
+	case config.StorageSQLite:
+		database := db.SQLiteConnect()
+		leaseStore, err := leader.NewSQLiteStore(ctx, database)
+		if err != nil {
+			log.Fatal("Could not prepare the SQLite lease store: ", err)
+		}
+		return newSQLiteMigrationRunner(ctx, database, leaseStore)
+	}
+	return newMongoMigrationRunner(leader.NewMongoStore(db.GetMongoCollection("leases")))
+}
+
+// newMongoMigrationRunner returns the runner of the MongoDB migrations, recording them in the schema_migrations
+// collection and holding the migration lock in the given lease store.
+func newMongoMigrationRunner(leaseStore leader.Store) *migration.Runner {
+	return migration.NewRunner(migration.NewMongoStore(db.GetMongoCollection("schema_migrations")), leaseStore,
+		config.Conf.Leader.InstanceID, articles.MongoMigrations())
+}
+
+// newPostgresMigrationRunner returns the runner of the PostgreSQL migrations, recording them in the
+// schema_migrations table and holding the migration lock in the given lease store.
+func newPostgresMigrationRunner(ctx context.Context, pool *pgxpool.Pool, leaseStore leader.Store) *migration.Runner {
+	migrationStore, err := migration.NewPostgresStore(ctx, pool)
+	if err != nil {
+		log.Fatal("Could not prepare the PostgreSQL migration store: ", err)
+	}
+	return migration.NewRunner(migrationStore, leaseStore, config.Conf.Leader.InstanceID, articles.PostgresMigrations(pool))
+}
+
+// newSQLiteMigrationRunner returns the runner of the SQLite migrations, recording them in the schema_migrations
+// table and holding the migration lock in the given lease store.
+func newSQLiteMigrationRunner(ctx context.Context, database *sql.DB, leaseStore leader.Store) *migration.Runner {
+	migrationStore, err := migration.NewSQLiteStore(ctx, database)
+	if err != nil {
+		log.Fatal("Could not prepare the SQLite migration store: ", err)
+	}
+	return migration.NewRunner(migrationStore, leaseStore, config.Conf.Leader.InstanceID, articles.SQLiteMigrations(database))
+}
+
+// runCommand runs the one-off command with the given name and arguments.
+func runCommand(name string, args []string) {
+	switch name {
+	case "backfill":
+		runBackfillCommand(args)
+	case "rewrite-team-ids":
+		runRewriteTeamIDsCommand()
+	case "normalize-lists":
+		runNormalizeListsCommand()
+	case "refresh-articles":
+		runRefreshArticlesCommand(args)
+	case "copy-to-postgres":
+		runCopyToPostgresCommand()
+	case "migrate":
+		runMigrateCommand(args)
+	default:
+		log.Fatalf("Unknown command %v, available commands: backfill, rewrite-team-ids, normalize-lists, refresh-articles, copy-to-postgres, migrate", name)
+	}
+}
+
+// runRewriteTeamIDsCommand moves the articles stored under the legacy team IDs of the feeds to their club keys.
+func runRewriteTeamIDsCommand() {
+	store, _ := newStorage(context.Background())
+	if err := articles.RewriteLegacyTeamIDs(context.Background(), store); err != nil {
+		log.Fatal("Rewriting the legacy team IDs failed: ", err)
+	}
+}
+
+// runBackfillCommand pages through the full article archive of a feed and stores the missing articles.
+func runBackfillCommand(args []string) {
+	flags := flag.NewFlagSet("backfill", flag.ExitOnError)
+	feed := flags.String("feed", "", "club key of the feed to backfill")
+	pageSize := flags.Int("pageSize", 0, "number of articles per page, defaults to the feed's backfill page size")
+	since := flags.String("since", "", "only backfill articles published on or after this date (YYYY-MM-DD)")
+	restart := flags.Bool("restart", false, "ignore an unfinished checkpoint and start from the first page")
+	flags.Parse(args)
+
+	opts := articles.BackfillOptions{PageSize: *pageSize, Restart: *restart}
+	if *since != "" {
+		sinceDate, err := time.Parse(articles.BackfillDateLayout, *since)
+		if err != nil {
+			log.Fatalf("Invalid since date %v, expected YYYY-MM-DD", *since)
+		}
+		opts.Since = sinceDate
+	}
+
+	store, _ := newStorage(context.Background())
+	if err := articles.RunBackfill(context.Background(), store, *feed, opts); err != nil {
+		log.Fatal("Backfill failed: ", err)
+	}
+}
+
+// runNormalizeListsCommand splits the taxonomies and gallery URLs of already stored articles into normalized lists.
+func runNormalizeListsCommand() {
+	store, _ := newStorage(context.Background())
+	if err := articles.NormalizeStoredArticles(context.Background(), store); err != nil {
+		log.Fatal("Normalizing stored articles failed: ", err)
+	}
+}
+
+// runRefreshArticlesCommand fetches every stored article of a feed again and overwrites it.
+func runRefreshArticlesCommand(args []string) {
+	flags := flag.NewFlagSet("refresh-articles", flag.ExitOnError)
+	feed := flags.String("feed", "", "club key of the feed whose articles are refreshed")
+	flags.Parse(args)
+
+	store, _ := newStorage(context.Background())
+	if err := articles.RefreshFeedArticles(context.Background(), store, *feed); err != nil {
+		log.Fatal("Refreshing the articles failed: ", err)
+	}
+}
+
+// runCopyToPostgresCommand copies the articles and the ingestion state from MongoDB to the configured PostgreSQL database.
+func runCopyToPostgresCommand() {
+	if config.Conf.Postgres.URL == "" {
+		log.Fatal("Copying to PostgreSQL needs a postgres url in the configuration")
+	}
+	ctx := context.Background()
+	to, _ := newPostgresStorage(ctx)
+	defer db.ClosePostgres()
+	if err := articles.CopyStorage(ctx, articles.NewMongoStorage(), to); err != nil {
+		log.Fatal("Copying to PostgreSQL failed: ", err)
+	}
+}
+
+// runMigrateCommand applies, reverts or lists the migrations of the configured storage backend.
+func runMigrateCommand(args []string) {
+	if len(args) == 0 {
+		log.Fatal("Missing migrate action, expected up, down or status")
+	}
+	flags := flag.NewFlagSet("migrate "+args[0], flag.ExitOnError)
+	steps := flags.Int("steps", 1, "number of the latest applied migrations to revert")
+	flags.Parse(args[1:])
 
-	// Start the HTTP server with the provided router
-	server.StartServer(r)
+	ctx := context.Background()
+	runner := newMigrationRunner(ctx)
+	switch args[0] {
+	case "up":
+		applied, err := runner.Up(ctx)
+		if err != nil {
+			log.Fatal("Applying migrations failed: ", err)
+		}
+		log.Printf("Applied %v migrations", applied)
+	case "down":
+		reverted, err := runner.Down(ctx, *steps)
+		if err != nil {
+			log.Fatal("Reverting migrations failed: ", err)
+		}
+		log.Printf("Reverted %v migrations", reverted)
+	case "status":
+		statuses, err := runner.Status(ctx)
+		if err != nil {
+			log.Fatal("Getting the migration status failed: ", err)
+		}
+		for _, status := range statuses {
+			switch {
+			case status.Unknown:
+				log.Printf("%v %v: applied at %v by a newer version", status.Version, status.Name, status.AppliedAt.Format(time.RFC3339))
+			case status.Applied:
+				log.Printf("%v %v: applied at %v", status.Version, status.Name, status.AppliedAt.Format(time.RFC3339))
+			default:
+				log.Printf("%v %v: pending", status.Version, status.Name)
+			}
+		}
+	default:
+		log.Fatalf("Unknown migrate action %v, expected up, down or status", args[0])
+	}
 }
@@ -0,0 +1,249 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/SkaisgirisMarius/article-processor/leader"
+	log "github.com/sirupsen/logrus"
+	"sort"
+	"time"
+)
+
+// lockName is the name of the lease that keeps instances from applying or reverting migrations at the same time.
+const lockName = "schema-migrations"
+
+// lockTTL is how long the migration lock stays valid without being renewed.
+const lockTTL = 30 * time.Second
+
+// defaultLockRetry is how often a runner tries again to take the migration lock held by another instance.
+const defaultLockRetry = 2 * time.Second
+
+// ErrDestructivePending is returned by UpSafe when a pending migration would remove or rewrite data.
+var ErrDestructivePending = errors.New("a pending migration removes or rewrites data and has to be applied explicitly")
+
+// Migration is a versioned change of the database schema. Up applies the change and Down reverts it.
+// Versions are applied in ascending order and reverted in descending order. A Destructive migration removes or
+// rewrites data, Affected counts the records it would remove or rewrite when it was applied now.
+type Migration struct {
+	Version     int
+	Name        string
+	Up          func(ctx context.Context) error
+	Down        func(ctx context.Context) error
+	Destructive bool
+	Affected    func(ctx context.Context) (int, error)
+}
+
+// Record is the stored record of an applied migration.
+type Record struct {
+	Version   int       `bson:"_id" json:"version"`
+	Name      string    `bson:"name" json:"name"`
+	AppliedAt time.Time `bson:"appliedAt" json:"appliedAt"`
+}
+
+// Status is the state of a migration. A migration that is applied but unknown to this build was added by a newer version.
+type Status struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	Unknown   bool
+}
+
+// Store keeps the records of the applied migrations.
+type Store interface {
+	// Applied returns the records of the applied migrations.
+	Applied(ctx context.Context) ([]Record, error)
+	// Add records an applied migration. Recording a migration that is already recorded is not an error,
+	// so instances that apply the migrations at the same time do not fail each other.
+	Add(ctx context.Context, record Record) error
+	// Remove removes the record of a reverted migration.
+	Remove(ctx context.Context, version int) error
+}
+
+// Runner applies and reverts the migrations, recording them in the store. When it has a lock store, it holds the
+// migration lock while applying or reverting, waiting for other instances doing the same.
+type Runner struct {
+	store      Store
+	locks      leader.Store
+	holder     string
+	lockRetry  time.Duration
+	migrations []Migration
+}
+
+// NewRunner creates a runner of the given migrations that takes the migration lock in the given lock store as the
+// given holder, a nil lock store runs without a lock. It panics when two migrations share a version.
+func NewRunner(store Store, locks leader.Store, holder string, migrations []Migration) *Runner {
+	sorted := append([]Migration(nil), migrations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i].Version == sorted[i-1].Version {
+			panic(fmt.Sprintf("duplicate migration version %v", sorted[i].Version))
+		}
+	}
+	return &Runner{store: store, locks: locks, holder: holder, lockRetry: defaultLockRetry, migrations: sorted}
+}
+
+// lock takes the migration lock, waiting while it is held by another instance. It returns the context the
+// migrations have to run with, which is cancelled when the lock is lost, and the function releasing the lock.
+func (r *Runner) lock(ctx context.Context) (context.Context, func(), error) {
+	if r.locks == nil {
+		return ctx, func() {}, nil
+	}
+	for {
+		lockCtx, unlock, err := leader.TryLock(ctx, r.locks, lockName, r.holder, lockTTL)
+		if err == nil {
+			return lockCtx, unlock, nil
+		}
+		if !errors.Is(err, leader.ErrLocked) {
+			return nil, nil, err
+		}
+		log.Println("Another instance is migrating the database, waiting for it")
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-time.After(r.lockRetry):
+		}
+	}
+}
+
+// applied returns the records of the applied migrations by version.
+func (r *Runner) applied(ctx context.Context) (map[int]Record, error) {
+	records, err := r.store.Applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	applied := make(map[int]Record)
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
+
+// Up applies the pending migrations in ascending order, including the destructive ones, and returns how many were
+// applied. It stops at the first migration that fails, the migrations applied before it stay applied.
+func (r *Runner) Up(ctx context.Context) (int, error) {
+	return r.up(ctx, false)
+}
+
+// UpSafe applies the pending migrations like Up, but stops before the first destructive migration that would
+// remove or rewrite any records and returns ErrDestructivePending for it. Destructive migrations that affect no
+// records, for instance on an empty database, are applied.
+func (r *Runner) UpSafe(ctx context.Context) (int, error) {
+	return r.up(ctx, true)
+}
+
+// up applies the pending migrations under the migration lock, stopping before destructive ones when safe is set.
+func (r *Runner) up(ctx context.Context, safe bool) (int, error) {
+	ctx, unlock, err := r.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	applied, err := r.applied(ctx)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, m := range r.migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		if safe && m.Destructive {
+			affected := -1
+			if m.Affected != nil {
+				if affected, err = m.Affected(ctx); err != nil {
+					return count, fmt.Errorf("checking migration %v %v failed: %w", m.Version, m.Name, err)
+				}
+			}
+			if affected != 0 {
+				return count, fmt.Errorf("%w: migration %v %v affects %v records", ErrDestructivePending, m.Version, m.Name, affected)
+			}
+		}
+		log.Printf("Applying migration %v %v", m.Version, m.Name)
+		if err := m.Up(ctx); err != nil {
+			return count, fmt.Errorf("migration %v %v failed: %w", m.Version, m.Name, err)
+		}
+		if err := r.store.Add(ctx, Record{Version: m.Version, Name: m.Name, AppliedAt: time.Now().UTC()}); err != nil {
+			return count, err
+		}
+		count++
+	}
+	for version, record := range applied {
+		if r.find(version) == nil {
+			log.Warnf("Migration %v %v is applied but unknown to this version of the service", version, record.Name)
+		}
+	}
+	return count, nil
+}
+
+// Down reverts the given number of the latest applied migrations in descending order and returns how many were
+// reverted. A migration that is unknown to this build cannot be reverted.
+func (r *Runner) Down(ctx context.Context, steps int) (int, error) {
+	ctx, unlock, err := r.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	applied, err := r.applied(ctx)
+	if err != nil {
+		return 0, err
+	}
+	versions := make([]int, 0, len(applied))
+	for version := range applied {
+		versions = append(versions, version)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+
+	count := 0
+	for _, version := range versions {
+		if count == steps {
+			break
+		}
+		m := r.find(version)
+		if m == nil {
+			return count, fmt.Errorf("migration %v %v is unknown to this version of the service", version, applied[version].Name)
+		}
+		log.Printf("Reverting migration %v %v", m.Version, m.Name)
+		if err := m.Down(ctx); err != nil {
+			return count, fmt.Errorf("reverting migration %v %v failed: %w", m.Version, m.Name, err)
+		}
+		if err := r.store.Remove(ctx, m.Version); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Status returns the state of every known and every applied migration, ordered by version.
+func (r *Runner) Status(ctx context.Context) ([]Status, error) {
+	applied, err := r.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var statuses []Status
+	for _, m := range r.migrations {
+		record, ok := applied[m.Version]
+		statuses = append(statuses, Status{Version: m.Version, Name: m.Name, Applied: ok, AppliedAt: record.AppliedAt})
+	}
+	for version, record := range applied {
+		if r.find(version) == nil {
+			statuses = append(statuses, Status{Version: version, Name: record.Name, Applied: true, AppliedAt: record.AppliedAt, Unknown: true})
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+// find returns the migration with the given version, or nil.
+func (r *Runner) find(version int) *Migration {
+	for i := range r.migrations {
+		if r.migrations[i].Version == version {
+			return &r.migrations[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,274 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"github.com/SkaisgirisMarius/article-processor/db"
+	"github.com/SkaisgirisMarius/article-processor/leader"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+// memoryStore keeps the records of the applied migrations of a test.
+type memoryStore struct {
+	records map[int]Record
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{records: make(map[int]Record)}
+}
+
+func (s *memoryStore) Applied(ctx context.Context) ([]Record, error) {
+	var records []Record
+	for _, record := range s.records {
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Version < records[j].Version })
+	return records, nil
+}
+
+func (s *memoryStore) Add(ctx context.Context, record Record) error {
+	if _, ok := s.records[record.Version]; !ok {
+		s.records[record.Version] = record
+	}
+	return nil
+}
+
+func (s *memoryStore) Remove(ctx context.Context, version int) error {
+	delete(s.records, version)
+	return nil
+}
+
+// testMigrations returns migrations that log their steps, the migration with the failing version fails.
+func testMigrations(steps *[]string, failing int) []Migration {
+	var migrations []Migration
+	for _, name := range []string{"three", "one", "two"} {
+		name := name
+		version := map[string]int{"one": 1, "two": 2, "three": 3}[name]
+		migrations = append(migrations, Migration{
+			Version: version,
+			Name:    name,
+			Up: func(ctx context.Context) error {
+				if version == failing {
+					return errors.New("index build failed")
+				}
+				*steps = append(*steps, "up "+name)
+				return nil
+			},
+			Down: func(ctx context.Context) error {
+				*steps = append(*steps, "down "+name)
+				return nil
+			},
+		})
+	}
+	return migrations
+}
+
+func TestUpAppliesPendingMigrationsInOrder(t *testing.T) {
+	var steps []string
+	store := newMemoryStore()
+	runner := NewRunner(store, nil, "", testMigrations(&steps, 0))
+
+	applied, err := runner.Up(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 3, applied)
+	assert.Equal(t, []string{"up one", "up two", "up three"}, steps)
+	assert.Equal(t, "two", store.records[2].Name)
+
+	// Applied migrations are not applied again
+	applied, err = runner.Up(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, applied)
+	assert.Equal(t, 3, len(steps))
+}
+
+func TestUpStopsAtFailedMigration(t *testing.T) {
+	var steps []string
+	store := newMemoryStore()
+
+	applied, err := NewRunner(store, nil, "", testMigrations(&steps, 2)).Up(context.Background())
+	assert.Error(t, err)
+	assert.Equal(t, 1, applied)
+	assert.Equal(t, []string{"up one"}, steps)
+	assert.Equal(t, 1, len(store.records))
+
+	// The failed migration is retried by the next run
+	applied, err = NewRunner(store, nil, "", testMigrations(&steps, 0)).Up(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, applied)
+}
+
+func TestDownRevertsLatestMigrations(t *testing.T) {
+	var steps []string
+	store := newMemoryStore()
+	runner := NewRunner(store, nil, "", testMigrations(&steps, 0))
+	_, err := runner.Up(context.Background())
+	assert.NoError(t, err)
+
+	steps = nil
+	reverted, err := runner.Down(context.Background(), 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, reverted)
+	assert.Equal(t, []string{"down three", "down two"}, steps)
+
+	statuses, err := runner.Status(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(statuses))
+	assert.True(t, statuses[0].Applied)
+	assert.False(t, statuses[1].Applied)
+	assert.False(t, statuses[2].Applied)
+}
+
+func TestUnknownAppliedMigration(t *testing.T) {
+	var steps []string
+	store := newMemoryStore()
+	store.records[4] = Record{Version: 4, Name: "four"}
+	runner := NewRunner(store, nil, "", testMigrations(&steps, 0))
+
+	// Migrations of a newer version do not stop an older version from starting, but cannot be reverted by it
+	_, err := runner.Up(context.Background())
+	assert.NoError(t, err)
+	statuses, err := runner.Status(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 4, len(statuses))
+	assert.True(t, statuses[3].Unknown)
+	reverted, err := runner.Down(context.Background(), 1)
+	assert.Error(t, err)
+	assert.Equal(t, 0, reverted)
+	assert.Equal(t, 4, len(store.records))
+}
+
+func TestUpSafeStopsAtDestructiveMigration(t *testing.T) {
+	var steps []string
+	store := newMemoryStore()
+	affected := 3
+	migrations := testMigrations(&steps, 0)
+	for i := range migrations {
+		if migrations[i].Version == 2 {
+			migrations[i].Destructive = true
+			migrations[i].Affected = func(ctx context.Context) (int, error) { return affected, nil }
+		}
+	}
+	runner := NewRunner(store, nil, "", migrations)
+
+	// The migrations before the destructive one are applied, the destructive one waits for an explicit up
+	applied, err := runner.UpSafe(context.Background())
+	assert.ErrorIs(t, err, ErrDestructivePending)
+	assert.Equal(t, 1, applied)
+	assert.Equal(t, []string{"up one"}, steps)
+
+	// A destructive migration that affects no records is applied on startup
+	affected = 0
+	applied, err = runner.UpSafe(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, applied)
+	assert.Equal(t, []string{"up one", "up two", "up three"}, steps)
+}
+
+func TestUpAppliesDestructiveMigration(t *testing.T) {
+	var steps []string
+	store := newMemoryStore()
+	migrations := testMigrations(&steps, 0)
+	migrations[0].Destructive = true
+	migrations[0].Affected = func(ctx context.Context) (int, error) { return 3, nil }
+
+	applied, err := NewRunner(store, nil, "", migrations).Up(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 3, applied)
+}
+
+func TestUpWaitsForMigrationLock(t *testing.T) {
+	var steps []string
+	locks := leader.NewMemoryStore()
+	_, ok, err := locks.Acquire(context.Background(), lockName, "other", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	runner := NewRunner(newMemoryStore(), locks, "this", testMigrations(&steps, 0))
+	runner.lockRetry = 10 * time.Millisecond
+
+	released := make(chan struct{})
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		assert.Empty(t, steps)
+		locks.Release(context.Background(), lockName, "other")
+		close(released)
+	}()
+	applied, err := runner.Up(context.Background())
+	<-released
+	assert.NoError(t, err)
+	assert.Equal(t, 3, applied)
+
+	// The lock is released after migrating
+	_, ok, err = locks.Acquire(context.Background(), lockName, "other", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
+
+// testStores returns the migration stores the store tests run on: the in-memory store, a SQLite store in a temporary
+// file and a PostgreSQL store on the emptied schema_migrations table of the POSTGRES_TEST_URL environment variable,
+// when it is set.
+func testStores(t *testing.T) map[string]Store {
+	ctx := context.Background()
+	stores := map[string]Store{"memory": newMemoryStore()}
+	database, err := db.OpenSQLite(filepath.Join(t.TempDir(), "migrations.db"))
+	if err != nil {
+		t.Fatal("Failed to open SQLite: ", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	sqliteStore, err := NewSQLiteStore(ctx, database)
+	if err != nil {
+		t.Fatal("Failed to create the SQLite migration table: ", err)
+	}
+	stores["sqlite"] = sqliteStore
+	if url := os.Getenv("POSTGRES_TEST_URL"); url != "" {
+		pool, err := db.OpenPostgres(ctx, url)
+		if err != nil {
+			t.Fatal("Failed to connect to PostgreSQL: ", err)
+		}
+		t.Cleanup(pool.Close)
+		postgresStore, err := NewPostgresStore(ctx, pool)
+		if err != nil {
+			t.Fatal("Failed to create the PostgreSQL migration table: ", err)
+		}
+		if _, err := pool.Exec(ctx, "TRUNCATE schema_migrations"); err != nil {
+			t.Fatal("Failed to clean up test data: ", err)
+		}
+		stores["postgres"] = postgresStore
+	}
+	return stores
+}
+
+func TestStore(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			records, err := store.Applied(ctx)
+			assert.NoError(t, err)
+			assert.Empty(t, records)
+
+			appliedAt := time.Now().UTC().Truncate(time.Millisecond)
+			assert.NoError(t, store.Add(ctx, Record{Version: 2, Name: "two", AppliedAt: appliedAt}))
+			assert.NoError(t, store.Add(ctx, Record{Version: 1, Name: "one", AppliedAt: appliedAt}))
+
+			// A migration recorded by another instance in the meantime is kept
+			assert.NoError(t, store.Add(ctx, Record{Version: 2, Name: "other", AppliedAt: appliedAt}))
+
+			records, err = store.Applied(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, 2, len(records))
+			assert.Equal(t, 1, records[0].Version)
+			assert.Equal(t, "two", records[1].Name)
+			assert.True(t, appliedAt.Equal(records[1].AppliedAt))
+
+			assert.NoError(t, store.Remove(ctx, 1))
+			records, err = store.Applied(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, 1, len(records))
+			assert.Equal(t, 2, records[0].Version)
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package migration
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore keeps the records of the applied migrations in a MongoDB collection, one document per migration.
+type MongoStore struct {
+	collection *mongo.Collection
+}
+
+// NewMongoStore creates a migration store on the given collection.
+func NewMongoStore(collection *mongo.Collection) *MongoStore {
+	return &MongoStore{collection: collection}
+}
+
+// Applied returns the records of the applied migrations.
+func (s *MongoStore) Applied(ctx context.Context) ([]Record, error) {
+	cur, err := s.collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	records := make([]Record, 0)
+	if err := cur.All(ctx, &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// Add records an applied migration, a migration recorded by another instance in the meantime is kept.
+func (s *MongoStore) Add(ctx context.Context, record Record) error {
+	_, err := s.collection.InsertOne(ctx, record)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil
+	}
+	return err
+}
+
+// Remove removes the record of a reverted migration.
+func (s *MongoStore) Remove(ctx context.Context, version int) error {
+	_, err := s.collection.DeleteOne(ctx, bson.M{"_id": version})
+	return err
+}
@@ -0,0 +1,58 @@
+package migration
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// postgresMigrationsSchema creates the table of the PostgreSQL migration store, one row per applied migration.
+const postgresMigrationsSchema = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+	version    INTEGER PRIMARY KEY,
+	name       TEXT NOT NULL,
+	applied_at TIMESTAMPTZ NOT NULL
+)`
+
+// PostgresStore keeps the records of the applied migrations in a PostgreSQL table.
+type PostgresStore struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresStore creates a migration store on the given database, creating its table if needed.
+func NewPostgresStore(ctx context.Context, pool *pgxpool.Pool) (*PostgresStore, error) {
+	if _, err := pool.Exec(ctx, postgresMigrationsSchema); err != nil {
+		return nil, err
+	}
+	return &PostgresStore{pool: pool}, nil
+}
+
+// Applied returns the records of the applied migrations.
+func (s *PostgresStore) Applied(ctx context.Context) ([]Record, error) {
+	rows, err := s.pool.Query(ctx, "SELECT version, name, applied_at FROM schema_migrations ORDER BY version")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	records := make([]Record, 0)
+	for rows.Next() {
+		var record Record
+		if err := rows.Scan(&record.Version, &record.Name, &record.AppliedAt); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// Add records an applied migration, a migration recorded by another instance in the meantime is kept.
+func (s *PostgresStore) Add(ctx context.Context, record Record) error {
+	query := "INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3) ON CONFLICT (version) DO NOTHING"
+	_, err := s.pool.Exec(ctx, query, record.Version, record.Name, record.AppliedAt)
+	return err
+}
+
+// Remove removes the record of a reverted migration.
+func (s *PostgresStore) Remove(ctx context.Context, version int) error {
+	_, err := s.pool.Exec(ctx, "DELETE FROM schema_migrations WHERE version = $1", version)
+	return err
+}
@@ -0,0 +1,63 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"github.com/SkaisgirisMarius/article-processor/db"
+)
+
+// sqliteMigrationsSchema creates the table of the SQLite migration store, one row per applied migration.
+const sqliteMigrationsSchema = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+	version    INTEGER PRIMARY KEY,
+	name       TEXT NOT NULL,
+	applied_at TEXT NOT NULL
+)`
+
+// SQLiteStore keeps the records of the applied migrations in a SQLite table.
+type SQLiteStore struct {
+	database *sql.DB
+}
+
+// NewSQLiteStore creates a migration store on the given database, creating its table if needed.
+func NewSQLiteStore(ctx context.Context, database *sql.DB) (*SQLiteStore, error) {
+	if _, err := database.ExecContext(ctx, sqliteMigrationsSchema); err != nil {
+		return nil, err
+	}
+	return &SQLiteStore{database: database}, nil
+}
+
+// Applied returns the records of the applied migrations.
+func (s *SQLiteStore) Applied(ctx context.Context) ([]Record, error) {
+	rows, err := s.database.QueryContext(ctx, "SELECT version, name, applied_at FROM schema_migrations ORDER BY version")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	records := make([]Record, 0)
+	for rows.Next() {
+		var record Record
+		var appliedAt string
+		if err := rows.Scan(&record.Version, &record.Name, &appliedAt); err != nil {
+			return nil, err
+		}
+		if record.AppliedAt, err = db.ParseSQLiteTime(appliedAt); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// Add records an applied migration, a migration recorded by another instance in the meantime is kept.
+func (s *SQLiteStore) Add(ctx context.Context, record Record) error {
+	query := "INSERT INTO schema_migrations (version, name, applied_at) VALUES (?1, ?2, ?3) ON CONFLICT (version) DO NOTHING"
+	_, err := s.database.ExecContext(ctx, query, record.Version, record.Name, db.SQLiteTime(record.AppliedAt))
+	return err
+}
+
+// Remove removes the record of a reverted migration.
+func (s *SQLiteStore) Remove(ctx context.Context, version int) error {
+	_, err := s.database.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = ?1", version)
+	return err
+}
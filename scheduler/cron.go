@@ -0,0 +1,243 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxYearsAhead bounds the search for the next run of a cron expression that never matches, such as "0 0 30 2 *".
+const maxYearsAhead = 5
+
+// Schedule tells when a job runs next.
+type Schedule interface {
+	// Next returns the first run time after the given time, or the zero time when there is none.
+	Next(after time.Time) time.Time
+}
+
+// descriptors are the shorthands accepted in place of a cron expression.
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var monthNames = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+var weekdayNames = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+
+// cronField is the range and the names of the values of a field of a cron expression.
+type cronField struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minuteField  = cronField{name: "minute", min: 0, max: 59}
+	hourField    = cronField{name: "hour", min: 0, max: 23}
+	dayField     = cronField{name: "day of month", min: 1, max: 31}
+	monthField   = cronField{name: "month", min: 1, max: 12, names: monthNames}
+	weekdayField = cronField{name: "day of week", min: 0, max: 7, names: weekdayNames}
+)
+
+// cronSchedule is a parsed cron expression, every field is a bit set of the matching values.
+// As in cron, a day matches either field when both the day of month and the day of week are restricted.
+type cronSchedule struct {
+	minute, hour, day, month, weekday uint64
+	dayRestricted, weekdayRestricted  bool
+	location                          *time.Location
+}
+
+// everySchedule runs a job at a fixed interval after its previous run.
+type everySchedule struct {
+	interval time.Duration
+}
+
+// multiSchedule runs a job at the run times of all its schedules.
+type multiSchedule []Schedule
+
+// Every returns a schedule that runs a job every interval.
+func Every(interval time.Duration) Schedule {
+	return everySchedule{interval: interval}
+}
+
+// Next returns the time one interval after the given time.
+func (s everySchedule) Next(after time.Time) time.Time {
+	return after.Add(s.interval)
+}
+
+// Combine returns a schedule that runs a job at the run times of all the given schedules.
+func Combine(schedules ...Schedule) Schedule {
+	if len(schedules) == 1 {
+		return schedules[0]
+	}
+	return multiSchedule(schedules)
+}
+
+// Next returns the earliest next run time of the schedules.
+func (s multiSchedule) Next(after time.Time) time.Time {
+	var next time.Time
+	for _, schedule := range s {
+		if candidate := schedule.Next(after); !candidate.IsZero() && (next.IsZero() || candidate.Before(next)) {
+			next = candidate
+		}
+	}
+	return next
+}
+
+// ParseCron parses a standard five field cron expression (minute, hour, day of month, month, day of week), or one
+// of the @yearly, @monthly, @weekly, @daily, @hourly and "@every <duration>" shorthands. The fields are matched
+// in the given location. Fields accept *, values, ranges, lists and steps, months and days of week also their
+// three letter English names.
+func ParseCron(expression string, location *time.Location) (Schedule, error) {
+	expression = strings.TrimSpace(expression)
+	if strings.HasPrefix(expression, "@every ") {
+		interval, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(expression, "@every ")))
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("invalid interval in cron expression %q", expression)
+		}
+		return Every(interval), nil
+	}
+	if descriptor, found := descriptors[strings.ToLower(expression)]; found {
+		expression = descriptor
+	}
+
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q must have 5 fields, has %v", expression, len(fields))
+	}
+	schedule := &cronSchedule{
+		location:          location,
+		dayRestricted:     !strings.HasPrefix(fields[2], "*"),
+		weekdayRestricted: !strings.HasPrefix(fields[4], "*"),
+	}
+	var err error
+	if schedule.minute, err = parseCronField(fields[0], minuteField); err != nil {
+		return nil, err
+	}
+	if schedule.hour, err = parseCronField(fields[1], hourField); err != nil {
+		return nil, err
+	}
+	if schedule.day, err = parseCronField(fields[2], dayField); err != nil {
+		return nil, err
+	}
+	if schedule.month, err = parseCronField(fields[3], monthField); err != nil {
+		return nil, err
+	}
+	if schedule.weekday, err = parseCronField(fields[4], weekdayField); err != nil {
+		return nil, err
+	}
+	// Both 0 and 7 are Sunday
+	if schedule.weekday&(1<<7) != 0 {
+		schedule.weekday |= 1
+	}
+	return schedule, nil
+}
+
+// parseCronField parses a comma separated list of *, values and ranges with optional steps into a bit set.
+func parseCronField(value string, field cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(value, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepPart); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q in %v field %q", stepPart, field.name, value)
+			}
+		}
+
+		start, end := field.min, field.max
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			from, to, _ := strings.Cut(rangePart, "-")
+			var err error
+			if start, err = parseCronValue(from, field); err != nil {
+				return 0, err
+			}
+			if end, err = parseCronValue(to, field); err != nil {
+				return 0, err
+			}
+			if start > end {
+				return 0, fmt.Errorf("invalid range %q in %v field", rangePart, field.name)
+			}
+		default:
+			var err error
+			if start, err = parseCronValue(rangePart, field); err != nil {
+				return 0, err
+			}
+			end = start
+			if hasStep {
+				end = field.max
+			}
+		}
+		for v := start; v <= end; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// parseCronValue parses a single number or name of a cron field and checks its range.
+func parseCronValue(value string, field cronField) (int, error) {
+	if number, found := field.names[strings.ToLower(value)]; found {
+		return number, nil
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil || number < field.min || number > field.max {
+		return 0, fmt.Errorf("invalid value %q in %v field, expected %v-%v", value, field.name, field.min, field.max)
+	}
+	return number, nil
+}
+
+// Next returns the first minute after the given time that matches the expression.
+func (s *cronSchedule) Next(after time.Time) time.Time {
+	location := s.location
+	if location == nil {
+		location = time.UTC
+	}
+	t := after.In(location)
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, location).Add(time.Minute)
+	yearLimit := t.Year() + maxYearsAhead
+
+	for t.Year() <= yearLimit {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, location)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, location)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, location)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// dayMatches reports whether the day of the time matches the day of month and day of week fields.
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	dayMatch := s.day&(1<<uint(t.Day())) != 0
+	weekdayMatch := s.weekday&(1<<uint(t.Weekday())) != 0
+	if s.dayRestricted && s.weekdayRestricted {
+		return dayMatch || weekdayMatch
+	}
+	return dayMatch && weekdayMatch
+}
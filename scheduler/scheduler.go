@@ -0,0 +1,242 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+// idleWait is how long the scheduler sleeps when no job is due, it is woken up earlier when the jobs change.
+const idleWait = time.Hour
+
+// ErrUnknownJob is returned for a job name that was never added to the scheduler.
+var ErrUnknownJob = errors.New("unknown job")
+
+// Scheduler runs named jobs on their schedules. A job that is still running when it is due again is skipped,
+// and a paused job is not run until it is resumed. Jobs can be added and paused before the scheduler is started,
+// and a stopped scheduler can be started again.
+type Scheduler struct {
+	mu         sync.Mutex
+	jobs       map[string]*job
+	names      []string
+	changed    chan struct{}
+	stop       chan struct{}
+	started    bool
+	runs       sync.WaitGroup
+	runCtx     context.Context
+	cancelRuns context.CancelFunc
+}
+
+type job struct {
+	schedule Schedule
+	run      func(ctx context.Context)
+	next     time.Time
+	paused   bool
+	running  bool
+}
+
+// JobState is the state of a scheduled job. Next is the zero time while the job is paused or the scheduler is not started.
+type JobState struct {
+	Name    string    `json:"name"`
+	Next    time.Time `json:"next"`
+	Paused  bool      `json:"paused"`
+	Running bool      `json:"running"`
+}
+
+// New creates an empty scheduler.
+func New() *Scheduler {
+	return &Scheduler{jobs: make(map[string]*job), changed: make(chan struct{}, 1)}
+}
+
+// Add schedules the given function under a unique name. The function gets a context that is cancelled when the
+// scheduler is stopped and its runs do not finish in time.
+func (s *Scheduler) Add(name string, schedule Schedule, run func(ctx context.Context)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.jobs[name]; exists {
+		return fmt.Errorf("job %v is already scheduled", name)
+	}
+	s.jobs[name] = &job{schedule: schedule, run: run, next: schedule.Next(time.Now())}
+	s.names = append(s.names, name)
+	s.notify()
+	return nil
+}
+
+// Pause stops running the job until it is resumed. A run that is in progress is not interrupted.
+func (s *Scheduler) Pause(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, found := s.jobs[name]
+	if !found {
+		return ErrUnknownJob
+	}
+	j.paused = true
+	s.notify()
+	return nil
+}
+
+// Resume runs a paused job again from its next run time after now.
+func (s *Scheduler) Resume(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, found := s.jobs[name]
+	if !found {
+		return ErrUnknownJob
+	}
+	if j.paused {
+		j.paused = false
+		j.next = j.schedule.Next(time.Now())
+	}
+	s.notify()
+	return nil
+}
+
+// Job returns the state of the job with the given name.
+func (s *Scheduler) Job(name string) (JobState, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, found := s.jobs[name]
+	if !found {
+		return JobState{}, false
+	}
+	return j.state(name, s.started), true
+}
+
+// Jobs returns the states of all jobs in the order they were added.
+func (s *Scheduler) Jobs() []JobState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	states := make([]JobState, 0, len(s.names))
+	for _, name := range s.names {
+		states = append(states, s.jobs[name].state(name, s.started))
+	}
+	return states
+}
+
+// Start starts running the jobs in the background, each from its next run time after now.
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return
+	}
+	now := time.Now()
+	for _, j := range s.jobs {
+		j.next = j.schedule.Next(now)
+	}
+	s.started = true
+	s.stop = make(chan struct{})
+	s.runCtx, s.cancelRuns = context.WithCancel(context.Background())
+	go s.loop(s.stop)
+}
+
+// Stop stops running the jobs and waits for the runs in progress to finish. When the context is done before they
+// finished, their contexts are cancelled and Stop returns the error of the context once they returned.
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.started {
+		s.mu.Unlock()
+		return nil
+	}
+	s.started = false
+	close(s.stop)
+	cancelRuns := s.cancelRuns
+	s.mu.Unlock()
+	defer cancelRuns()
+
+	finished := make(chan struct{})
+	go func() {
+		s.runs.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		log.Println("Runs in progress did not finish in time, cancelling them")
+		cancelRuns()
+		<-finished
+		return ctx.Err()
+	}
+}
+
+// loop runs the due jobs and sleeps until the next job is due or the jobs change, until stop is closed.
+func (s *Scheduler) loop(stop chan struct{}) {
+	for {
+		wait := s.runDueJobs(time.Now())
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-s.changed:
+			timer.Stop()
+		case <-stop:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// runDueJobs starts the jobs that are due at the given time and returns how long to wait for the next due job.
+func (s *Scheduler) runDueJobs(now time.Time) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	wait := idleWait
+	if !s.started {
+		return wait
+	}
+	for _, name := range s.names {
+		j := s.jobs[name]
+		if j.paused || j.next.IsZero() {
+			continue
+		}
+		if !j.next.After(now) {
+			s.startJob(name, j)
+			j.next = j.schedule.Next(now)
+			if j.next.IsZero() {
+				continue
+			}
+		}
+		if until := j.next.Sub(now); until < wait {
+			wait = until
+		}
+	}
+	return wait
+}
+
+// startJob runs the job in its own goroutine unless its previous run is still in progress.
+func (s *Scheduler) startJob(name string, j *job) {
+	if j.running {
+		log.Printf("Previous run of job %v is still in progress, skipping this one", name)
+		return
+	}
+	j.running = true
+	s.runs.Add(1)
+	go func(ctx context.Context) {
+		defer s.runs.Done()
+		defer func() {
+			s.mu.Lock()
+			j.running = false
+			s.mu.Unlock()
+		}()
+		j.run(ctx)
+	}(s.runCtx)
+}
+
+// notify wakes up the loop so that it picks up changed jobs. The caller has to hold the lock.
+func (s *Scheduler) notify() {
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+}
+
+func (j *job) state(name string, started bool) JobState {
+	state := JobState{Name: name, Paused: j.paused, Running: j.running}
+	if started && !j.paused {
+		state.Next = j.next
+	}
+	return state
+}
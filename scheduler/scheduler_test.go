@@ -0,0 +1,156 @@
+package scheduler
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseCronNext(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	assert.NoError(t, err)
+	// Saturday 1 July 2023, 10:30:15 BST
+	after := time.Date(2023, 7, 1, 9, 30, 15, 0, time.UTC)
+
+	for expression, expected := range map[string]time.Time{
+		"* * * * *":          time.Date(2023, 7, 1, 9, 31, 0, 0, time.UTC),
+		"*/15 * * * *":       time.Date(2023, 7, 1, 9, 45, 0, 0, time.UTC),
+		"0 * * * *":          time.Date(2023, 7, 1, 10, 0, 0, 0, time.UTC),
+		"@hourly":            time.Date(2023, 7, 1, 10, 0, 0, 0, time.UTC),
+		"0 0-6 * * *":        time.Date(2023, 7, 1, 23, 0, 0, 0, time.UTC),
+		"* 12-22 * * SAT":    time.Date(2023, 7, 1, 11, 0, 0, 0, time.UTC),
+		"0 9 * * mon-fri":    time.Date(2023, 7, 3, 8, 0, 0, 0, time.UTC),
+		"0 12 * * 7":         time.Date(2023, 7, 2, 11, 0, 0, 0, time.UTC),
+		"0 0 1 jan *":        time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		"30 10 15 * 1":       time.Date(2023, 7, 3, 9, 30, 0, 0, time.UTC),
+		"0 12 1,15 * *":      time.Date(2023, 7, 1, 11, 0, 0, 0, time.UTC),
+		"@every 90s":         after.Add(90 * time.Second),
+		"5,10 10-11/1 * * *": time.Date(2023, 7, 1, 10, 5, 0, 0, time.UTC),
+	} {
+		schedule, err := ParseCron(expression, london)
+		if assert.NoError(t, err, expression) {
+			assert.Equal(t, expected, schedule.Next(after).UTC(), expression)
+		}
+	}
+}
+
+func TestParseCronRejectsInvalidExpressions(t *testing.T) {
+	for _, expression := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "5-1 * * * *", "*/0 * * * *", "@every soon"} {
+		_, err := ParseCron(expression, time.UTC)
+		assert.Error(t, err, expression)
+	}
+}
+
+func TestParseCronNeverMatching(t *testing.T) {
+	schedule, err := ParseCron("0 0 30 2 *", time.UTC)
+	assert.NoError(t, err)
+	assert.True(t, schedule.Next(time.Now()).IsZero())
+}
+
+func TestCombine(t *testing.T) {
+	hourly, _ := ParseCron("0 * * * *", time.UTC)
+	quarterly, _ := ParseCron("15 * * * *", time.UTC)
+	after := time.Date(2023, 7, 1, 9, 20, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2023, 7, 1, 10, 0, 0, 0, time.UTC), Combine(hourly, quarterly).Next(after))
+}
+
+func TestSchedulerPauseAndResume(t *testing.T) {
+	s := New()
+	var runs int32
+	assert.NoError(t, s.Add("feed", Every(10*time.Millisecond), func(context.Context) { atomic.AddInt32(&runs, 1) }))
+	assert.Error(t, s.Add("feed", Every(time.Second), func(context.Context) {}))
+	s.Start()
+
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&runs) >= 3 }, time.Second, 5*time.Millisecond)
+
+	assert.NoError(t, s.Pause("feed"))
+	state, found := s.Job("feed")
+	assert.True(t, found)
+	assert.True(t, state.Paused)
+	assert.True(t, state.Next.IsZero())
+	time.Sleep(20 * time.Millisecond)
+	paused := atomic.LoadInt32(&runs)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, paused, atomic.LoadInt32(&runs))
+
+	assert.NoError(t, s.Resume("feed"))
+	assert.False(t, s.Jobs()[0].Paused)
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&runs) > paused }, time.Second, 5*time.Millisecond)
+
+	assert.Equal(t, ErrUnknownJob, s.Pause("unknown"))
+}
+
+func TestSchedulerSkipsOverlappingRuns(t *testing.T) {
+	s := New()
+	var running, maxRunning, runs int32
+	s.Add("slow", Every(5*time.Millisecond), func(context.Context) {
+		current := atomic.AddInt32(&running, 1)
+		if current > atomic.LoadInt32(&maxRunning) {
+			atomic.StoreInt32(&maxRunning, current)
+		}
+		time.Sleep(30 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		atomic.AddInt32(&runs, 1)
+	})
+	s.Start()
+
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&runs) >= 2 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&maxRunning))
+}
+
+func TestSchedulerStopAndRestart(t *testing.T) {
+	s := New()
+	var runs int32
+	assert.NoError(t, s.Add("feed", Every(10*time.Millisecond), func(context.Context) { atomic.AddInt32(&runs, 1) }))
+	state, _ := s.Job("feed")
+	assert.True(t, state.Next.IsZero())
+
+	s.Start()
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&runs) >= 2 }, time.Second, 5*time.Millisecond)
+
+	assert.NoError(t, s.Stop(context.Background()))
+	state, _ = s.Job("feed")
+	assert.True(t, state.Next.IsZero())
+	time.Sleep(20 * time.Millisecond)
+	stopped := atomic.LoadInt32(&runs)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, stopped, atomic.LoadInt32(&runs))
+
+	s.Start()
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&runs) > stopped }, time.Second, 5*time.Millisecond)
+	assert.NoError(t, s.Stop(context.Background()))
+}
+
+func TestSchedulerStopWaitsForRuns(t *testing.T) {
+	s := New()
+	var started, finished int32
+	s.Add("slow", Every(5*time.Millisecond), func(ctx context.Context) {
+		atomic.StoreInt32(&started, 1)
+		time.Sleep(30 * time.Millisecond)
+		atomic.StoreInt32(&finished, 1)
+	})
+	s.Start()
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&started) == 1 }, time.Second, time.Millisecond)
+
+	assert.NoError(t, s.Stop(context.Background()))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&finished))
+}
+
+func TestSchedulerStopCancelsRunsAfterDeadline(t *testing.T) {
+	s := New()
+	var started, cancelled int32
+	s.Add("stuck", Every(5*time.Millisecond), func(ctx context.Context) {
+		atomic.StoreInt32(&started, 1)
+		<-ctx.Done()
+		atomic.StoreInt32(&cancelled, 1)
+	})
+	s.Start()
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&started) == 1 }, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, s.Stop(ctx))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&cancelled))
+}
@@ -1,9 +1,13 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"github.com/SkaisgirisMarius/article-processor/articles"
+	"github.com/SkaisgirisMarius/article-processor/auth"
 	"github.com/SkaisgirisMarius/article-processor/config"
 	"github.com/SkaisgirisMarius/article-processor/health"
+	"github.com/SkaisgirisMarius/article-processor/leader"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
@@ -12,13 +16,15 @@ import (
 	"time"
 )
 
-// NewRouter returns a new HTTP handler that implements the main server routes
-func NewRouter() http.Handler {
+// NewRouter returns a new HTTP handler that implements the main server routes on the given storage,
+// the health route reports the state of the given elector
+func NewRouter(elector *leader.Elector, store *articles.Storage) http.Handler {
 
 	r := chi.NewRouter()
 	cors := cors.New(cors.Options{
 		AllowedOrigins: []string{"*"},
 		AllowedMethods: []string{"GET", "POST"},
+		AllowedHeaders: []string{"Origin", "Accept", "Content-Type", "X-Requested-With", auth.HeaderAPIKey},
 	})
 
 	r.Use(middleware.RequestID)
@@ -28,20 +34,42 @@ func NewRouter() http.Handler {
 	r.Use(middleware.Timeout(60 * time.Second))
 
 	r.Use(cors.Handler)
-	r.Mount("/api/health", health.InitHealthRouter())
-	r.Mount("/api/article", articles.InitArticlesRouter())
+	r.Mount("/api/health", health.InitHealthRouter(elector))
+	r.Mount("/api/article", articles.InitArticlesRouter(store))
+	r.Mount("/api/ingestion", articles.InitIngestionRouter(store))
 	return r
 }
 
 // StartServer starts the HTTP server with the provided handler on the configured port and logs the server start-up.
-func StartServer(handler http.Handler) {
+// When the context is done the server stops accepting connections and waits up to the shutdown timeout for the
+// in-flight requests, the connections still open after that are closed. An error is only returned when the server
+// could not be started.
+func StartServer(ctx context.Context, handler http.Handler) error {
 	log.Println("Starting server on port ", config.Conf.Port)
 	httpSrv := makeHTTPServer(handler)
 	httpSrv.Addr = config.Conf.Port
-	err := httpSrv.ListenAndServe()
-	if err != nil {
-		log.Fatal("Could not start server. ", err)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- httpSrv.ListenAndServe()
+	}()
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Println("Shutting down server, waiting for in-flight requests")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.Conf.ShutdownTimeoutDuration())
+	defer cancel()
+	if err := httpSrv.Shutdown(shutdownCtx); err != nil {
+		log.Println("In-flight requests did not finish in time, closing their connections:", err)
+		httpSrv.Close()
+	}
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		return err
 	}
+	return nil
 }
 
 // makeHTTPServer creates an HTTP server with the provided handler and returns it.
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"context"
+	"github.com/SkaisgirisMarius/article-processor/config"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestStartServerDrainsInFlightRequests(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := listener.Addr().String()
+	listener.Close()
+	config.Conf = &config.Config{Port: addr, ShutdownTimeout: 5}
+
+	received := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(received)
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("done"))
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- StartServer(ctx, handler)
+	}()
+
+	response := make(chan string, 1)
+	go func() {
+		var res *http.Response
+		assert.Eventually(t, func() bool {
+			var getErr error
+			res, getErr = http.Get("http://" + addr)
+			return getErr == nil
+		}, time.Second, 10*time.Millisecond)
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		response <- string(body)
+	}()
+
+	<-received
+	cancel()
+	assert.Equal(t, "done", <-response)
+	assert.NoError(t, <-stopped)
+
+	_, err = http.Get("http://" + addr)
+	assert.Error(t, err)
+}
@@ -0,0 +1,51 @@
+package upstream
+
+import (
+	"sync"
+	"time"
+)
+
+// breaker is a circuit breaker for a single host. It opens after threshold consecutive failures and rejects
+// requests until the cooldown has passed, then lets a single trial request through. A successful trial closes
+// the breaker again, a failed one opens it for another cooldown.
+type breaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+
+	failures int
+	openedAt time.Time
+	open     bool
+	trial    bool
+}
+
+// allow reports whether a request may be sent to the host.
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.open {
+		return true
+	}
+	if b.trial || time.Since(b.openedAt) < b.cooldown {
+		return false
+	}
+	b.trial = true
+	return true
+}
+
+// record registers the outcome of a request sent to the host.
+func (b *breaker) record(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+	if success {
+		b.failures = 0
+		b.open = false
+		return
+	}
+	b.failures++
+	if b.open || (b.threshold > 0 && b.failures >= b.threshold) {
+		b.open = true
+		b.openedAt = time.Now()
+	}
+}
@@ -0,0 +1,263 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/SkaisgirisMarius/article-processor/config"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without sending a request while the circuit breaker of the host is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// ErrResponseTooLarge is returned when a response body exceeds the configured maximum size.
+var ErrResponseTooLarge = errors.New("response body is too large")
+
+// StatusError is returned when the upstream responds with a non-2xx status code.
+// RetryAfter is the delay requested by the upstream through the Retry-After header, if any.
+type StatusError struct {
+	URL        string
+	StatusCode int
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code %v from %v", e.StatusCode, e.URL)
+}
+
+// Options configures the behaviour of a Client.
+type Options struct {
+	// Timeout bounds a single attempt, including reading the response body.
+	Timeout time.Duration
+	// MaxRetries is the number of retries after the first attempt failed with a network error or a 5xx response.
+	MaxRetries int
+	// BaseBackoff is the delay before the first retry, it doubles with every retry up to MaxBackoff.
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// MaxBodySize is the maximum accepted size of a response body in bytes, zero disables the cap.
+	MaxBodySize int64
+	// BreakerThreshold is the number of consecutive failed attempts after which the circuit breaker of a host opens,
+	// zero disables the circuit breaker.
+	BreakerThreshold int
+	// BreakerCooldown is how long the circuit breaker stays open before a trial request is let through.
+	BreakerCooldown time.Duration
+}
+
+// Client is an HTTP client for the external article endpoints. It retries failed requests with an exponential
+// backoff and jitter, rejects non-2xx responses, caps the size of response bodies and keeps a circuit breaker per host.
+type Client struct {
+	httpClient *http.Client
+	opts       Options
+
+	mu       sync.Mutex
+	breakers map[string]*breaker
+}
+
+var (
+	defaultClient     *Client
+	defaultClientOnce sync.Once
+)
+
+// NewClient creates a new Client with the given options.
+func NewClient(opts Options) *Client {
+	return &Client{
+		httpClient: &http.Client{Timeout: opts.Timeout},
+		opts:       opts,
+		breakers:   make(map[string]*breaker),
+	}
+}
+
+// GetClient returns the shared Client configured from the upstream section of the configuration.
+func GetClient() *Client {
+	defaultClientOnce.Do(func() {
+		c := config.Conf.Upstream
+		maxRetries := 0
+		if c.MaxRetries != nil {
+			maxRetries = *c.MaxRetries
+		}
+		defaultClient = NewClient(Options{
+			Timeout:          time.Duration(c.Timeout) * time.Second,
+			MaxRetries:       maxRetries,
+			BaseBackoff:      time.Duration(c.BaseBackoff) * time.Millisecond,
+			MaxBackoff:       time.Duration(c.MaxBackoff) * time.Millisecond,
+			MaxBodySize:      c.MaxBodySize,
+			BreakerThreshold: c.BreakerThreshold,
+			BreakerCooldown:  time.Duration(c.BreakerCooldown) * time.Second,
+		})
+	})
+	return defaultClient
+}
+
+// Response is the outcome of a successful or not modified conditional GET request.
+type Response struct {
+	StatusCode   int
+	Body         []byte
+	ETag         string
+	LastModified string
+}
+
+// NotModified reports whether the upstream answered that the resource did not change since the given validators.
+func (r *Response) NotModified() bool {
+	return r.StatusCode == http.StatusNotModified
+}
+
+// Get sends a GET request to the given URL and returns the response body.
+// Network errors, 5xx and 429 responses are retried, any other non-2xx response is returned as a *StatusError.
+func (c *Client) Get(ctx context.Context, rawURL string) ([]byte, error) {
+	response, err := c.GetConditional(ctx, rawURL, "", "")
+	if err != nil {
+		return nil, err
+	}
+	return response.Body, nil
+}
+
+// GetConditional works like Get, but sends the given ETag and Last-Modified values as If-None-Match and
+// If-Modified-Since. A 304 Not Modified response is returned without an error and without a body.
+func (c *Client) GetConditional(ctx context.Context, rawURL string, etag string, lastModified string) (*Response, error) {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	hostBreaker := c.getBreaker(parsedURL.Host)
+
+	header := make(http.Header)
+	if etag != "" {
+		header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		header.Set("If-Modified-Since", lastModified)
+	}
+
+	for attempt := 0; ; attempt++ {
+		if !hostBreaker.allow() {
+			return nil, fmt.Errorf("%w for %v", ErrCircuitOpen, parsedURL.Host)
+		}
+
+		response, err := c.get(ctx, rawURL, header)
+		hostBreaker.record(!isRetryable(err))
+		if err == nil {
+			return response, nil
+		}
+		if !isRetryable(err) || attempt >= c.opts.MaxRetries || ctx.Err() != nil {
+			return nil, err
+		}
+
+		delay := c.backoff(attempt)
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && statusErr.RetryAfter > delay {
+			delay = statusErr.RetryAfter
+		}
+		log.Printf("Request to %v failed (attempt %v), retrying in %v: %v", rawURL, attempt+1, delay, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// get sends a single GET request with the given headers and reads its body.
+func (c *Client) get(ctx context.Context, rawURL string, header http.Header) (*Response, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header = header
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	result := &Response{
+		StatusCode:   response.StatusCode,
+		ETag:         response.Header.Get("ETag"),
+		LastModified: response.Header.Get("Last-Modified"),
+	}
+	if response.StatusCode == http.StatusNotModified {
+		return result, nil
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		// Drain a little of the body so that the connection can be reused
+		io.Copy(io.Discard, io.LimitReader(response.Body, 4096))
+		return nil, &StatusError{
+			URL:        rawURL,
+			StatusCode: response.StatusCode,
+			RetryAfter: parseRetryAfter(response.Header.Get("Retry-After")),
+		}
+	}
+
+	if c.opts.MaxBodySize <= 0 {
+		result.Body, err = io.ReadAll(response.Body)
+		return result, err
+	}
+	body, err := io.ReadAll(io.LimitReader(response.Body, c.opts.MaxBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > c.opts.MaxBodySize {
+		return nil, ErrResponseTooLarge
+	}
+	result.Body = body
+	return result, nil
+}
+
+// backoff returns the delay before the given retry: the exponential backoff with a random jitter of up to half of it.
+func (c *Client) backoff(attempt int) time.Duration {
+	delay := c.opts.BaseBackoff << attempt
+	if delay > c.opts.MaxBackoff || delay <= 0 {
+		delay = c.opts.MaxBackoff
+	}
+	half := int64(delay / 2)
+	if half <= 0 {
+		return delay
+	}
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+// getBreaker returns the circuit breaker of the given host, creating it on first use.
+func (c *Client) getBreaker(host string) *breaker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b, found := c.breakers[host]
+	if !found {
+		b = &breaker{threshold: c.opts.BreakerThreshold, cooldown: c.opts.BreakerCooldown}
+		c.breakers[host] = b
+	}
+	return b
+}
+
+// isRetryable reports whether a failed attempt should be retried. Network errors, 5xx and 429 Too Many Requests
+// responses are retried, other status codes, oversized responses and cancelled requests are not.
+func isRetryable(err error) bool {
+	if err == nil || errors.Is(err, ErrResponseTooLarge) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500 || statusErr.StatusCode == http.StatusTooManyRequests
+	}
+	return true
+}
+
+// parseRetryAfter parses the value of a Retry-After header, given either in seconds or as an HTTP date.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date)
+	}
+	return 0
+}
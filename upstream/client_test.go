@@ -0,0 +1,199 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestClient() *Client {
+	return NewClient(Options{
+		Timeout:          time.Second,
+		MaxRetries:       2,
+		BaseBackoff:      time.Millisecond,
+		MaxBackoff:       5 * time.Millisecond,
+		MaxBodySize:      1024,
+		BreakerThreshold: 3,
+		BreakerCooldown:  50 * time.Millisecond,
+	})
+}
+
+func TestGetRetriesServerErrors(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte("<xml/>"))
+	}))
+	defer server.Close()
+
+	body, err := newTestClient().Get(context.Background(), server.URL)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "<xml/>", string(body))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func TestGetGivesUpAfterMaxRetries(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	_, err := newTestClient().Get(context.Background(), server.URL)
+
+	var statusErr *StatusError
+	assert.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, http.StatusServiceUnavailable, statusErr.StatusCode)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func TestGetDoesNotRetryClientErrors(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("<html>Not found</html>"))
+	}))
+	defer server.Close()
+
+	body, err := newTestClient().Get(context.Background(), server.URL)
+
+	var statusErr *StatusError
+	assert.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, http.StatusNotFound, statusErr.StatusCode)
+	assert.Nil(t, body)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestGetRejectsOversizedResponses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("a", 2048)))
+	}))
+	defer server.Close()
+
+	_, err := newTestClient().Get(context.Background(), server.URL)
+
+	assert.ErrorIs(t, err, ErrResponseTooLarge)
+}
+
+func TestGetRetriesNetworkErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	serverURL := server.URL
+	server.Close()
+
+	_, err := newTestClient().Get(context.Background(), serverURL)
+
+	var statusErr *StatusError
+	assert.Error(t, err)
+	assert.False(t, errors.As(err, &statusErr))
+}
+
+func TestGetTimesOutSlowResponses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	client := newTestClient()
+	client.opts.MaxRetries = 0
+	client.httpClient.Timeout = 20 * time.Millisecond
+
+	started := time.Now()
+	_, err := client.Get(context.Background(), server.URL)
+
+	assert.Error(t, err)
+	assert.Less(t, time.Since(started), 150*time.Millisecond)
+}
+
+func TestCircuitBreakerOpensAndRecovers(t *testing.T) {
+	var calls int32
+	var healthy atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	client := newTestClient()
+	client.opts.MaxRetries = 0
+
+	// Three consecutive failures open the breaker
+	for i := 0; i < 3; i++ {
+		_, err := client.Get(context.Background(), server.URL)
+		assert.Error(t, err)
+	}
+	_, err := client.Get(context.Background(), server.URL)
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+
+	// After the cooldown a successful trial request closes it again
+	healthy.Store(true)
+	time.Sleep(60 * time.Millisecond)
+	body, err := client.Get(context.Background(), server.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", string(body))
+	_, err = client.Get(context.Background(), server.URL)
+	assert.NoError(t, err)
+}
+
+func TestGetConditionalSendsValidators(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Sat, 01 Jul 2023 10:00:00 GMT")
+		w.Write([]byte("<xml/>"))
+	}))
+	defer server.Close()
+	client := newTestClient()
+
+	response, err := client.GetConditional(context.Background(), server.URL, "", "")
+	assert.NoError(t, err)
+	assert.False(t, response.NotModified())
+	assert.Equal(t, `"v1"`, response.ETag)
+	assert.Equal(t, "Sat, 01 Jul 2023 10:00:00 GMT", response.LastModified)
+	assert.Equal(t, "<xml/>", string(response.Body))
+
+	response, err = client.GetConditional(context.Background(), server.URL, response.ETag, response.LastModified)
+	assert.NoError(t, err)
+	assert.True(t, response.NotModified())
+	assert.Empty(t, response.Body)
+}
+
+func TestGetHonoursRetryAfter(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	started := time.Now()
+	body, err := newTestClient().Get(context.Background(), server.URL)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", string(body))
+	assert.GreaterOrEqual(t, time.Since(started), time.Second)
+}